@@ -4,13 +4,18 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	_ "time/tzdata"
 
 	"github.com/codefarmer009/codedance/pkg/controller"
 	"github.com/codefarmer009/codedance/pkg/metrics"
 	"github.com/codefarmer009/codedance/pkg/traffic"
+	"github.com/codefarmer009/codedance/pkg/traffic/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -18,15 +23,31 @@ import (
 )
 
 var (
-	kubeconfig    string
-	prometheusURL string
-	useIstio      bool
+	kubeconfig       string
+	prometheusURL    string
+	trafficProvider  string
+	useIstio         bool
+	useGateway       bool
+	useSMI           bool
+	useReplicas      bool
+	minReplicas      int
+	hookLogsURL      string
+	proxyListen      string
+	proxyMetricsAddr string
 )
 
 func init() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to kubeconfig file")
 	flag.StringVar(&prometheusURL, "prometheus-url", "http://prometheus:9090", "Prometheus server URL")
-	flag.BoolVar(&useIstio, "use-istio", true, "Use Istio for traffic management")
+	flag.StringVar(&trafficProvider, "traffic-provider", "", "Default traffic provider for canaries without spec.trafficRouting: istio, nginx, gatewayAPI, smi, replicaRatio or proxy (defaults from the --use-* flags)")
+	flag.BoolVar(&useIstio, "use-istio", true, "Use Istio as the default traffic provider")
+	flag.BoolVar(&useGateway, "use-gateway-api", false, "Use Gateway API HTTPRoute/GRPCRoute backendRefs weights as the default traffic provider")
+	flag.BoolVar(&useSMI, "use-smi", false, "Use SMI TrafficSplit (Linkerd, Open Service Mesh) as the default traffic provider")
+	flag.BoolVar(&useReplicas, "use-replica-ratio", false, "Approximate traffic weight by scaling canary and stable replicas behind a shared Service by default")
+	flag.StringVar(&hookLogsURL, "hook-logs-url", "", "Logs link template for step hook Jobs; {namespace} and {job} are substituted")
+	flag.StringVar(&proxyListen, "proxy-listen", "", "Listen address of the built-in reverse proxy traffic provider, e.g. :8000; empty disables it")
+	flag.StringVar(&proxyMetricsAddr, "proxy-metrics-listen", ":9102", "Listen address serving the built-in reverse proxy metrics on /metrics")
+	flag.IntVar(&minReplicas, "min-replicas", 1, "Minimum replicas per version while traffic is split by replica ratio")
 }
 
 func main() {
@@ -56,17 +77,40 @@ func main() {
 		os.Exit(1)
 	}
 
-	var trafficManager controller.TrafficManager
-	if useIstio {
+	trafficManager := controller.NewTrafficProviderRegistry(defaultTrafficProvider())
+	trafficManager.Register(controller.ProviderIstio, func() (controller.TrafficManager, error) {
 		istioClient, err := traffic.NewIstioClient(config)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to create Istio client: %v\n", err)
+			return nil, err
+		}
+		return traffic.NewIstioTrafficManager(istioClient, clientset), nil
+	})
+	trafficManager.Register(controller.ProviderNginx, func() (controller.TrafficManager, error) {
+		return traffic.NewNginxTrafficManager(clientset), nil
+	})
+	trafficManager.Register(controller.ProviderGatewayAPI, func() (controller.TrafficManager, error) {
+		return traffic.NewGatewayAPITrafficManager(dynamicClient), nil
+	})
+	trafficManager.Register(controller.ProviderSMI, func() (controller.TrafficManager, error) {
+		return traffic.NewSMITrafficManager(dynamicClient), nil
+	})
+	trafficManager.Register(controller.ProviderReplicaRatio, func() (controller.TrafficManager, error) {
+		return traffic.NewReplicaTrafficManager(clientset, int32(minReplicas)), nil
+	})
+	var proxyManager *proxy.Manager
+	if proxyListen != "" {
+		proxyManager, err = startProxy()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to start traffic proxy: %v\n", err)
 			os.Exit(1)
 		}
-		trafficManager = traffic.NewIstioTrafficManager(istioClient)
-	} else {
-		trafficManager = traffic.NewNginxTrafficManager(clientset)
 	}
+	trafficManager.Register(controller.ProviderProxy, func() (controller.TrafficManager, error) {
+		if proxyManager == nil {
+			return nil, fmt.Errorf("traffic proxy is disabled, start the controller with --proxy-listen")
+		}
+		return proxyManager, nil
+	})
 
 	decisionEngine := controller.NewDefaultDecisionEngine()
 	rollbackManager := controller.NewDefaultRollbackManager(clientset, trafficManager)
@@ -79,6 +123,7 @@ func main() {
 		rollbackManager,
 	)
 	canaryController.SetDynamicClient(dynamicClient)
+	canaryController.SetHookLogsURL(hookLogsURL)
 	rollbackManager.SetController(canaryController)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -100,6 +145,50 @@ func main() {
 	}
 }
 
+func defaultTrafficProvider() string {
+	switch {
+	case trafficProvider != "":
+		return trafficProvider
+	case useReplicas:
+		return controller.ProviderReplicaRatio
+	case useSMI:
+		return controller.ProviderSMI
+	case useGateway:
+		return controller.ProviderGatewayAPI
+	case useIstio:
+		return controller.ProviderIstio
+	default:
+		return controller.ProviderNginx
+	}
+}
+
+// startProxy serves the built-in reverse proxy and its metrics in the
+// background.
+func startProxy() (*proxy.Manager, error) {
+	registry := prometheus.NewRegistry()
+	requestMetrics, err := proxy.NewMetrics(registry)
+	if err != nil {
+		return nil, err
+	}
+	manager := proxy.NewManager(requestMetrics)
+
+	go func() {
+		if err := http.ListenAndServe(proxyListen, manager); err != nil {
+			fmt.Fprintf(os.Stderr, "Traffic proxy error: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		if err := http.ListenAndServe(proxyMetricsAddr, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "Traffic proxy metrics error: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+	return manager, nil
+}
+
 func buildConfig() (*rest.Config, error) {
 	if kubeconfig != "" {
 		return clientcmd.BuildConfigFromFlags("", kubeconfig)
@@ -0,0 +1,101 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// CanaryPolicy is a cluster-scoped policy applied to every CanaryDeployment
+// in addition to its own settings.
+type CanaryPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CanaryPolicySpec `json:"spec"`
+}
+
+type CanaryPolicySpec struct {
+	Schedule    *DeploymentSchedule `json:"schedule,omitempty"`
+	Concurrency *ConcurrencyLimit   `json:"concurrency,omitempty"`
+}
+
+// ConcurrencyLimit caps how many rollouts may be in progress at once across
+// the cluster and within each namespace; zero means unlimited. Rollouts over
+// the limit wait in the Pending phase, ordered FIFO (default) or by Priority.
+type ConcurrencyLimit struct {
+	MaxProgressing             int    `json:"maxProgressing,omitempty"`
+	MaxProgressingPerNamespace int    `json:"maxProgressingPerNamespace,omitempty"`
+	Order                      string `json:"order,omitempty"`
+}
+
+type CanaryPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CanaryPolicy `json:"items"`
+}
+
+func (in *CanaryPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+func (in *CanaryPolicy) DeepCopy() *CanaryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *CanaryPolicy) DeepCopyInto(out *CanaryPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+func (in *CanaryPolicySpec) DeepCopyInto(out *CanaryPolicySpec) {
+	*out = *in
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(DeploymentSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Concurrency != nil {
+		in, out := &in.Concurrency, &out.Concurrency
+		*out = new(ConcurrencyLimit)
+		**out = **in
+	}
+}
+
+func (in *CanaryPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+func (in *CanaryPolicyList) DeepCopy() *CanaryPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *CanaryPolicyList) DeepCopyInto(out *CanaryPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CanaryPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
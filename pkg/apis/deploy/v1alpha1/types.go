@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	batchv1 "k8s.io/api/batch/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -14,22 +15,262 @@ type CanaryDeployment struct {
 }
 
 type CanaryDeploymentSpec struct {
-	TargetDeployment string             `json:"targetDeployment"`
-	CanaryVersion    string             `json:"canaryVersion"`
-	Strategy         DeployStrategy     `json:"strategy"`
-	Metrics          MetricsConfig      `json:"metrics"`
-	AutoRollback     AutoRollbackConfig `json:"autoRollback"`
+	// TargetDeployment names a Deployment target. WorkloadRef takes
+	// precedence and can reference other kinds.
+	TargetDeployment string             `json:"targetDeployment,omitempty"`
+	WorkloadRef      *WorkloadReference `json:"workloadRef,omitempty"`
+
+	// CanaryNodeSelector limits the nodes a DaemonSet canary may run on.
+	CanaryNodeSelector map[string]string `json:"canaryNodeSelector,omitempty"`
+
+	Scaling *ReplicaScaling `json:"scaling,omitempty"`
+
+	CanaryVersion string              `json:"canaryVersion"`
+	Strategy      DeployStrategy      `json:"strategy"`
+	Metrics       MetricsConfig       `json:"metrics"`
+	AutoRollback  AutoRollbackConfig  `json:"autoRollback"`
+	Schedule      *DeploymentSchedule `json:"schedule,omitempty"`
+
+	DependsOn []RolloutDependency `json:"dependsOn,omitempty"`
+
+	// Priority orders queued rollouts when a CanaryPolicy limits concurrency
+	// by priority; higher values start first.
+	Priority int `json:"priority,omitempty"`
+
+	TrafficRouting *TrafficRouting `json:"trafficRouting,omitempty"`
+
+	// Services has the controller create and maintain the stable and canary
+	// Services instead of expecting them to exist.
+	Services *ManagedServices `json:"services,omitempty"`
+}
+
+// ManagedServices names the Services the controller manages. Both clone the
+// ports and selector of Service, by default the one named after the target,
+// and narrow the selector to the pods of one version. StableService and
+// CanaryService default to "<target>-stable" and "<target>-canary", and are
+// the default backends of the Gateway API and SMI providers. The nginx
+// provider only defaults its canary backend to CanaryService.
+type ManagedServices struct {
+	Service       string `json:"service,omitempty"`
+	StableService string `json:"stableService,omitempty"`
+	CanaryService string `json:"canaryService,omitempty"`
+}
+
+// TrafficRouting selects the traffic provider for the canary and configures
+// it. Provider may be omitted when the provider's own section is set; with
+// neither, the controller's default provider is used.
+type TrafficRouting struct {
+	Provider string `json:"provider,omitempty"`
+	// Providers lists several providers that shift weight together, in
+	// order, for services reachable through more than one path. It takes
+	// precedence over Provider.
+	Providers []string `json:"providers,omitempty"`
+
+	Istio      *IstioTrafficRouting      `json:"istio,omitempty"`
+	Nginx      *NginxTrafficRouting      `json:"nginx,omitempty"`
+	GatewayAPI *GatewayAPITrafficRouting `json:"gatewayAPI,omitempty"`
+	SMI        *SMITrafficRouting        `json:"smi,omitempty"`
+	Proxy      *ProxyTrafficRouting      `json:"proxy,omitempty"`
+
+	// DriftPolicy decides what happens when the weight the provider applies
+	// no longer matches status.currentWeight: Restore (the default) writes
+	// the weight back, Pause holds the rollout until the drift is resolved
+	// and Ignore skips the check.
+	DriftPolicy string `json:"driftPolicy,omitempty"`
+}
+
+// SMITrafficRouting names the SMI TrafficSplit, by default the one named
+// after the canary, splitting RootService between the stable and canary
+// Services. Services default to the target, the target and
+// "<target>-canary" respectively, or to the ones in spec.services.
+type SMITrafficRouting struct {
+	TrafficSplit  string `json:"trafficSplit,omitempty"`
+	RootService   string `json:"rootService,omitempty"`
+	StableService string `json:"stableService,omitempty"`
+	CanaryService string `json:"canaryService,omitempty"`
+}
+
+// ProxyTrafficRouting routes the requests the controller's built-in reverse
+// proxy receives for Hosts, by default the canary name, to the StableURL and
+// CanaryURL upstreams. StickyCookie, when set, names the cookie that keeps a
+// client on the version it was first sent to.
+type ProxyTrafficRouting struct {
+	Hosts        []string `json:"hosts,omitempty"`
+	StableURL    string   `json:"stableURL"`
+	CanaryURL    string   `json:"canaryURL"`
+	StickyCookie string   `json:"stickyCookie,omitempty"`
+}
+
+// NginxTrafficRouting names the Ingress serving the stable version, by
+// default the one named after the target, and the Services behind it. The
+// canary Ingress copies the stable Ingress rules that route to StableService
+// and sends them to CanaryService instead.
+type NginxTrafficRouting struct {
+	StableIngress string `json:"stableIngress,omitempty"`
+	StableService string `json:"stableService,omitempty"`
+	CanaryService string `json:"canaryService,omitempty"`
+}
+
+// GatewayAPITrafficRouting names the Gateway API HTTPRoute and GRPCRoute
+// whose backendRefs are reweighted between the stable and canary Services.
+// With neither set, the HTTPRoute named after the canary is used. ParentRefs,
+// Hostnames and Port are used when a route is created.
+type GatewayAPITrafficRouting struct {
+	HTTPRoute     string             `json:"httpRoute,omitempty"`
+	GRPCRoute     string             `json:"grpcRoute,omitempty"`
+	StableService string             `json:"stableService,omitempty"`
+	CanaryService string             `json:"canaryService,omitempty"`
+	Port          int32              `json:"port,omitempty"`
+	ParentRefs    []GatewayParentRef `json:"parentRefs,omitempty"`
+	Hostnames     []string           `json:"hostnames,omitempty"`
+}
+
+// GatewayParentRef mirrors the Gateway API ParentReference.
+type GatewayParentRef struct {
+	Group       string `json:"group,omitempty"`
+	Kind        string `json:"kind,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name"`
+	SectionName string `json:"sectionName,omitempty"`
+	Port        int32  `json:"port,omitempty"`
+}
+
+// IstioTrafficRouting names the VirtualService to manage, by default the one
+// named after the canary, and the routes in it whose stable and canary
+// subsets are reweighted: HTTP routes by name, TLS and TCP routes by their
+// match attributes. With no routes listed every route of any protocol with
+// both subsets is. Hosts and Gateways are used when the VirtualService is
+// created, with the target Service as the default host.
+type IstioTrafficRouting struct {
+	VirtualService string          `json:"virtualService,omitempty"`
+	Routes         []string        `json:"routes,omitempty"`
+	TLSRoutes      []IstioTLSRoute `json:"tlsRoutes,omitempty"`
+	TCPRoutes      []IstioTCPRoute `json:"tcpRoutes,omitempty"`
+	Hosts          []string        `json:"hosts,omitempty"`
+	Gateways       []string        `json:"gateways,omitempty"`
+}
+
+// IstioTLSRoute selects the TLS routes matching Port, when set, and all of
+// SNIHosts.
+type IstioTLSRoute struct {
+	Port     int64    `json:"port,omitempty"`
+	SNIHosts []string `json:"sniHosts,omitempty"`
+}
+
+// IstioTCPRoute selects the TCP routes matching Port, when set.
+type IstioTCPRoute struct {
+	Port int64 `json:"port,omitempty"`
+}
+
+// RolloutDependency holds a rollout back until another CanaryDeployment has
+// reached Phase or Weight; a Completed dependency always satisfies it. With
+// neither set the dependency must complete. RollbackTogether rolls this
+// canary back when the dependency fails.
+type RolloutDependency struct {
+	Name             string `json:"name"`
+	Namespace        string `json:"namespace,omitempty"`
+	Phase            string `json:"phase,omitempty"`
+	Weight           int    `json:"weight,omitempty"`
+	RollbackTogether bool   `json:"rollbackTogether,omitempty"`
+}
+
+// ReplicaScaling sizes a Deployment or ReplicaSet canary in proportion to
+// its weight, with at least MinReplicas (1 by default). ScaleDownStable
+// shrinks the stable version by the complementary share.
+type ReplicaScaling struct {
+	MinReplicas     *int32 `json:"minReplicas,omitempty"`
+	ScaleDownStable bool   `json:"scaleDownStable,omitempty"`
+}
+
+// WorkloadReference identifies the workload being rolled out: a Deployment,
+// ReplicaSet, StatefulSet or DaemonSet in the canary's namespace.
+type WorkloadReference struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
 }
 
 type DeployStrategy struct {
 	Type  string       `json:"type"`
-	Steps []DeployStep `json:"steps"`
+	Steps []DeployStep `json:"steps,omitempty"`
+
+	// Match routes matching requests to the canary on every step that sets
+	// no match of its own.
+	Match []RouteMatch `json:"match,omitempty"`
+
+	// The fields below are only used when Steps is empty, in which case the
+	// steps are generated from them according to Type.
+	StartWeight   int     `json:"startWeight,omitempty"`
+	StepIncrement int     `json:"stepIncrement,omitempty"`
+	GrowthFactor  float64 `json:"growthFactor,omitempty"`
+	MaxWeight     int     `json:"maxWeight,omitempty"`
+	StepInterval  string  `json:"stepInterval,omitempty"`
+	StepCount     int     `json:"stepCount,omitempty"`
+
+	BlueGreen *BlueGreenStrategy `json:"blueGreen,omitempty"`
+	Adaptive  *AdaptiveStrategy  `json:"adaptive,omitempty"`
+}
+
+type BlueGreenStrategy struct {
+	PreviewService  string `json:"previewService,omitempty"`
+	PreviewDuration string `json:"previewDuration,omitempty"`
+	ScaleDownDelay  string `json:"scaleDownDelay,omitempty"`
+}
+
+// AdaptiveStrategy sizes each step from the health score and the canary
+// request rate, between MinStepSize and MaxStepSize percentage points.
+type AdaptiveStrategy struct {
+	MinStepSize       int     `json:"minStepSize,omitempty"`
+	MaxStepSize       int     `json:"maxStepSize,omitempty"`
+	TargetRequestRate float64 `json:"targetRequestRate,omitempty"`
 }
 
 type DeployStep struct {
 	Weight  int           `json:"weight"`
 	Pause   string        `json:"pause"`
 	Metrics []MetricCheck `json:"metrics,omitempty"`
+	Match   []RouteMatch  `json:"match,omitempty"`
+
+	// MirrorPercent mirrors that share of live requests to the canary while
+	// responses are still served by the stable version.
+	MirrorPercent int `json:"mirrorPercent,omitempty"`
+
+	// Replicas overrides the canary replica count derived from Weight.
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// PreHooks run before traffic is shifted to Weight and PostHooks run
+	// once the step's pause has elapsed, before moving on.
+	PreHooks  []StepHook `json:"preHooks,omitempty"`
+	PostHooks []StepHook `json:"postHooks,omitempty"`
+}
+
+// StepHook runs a Job from Template and waits up to Timeout (10m by default)
+// for it to complete. OnFailure is Rollback (default) or Pause.
+type StepHook struct {
+	Name      string                  `json:"name"`
+	Template  batchv1.JobTemplateSpec `json:"template"`
+	Timeout   string                  `json:"timeout,omitempty"`
+	OnFailure string                  `json:"onFailure,omitempty"`
+}
+
+// RouteMatch sends requests matching all of its conditions to the canary
+// regardless of the step weight.
+type RouteMatch struct {
+	Headers      map[string]StringMatch `json:"headers,omitempty"`
+	Cookie       *CookieMatch           `json:"cookie,omitempty"`
+	QueryParams  map[string]StringMatch `json:"queryParams,omitempty"`
+	SourceLabels map[string]string      `json:"sourceLabels,omitempty"`
+}
+
+type StringMatch struct {
+	Exact  string `json:"exact,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Regex  string `json:"regex,omitempty"`
+}
+
+type CookieMatch struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
 }
 
 type MetricCheck struct {
@@ -38,9 +279,10 @@ type MetricCheck struct {
 }
 
 type MetricsConfig struct {
-	SuccessRate MetricThreshold `json:"successRate"`
-	Latency     LatencyConfig   `json:"latency"`
-	ErrorRate   MetricThreshold `json:"errorRate"`
+	SuccessRate MetricThreshold   `json:"successRate"`
+	Latency     LatencyConfig     `json:"latency"`
+	ErrorRate   MetricThreshold   `json:"errorRate"`
+	RequestRate RequestRateConfig `json:"requestRate,omitempty"`
 }
 
 type MetricThreshold struct {
@@ -48,6 +290,10 @@ type MetricThreshold struct {
 	Query     string  `json:"query"`
 }
 
+type RequestRateConfig struct {
+	Query string `json:"query,omitempty"`
+}
+
 type LatencyConfig struct {
 	P99   string `json:"p99"`
 	Query string `json:"query"`
@@ -59,6 +305,27 @@ type AutoRollbackConfig struct {
 	OnPodCrash    bool `json:"onPodCrash"`
 }
 
+// DeploymentSchedule restricts when traffic may be shifted. Windows are
+// evaluated in Timezone (UTC by default); when Windows is empty traffic may
+// shift at any time outside Blackouts.
+type DeploymentSchedule struct {
+	Timezone  string             `json:"timezone,omitempty"`
+	Windows   []DeploymentWindow `json:"windows,omitempty"`
+	Blackouts []BlackoutPeriod   `json:"blackouts,omitempty"`
+}
+
+type DeploymentWindow struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+type BlackoutPeriod struct {
+	Start  metav1.Time `json:"start"`
+	End    metav1.Time `json:"end"`
+	Reason string      `json:"reason,omitempty"`
+}
+
 type CanaryDeploymentStatus struct {
 	Phase          string             `json:"phase"`
 	CurrentStep    int                `json:"currentStep"`
@@ -66,6 +333,21 @@ type CanaryDeploymentStatus struct {
 	Reason         string             `json:"reason,omitempty"`
 	LastUpdateTime metav1.Time        `json:"lastUpdateTime,omitempty"`
 	Conditions     []metav1.Condition `json:"conditions,omitempty"`
+	ScaleDownTime  *metav1.Time       `json:"scaleDownTime,omitempty"`
+	Hooks          []HookStatus       `json:"hooks,omitempty"`
+}
+
+// HookStatus records the Job run for a step hook.
+type HookStatus struct {
+	Name           string       `json:"name"`
+	Type           string       `json:"type"`
+	Step           int          `json:"step"`
+	JobName        string       `json:"jobName"`
+	Phase          string       `json:"phase"`
+	Message        string       `json:"message,omitempty"`
+	LogsURL        string       `json:"logsURL,omitempty"`
+	StartTime      metav1.Time  `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 }
 
 type CanaryDeploymentList struct {
@@ -100,9 +382,176 @@ func (in *CanaryDeployment) DeepCopyInto(out *CanaryDeployment) {
 
 func (in *CanaryDeploymentSpec) DeepCopyInto(out *CanaryDeploymentSpec) {
 	*out = *in
+	if in.WorkloadRef != nil {
+		in, out := &in.WorkloadRef, &out.WorkloadRef
+		*out = new(WorkloadReference)
+		**out = **in
+	}
+	if in.CanaryNodeSelector != nil {
+		in, out := &in.CanaryNodeSelector, &out.CanaryNodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Scaling != nil {
+		in, out := &in.Scaling, &out.Scaling
+		*out = new(ReplicaScaling)
+		(*in).DeepCopyInto(*out)
+	}
 	in.Strategy.DeepCopyInto(&out.Strategy)
 	out.Metrics = in.Metrics
 	out.AutoRollback = in.AutoRollback
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(DeploymentSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]RolloutDependency, len(*in))
+		copy(*out, *in)
+	}
+	if in.TrafficRouting != nil {
+		in, out := &in.TrafficRouting, &out.TrafficRouting
+		*out = new(TrafficRouting)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Services != nil {
+		in, out := &in.Services, &out.Services
+		*out = new(ManagedServices)
+		**out = **in
+	}
+}
+
+func (in *TrafficRouting) DeepCopyInto(out *TrafficRouting) {
+	*out = *in
+	if in.Providers != nil {
+		in, out := &in.Providers, &out.Providers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Istio != nil {
+		in, out := &in.Istio, &out.Istio
+		*out = new(IstioTrafficRouting)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Nginx != nil {
+		in, out := &in.Nginx, &out.Nginx
+		*out = new(NginxTrafficRouting)
+		**out = **in
+	}
+	if in.GatewayAPI != nil {
+		in, out := &in.GatewayAPI, &out.GatewayAPI
+		*out = new(GatewayAPITrafficRouting)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SMI != nil {
+		in, out := &in.SMI, &out.SMI
+		*out = new(SMITrafficRouting)
+		**out = **in
+	}
+	if in.Proxy != nil {
+		in, out := &in.Proxy, &out.Proxy
+		*out = new(ProxyTrafficRouting)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+func (in *ProxyTrafficRouting) DeepCopyInto(out *ProxyTrafficRouting) {
+	*out = *in
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+func (in *GatewayAPITrafficRouting) DeepCopyInto(out *GatewayAPITrafficRouting) {
+	*out = *in
+	if in.ParentRefs != nil {
+		in, out := &in.ParentRefs, &out.ParentRefs
+		*out = make([]GatewayParentRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.Hostnames != nil {
+		in, out := &in.Hostnames, &out.Hostnames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+func (in *IstioTrafficRouting) DeepCopyInto(out *IstioTrafficRouting) {
+	*out = *in
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TLSRoutes != nil {
+		in, out := &in.TLSRoutes, &out.TLSRoutes
+		*out = make([]IstioTLSRoute, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TCPRoutes != nil {
+		in, out := &in.TCPRoutes, &out.TCPRoutes
+		*out = make([]IstioTCPRoute, len(*in))
+		copy(*out, *in)
+	}
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Gateways != nil {
+		in, out := &in.Gateways, &out.Gateways
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+func (in *IstioTLSRoute) DeepCopyInto(out *IstioTLSRoute) {
+	*out = *in
+	if in.SNIHosts != nil {
+		in, out := &in.SNIHosts, &out.SNIHosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+func (in *DeploymentSchedule) DeepCopyInto(out *DeploymentSchedule) {
+	*out = *in
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]DeploymentWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Blackouts != nil {
+		in, out := &in.Blackouts, &out.Blackouts
+		*out = make([]BlackoutPeriod, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+func (in *DeploymentWindow) DeepCopyInto(out *DeploymentWindow) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+func (in *BlackoutPeriod) DeepCopyInto(out *BlackoutPeriod) {
+	*out = *in
+	in.Start.DeepCopyInto(&out.Start)
+	in.End.DeepCopyInto(&out.End)
 }
 
 func (in *DeployStrategy) DeepCopyInto(out *DeployStrategy) {
@@ -114,6 +563,23 @@ func (in *DeployStrategy) DeepCopyInto(out *DeployStrategy) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Match != nil {
+		in, out := &in.Match, &out.Match
+		*out = make([]RouteMatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BlueGreen != nil {
+		in, out := &in.BlueGreen, &out.BlueGreen
+		*out = new(BlueGreenStrategy)
+		**out = **in
+	}
+	if in.Adaptive != nil {
+		in, out := &in.Adaptive, &out.Adaptive
+		*out = new(AdaptiveStrategy)
+		**out = **in
+	}
 }
 
 func (in *DeployStep) DeepCopyInto(out *DeployStep) {
@@ -123,6 +589,76 @@ func (in *DeployStep) DeepCopyInto(out *DeployStep) {
 		*out = make([]MetricCheck, len(*in))
 		copy(*out, *in)
 	}
+	if in.Match != nil {
+		in, out := &in.Match, &out.Match
+		*out = make([]RouteMatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PreHooks != nil {
+		in, out := &in.PreHooks, &out.PreHooks
+		*out = make([]StepHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PostHooks != nil {
+		in, out := &in.PostHooks, &out.PostHooks
+		*out = make([]StepHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+func (in *ReplicaScaling) DeepCopyInto(out *ReplicaScaling) {
+	*out = *in
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+func (in *StepHook) DeepCopyInto(out *StepHook) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+func (in *RouteMatch) DeepCopyInto(out *RouteMatch) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make(map[string]StringMatch, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Cookie != nil {
+		in, out := &in.Cookie, &out.Cookie
+		*out = new(CookieMatch)
+		**out = **in
+	}
+	if in.QueryParams != nil {
+		in, out := &in.QueryParams, &out.QueryParams
+		*out = make(map[string]StringMatch, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SourceLabels != nil {
+		in, out := &in.SourceLabels, &out.SourceLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 func (in *CanaryDeploymentStatus) DeepCopyInto(out *CanaryDeploymentStatus) {
@@ -135,6 +671,26 @@ func (in *CanaryDeploymentStatus) DeepCopyInto(out *CanaryDeploymentStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ScaleDownTime != nil {
+		in, out := &in.ScaleDownTime, &out.ScaleDownTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]HookStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+func (in *HookStatus) DeepCopyInto(out *HookStatus) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 func (in *CanaryDeploymentList) DeepCopyObject() runtime.Object {
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/workload"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultScaleDownDelay = 30 * time.Second
+
+func previewServiceName(canary *deployv1alpha1.CanaryDeployment) string {
+	if bg := canary.Spec.Strategy.BlueGreen; bg != nil && bg.PreviewService != "" {
+		return bg.PreviewService
+	}
+	return workload.TargetName(canary) + "-preview"
+}
+
+func blueGreenScaleDownTime(canary *deployv1alpha1.CanaryDeployment) (*metav1.Time, error) {
+	delay := defaultScaleDownDelay
+	if bg := canary.Spec.Strategy.BlueGreen; bg != nil && bg.ScaleDownDelay != "" {
+		d, err := time.ParseDuration(bg.ScaleDownDelay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scaleDownDelay %q: %w", bg.ScaleDownDelay, err)
+		}
+		delay = d
+	}
+
+	t := metav1.NewTime(time.Now().Add(delay))
+	return &t, nil
+}
+
+// ensurePreview scales the new version to the stable replica count and
+// exposes it through the preview service, which selects canary pods only.
+func (c *CanaryController) ensurePreview(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	if kind := workload.Ref(canary).Kind; kind != workload.KindDeployment {
+		return fmt.Errorf("blue/green requires a Deployment target, got %s", kind)
+	}
+
+	deployments := c.clientset.AppsV1().Deployments(canary.Namespace)
+
+	stable, err := deployments.Get(ctx, workload.TargetName(canary), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get stable deployment: %w", err)
+	}
+	replicas := int32(1)
+	if stable.Spec.Replicas != nil {
+		replicas = *stable.Spec.Replicas
+	}
+
+	canaryDeployment, err := deployments.Get(ctx, workload.TargetName(canary)+"-canary", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get canary deployment: %w", err)
+	}
+	if canaryDeployment.Spec.Replicas == nil || *canaryDeployment.Spec.Replicas != replicas {
+		canaryDeployment.Spec.Replicas = &replicas
+		canaryDeployment, err = deployments.Update(ctx, canaryDeployment, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("scale canary deployment: %w", err)
+		}
+	}
+
+	if canaryDeployment.Spec.Selector == nil || len(canaryDeployment.Spec.Selector.MatchLabels) == 0 {
+		return fmt.Errorf("canary deployment %s has no matchLabels selector", canaryDeployment.Name)
+	}
+
+	services := c.clientset.CoreV1().Services(canary.Namespace)
+	stableService, err := services.Get(ctx, workload.TargetName(canary), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get stable service: %w", err)
+	}
+
+	ports := make([]corev1.ServicePort, 0, len(stableService.Spec.Ports))
+	for _, p := range stableService.Spec.Ports {
+		p.NodePort = 0
+		ports = append(ports, p)
+	}
+
+	name := previewServiceName(canary)
+	preview, err := services.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		preview = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: canary.Namespace,
+			},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeClusterIP,
+				Ports:    ports,
+				Selector: canaryDeployment.Spec.Selector.MatchLabels,
+			},
+		}
+		_, err = services.Create(ctx, preview, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("get preview service: %w", err)
+	}
+
+	preview.Spec.Ports = ports
+	preview.Spec.Selector = canaryDeployment.Spec.Selector.MatchLabels
+	_, err = services.Update(ctx, preview, metav1.UpdateOptions{})
+	return err
+}
+
+// scaleDownStableIfDue scales the previous version down once the blue/green
+// scale-down delay after cutover has passed.
+func (c *CanaryController) scaleDownStableIfDue(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	if canary.Status.ScaleDownTime == nil || time.Now().Before(canary.Status.ScaleDownTime.Time) {
+		return nil
+	}
+
+	deployments := c.clientset.AppsV1().Deployments(canary.Namespace)
+	stable, err := deployments.Get(ctx, workload.TargetName(canary), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get stable deployment: %w", err)
+	}
+
+	replicas := int32(0)
+	stable.Spec.Replicas = &replicas
+	if _, err := deployments.Update(ctx, stable, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("scale down stable deployment: %w", err)
+	}
+
+	err = c.clientset.CoreV1().Services(canary.Namespace).Delete(ctx, previewServiceName(canary), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete preview service: %w", err)
+	}
+
+	canary.Status.ScaleDownTime = nil
+	canary.Status.LastUpdateTime = metav1.Now()
+	return c.updateStatus(ctx, canary)
+}
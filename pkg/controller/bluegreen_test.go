@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func newBlueGreenCanary() *deployv1alpha1.CanaryDeployment {
+	return &deployv1alpha1.CanaryDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-canary",
+			Namespace: "default",
+		},
+		Spec: deployv1alpha1.CanaryDeploymentSpec{
+			TargetDeployment: "test-app",
+			Strategy: deployv1alpha1.DeployStrategy{
+				Type: "BlueGreen",
+				BlueGreen: &deployv1alpha1.BlueGreenStrategy{
+					ScaleDownDelay: "1m",
+				},
+			},
+		},
+	}
+}
+
+func TestEnsurePreview_ScalesCanaryAndCreatesService(t *testing.T) {
+	canary := newBlueGreenCanary()
+	stableService := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-app", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeNodePort,
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080), NodePort: 30080},
+			},
+		},
+	}
+
+	controller, clientset := newTestController(t, canary,
+		newTestDeployment("test-app", 5, map[string]string{"app": "test-app", "version": "v1"}),
+		newTestDeployment("test-app-canary", 1, map[string]string{"app": "test-app", "version": "v2"}),
+		stableService,
+	)
+
+	ctx := context.Background()
+	if err := controller.ensurePreview(ctx, canary); err != nil {
+		t.Fatalf("ensurePreview() error = %v", err)
+	}
+
+	canaryDeployment, err := clientset.AppsV1().Deployments("default").Get(ctx, "test-app-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get canary deployment: %v", err)
+	}
+	if *canaryDeployment.Spec.Replicas != 5 {
+		t.Errorf("canary replicas = %d, want 5", *canaryDeployment.Spec.Replicas)
+	}
+
+	preview, err := clientset.CoreV1().Services("default").Get(ctx, "test-app-preview", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get preview service: %v", err)
+	}
+	if preview.Spec.Selector["version"] != "v2" {
+		t.Errorf("preview selector = %v, want version=v2", preview.Spec.Selector)
+	}
+	if len(preview.Spec.Ports) != 1 || preview.Spec.Ports[0].NodePort != 0 {
+		t.Errorf("preview ports = %v, want cloned port without nodePort", preview.Spec.Ports)
+	}
+}
+
+func TestApplyStep_BlueGreenKeepsPreviewSize(t *testing.T) {
+	canary := newBlueGreenCanary()
+	canary.Spec.Scaling = &deployv1alpha1.ReplicaScaling{ScaleDownStable: true}
+
+	controller, clientset := newTestController(t, canary,
+		newTestDeployment("test-app", 5, map[string]string{"app": "test-app", "version": "v1"}),
+		newTestDeployment("test-app-canary", 5, map[string]string{"app": "test-app", "version": "v2"}),
+	)
+
+	ctx := context.Background()
+	if err := controller.applyStep(ctx, canary, 0, deployv1alpha1.DeployStep{Weight: 0, Pause: "10m"}); err != nil {
+		t.Fatalf("applyStep() error = %v", err)
+	}
+
+	for _, name := range []string{"test-app", "test-app-canary"} {
+		deployment, err := clientset.AppsV1().Deployments("default").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get deployment %s: %v", name, err)
+		}
+		if *deployment.Spec.Replicas != 5 {
+			t.Errorf("%s replicas = %d, want 5", name, *deployment.Spec.Replicas)
+		}
+	}
+}
+
+func TestScaleDownStableIfDue(t *testing.T) {
+	canary := newBlueGreenCanary()
+	canary.Status.Phase = "Completed"
+	past := metav1.NewTime(time.Now().Add(-time.Minute))
+	canary.Status.ScaleDownTime = &past
+
+	controller, clientset := newTestController(t, canary,
+		newTestDeployment("test-app", 5, map[string]string{"app": "test-app"}),
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test-app-preview", Namespace: "default"}},
+	)
+
+	ctx := context.Background()
+	if err := controller.scaleDownStableIfDue(ctx, canary); err != nil {
+		t.Fatalf("scaleDownStableIfDue() error = %v", err)
+	}
+
+	stable, err := clientset.AppsV1().Deployments("default").Get(ctx, "test-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get stable deployment: %v", err)
+	}
+	if *stable.Spec.Replicas != 0 {
+		t.Errorf("stable replicas = %d, want 0", *stable.Spec.Replicas)
+	}
+	if canary.Status.ScaleDownTime != nil {
+		t.Error("ScaleDownTime not cleared after scale down")
+	}
+	if _, err := clientset.CoreV1().Services("default").Get(ctx, "test-app-preview", metav1.GetOptions{}); err == nil {
+		t.Error("preview service not deleted")
+	}
+}
+
+func TestScaleDownStableIfDue_NotYet(t *testing.T) {
+	canary := newBlueGreenCanary()
+	future := metav1.NewTime(time.Now().Add(time.Hour))
+	canary.Status.ScaleDownTime = &future
+
+	controller, clientset := newTestController(t, canary,
+		newTestDeployment("test-app", 5, map[string]string{"app": "test-app"}),
+	)
+
+	ctx := context.Background()
+	if err := controller.scaleDownStableIfDue(ctx, canary); err != nil {
+		t.Fatalf("scaleDownStableIfDue() error = %v", err)
+	}
+
+	stable, _ := clientset.AppsV1().Deployments("default").Get(ctx, "test-app", metav1.GetOptions{})
+	if *stable.Spec.Replicas != 5 {
+		t.Errorf("stable replicas = %d, want 5 before delay elapses", *stable.Spec.Replicas)
+	}
+}
@@ -7,6 +7,10 @@ import (
 	"time"
 
 	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/strategy"
+	"github.com/codefarmer009/codedance/pkg/workload"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -34,17 +38,31 @@ var canaryGVR = schema.GroupVersionResource{
 	Resource: "canarydeployments",
 }
 
+var canaryPolicyGVR = schema.GroupVersionResource{
+	Group:    "deploy.codedance.io",
+	Version:  "v1alpha1",
+	Resource: "canarypolicies",
+}
+
+// clusterState holds the objects listed once per reconcile and shared by
+// every canary processed in it.
+type clusterState struct {
+	canaries []*deployv1alpha1.CanaryDeployment
+	policies []*deployv1alpha1.CanaryPolicy
+}
+
 type CanaryController struct {
-	clientset       *kubernetes.Clientset
+	clientset       kubernetes.Interface
 	dynamicClient   dynamic.Interface
 	trafficManager  TrafficManager
 	metricsAnalyzer MetricsAnalyzer
 	decisionEngine  DecisionEngine
 	rollbackManager RollbackManager
+	hookLogsURL     string
 }
 
 func NewCanaryController(
-	clientset *kubernetes.Clientset,
+	clientset kubernetes.Interface,
 	trafficManager TrafficManager,
 	metricsAnalyzer MetricsAnalyzer,
 	decisionEngine DecisionEngine,
@@ -88,8 +106,18 @@ func (c *CanaryController) reconcile(ctx context.Context) error {
 		return err
 	}
 
+	policies, err := c.listCanaryPolicies(reconcileCtx)
+	if err != nil {
+		return err
+	}
+	state := &clusterState{canaries: canaries, policies: policies}
+
+	if err := syncRoutes(reconcileCtx, c.trafficManager, canaries); err != nil {
+		fmt.Printf("sync traffic routes failed: %v\n", err)
+	}
+
 	for _, canary := range canaries {
-		if err := c.processCanary(reconcileCtx, canary); err != nil {
+		if err := c.processCanary(reconcileCtx, canary, state); err != nil {
 			fmt.Printf("process canary %s failed: %v\n", canary.Name, err)
 			continue
 		}
@@ -98,8 +126,9 @@ func (c *CanaryController) reconcile(ctx context.Context) error {
 	return nil
 }
 
-func (c *CanaryController) processCanary(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+func (c *CanaryController) processCanary(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, state *clusterState) error {
 	if canary.Status.Phase == "" {
+		meta.RemoveStatusCondition(&canary.Status.Conditions, ConditionAdmitted)
 		canary.Status.Phase = "Initializing"
 		canary.Status.CurrentStep = 0
 		canary.Status.CurrentWeight = 0
@@ -109,8 +138,38 @@ func (c *CanaryController) processCanary(ctx context.Context, canary *deployv1al
 		}
 	}
 
-	if len(canary.Spec.Strategy.Steps) == 0 {
-		return fmt.Errorf("no deployment steps defined in strategy")
+	if canary.Status.Phase == "Completed" || canary.Status.Phase == "Failed" {
+		return c.scaleDownStableIfDue(ctx, canary)
+	}
+
+	if reason := failedDependency(canary, state); reason != "" {
+		return c.rollbackManager.Rollback(ctx, canary, reason)
+	}
+
+	steps, err := strategy.ResolveSteps(canary.Spec.Strategy)
+	if err != nil {
+		return fmt.Errorf("resolve deployment steps: %w", err)
+	}
+
+	if canary.Status.Phase == "Initializing" || canary.Status.Phase == "Pending" {
+		if ready, err := c.checkDependencies(ctx, canary, state); err != nil || !ready {
+			return err
+		}
+		if open, err := c.checkDeploymentWindow(ctx, canary, state); err != nil || !open {
+			return err
+		}
+		if admitted, err := c.admitRollout(ctx, canary, state); err != nil || !admitted {
+			return err
+		}
+		return c.startDeployment(ctx, canary, steps)
+	}
+
+	if err := c.syncServices(ctx, canary, false); err != nil {
+		return fmt.Errorf("sync services: %w", err)
+	}
+
+	if synced, err := c.checkTrafficDrift(ctx, canary); err != nil || !synced {
+		return err
 	}
 
 	metrics, err := c.metricsAnalyzer.Collect(ctx, canary)
@@ -118,11 +177,26 @@ func (c *CanaryController) processCanary(ctx context.Context, canary *deployv1al
 		return fmt.Errorf("collect metrics: %w", err)
 	}
 
-	decision := c.decisionEngine.Evaluate(metrics, canary.Spec.Metrics)
+	decision := c.decisionEngine.Evaluate(metrics, canary.Spec.Metrics, currentStepContext(canary, steps))
 
 	switch decision.Action {
 	case ContinueAction:
-		return c.progressToNextStep(ctx, canary)
+		step := currentStep(canary, steps)
+		if !stepPauseElapsed(canary, step) {
+			return nil
+		}
+		if step != nil {
+			if done, err := c.runHooks(ctx, canary, canary.Status.CurrentStep, HookTypePost, step.PostHooks); err != nil || !done {
+				return err
+			}
+		}
+		if open, err := c.checkDeploymentWindow(ctx, canary, state); err != nil || !open {
+			return err
+		}
+		if canary.Spec.Strategy.Type == strategy.TypeAdaptive {
+			return c.progressAdaptive(ctx, canary, steps, decision, metrics)
+		}
+		return c.progressToNextStep(ctx, canary, steps)
 	case PauseAction:
 		return c.pauseDeployment(ctx, canary, decision.Reason)
 	case RollbackAction:
@@ -132,9 +206,9 @@ func (c *CanaryController) processCanary(ctx context.Context, canary *deployv1al
 	}
 }
 
-func (c *CanaryController) progressToNextStep(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+func (c *CanaryController) progressToNextStep(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, steps []deployv1alpha1.DeployStep) error {
 	currentStep := canary.Status.CurrentStep
-	totalSteps := len(canary.Spec.Strategy.Steps)
+	totalSteps := len(steps)
 
 	if totalSteps == 0 {
 		return fmt.Errorf("no deployment steps defined")
@@ -149,19 +223,171 @@ func (c *CanaryController) progressToNextStep(ctx context.Context, canary *deplo
 		return fmt.Errorf("next step %d exceeds total steps %d", nextStep, totalSteps)
 	}
 
-	weight := canary.Spec.Strategy.Steps[nextStep].Weight
+	return c.applyStep(ctx, canary, nextStep, steps[nextStep])
+}
 
-	if err := c.trafficManager.UpdateWeight(ctx, canary, weight); err != nil {
+// progressAdaptive sizes the next step from the health score and request
+// rate. The steps of an Adaptive strategy hold only the generated first
+// step, whose pause every later step keeps.
+func (c *CanaryController) progressAdaptive(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, steps []deployv1alpha1.DeployStep, decision Decision, metrics *HealthMetrics) error {
+	if canary.Status.CurrentWeight >= 100 {
+		return c.finalizeDeployment(ctx, canary)
+	}
+
+	adaptive := strategy.NewAdaptiveStrategyFromSpec(canary.Spec.Strategy)
+	step := steps[len(steps)-1]
+	step.Weight = adaptive.NextWeight(canary.Status.CurrentWeight, decision.Score, metrics.RequestRate)
+
+	return c.applyStep(ctx, canary, canary.Status.CurrentStep+1, step)
+}
+
+func (c *CanaryController) startDeployment(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, steps []deployv1alpha1.DeployStep) error {
+	if canary.Spec.Strategy.Type == strategy.TypeBlueGreen {
+		if err := c.ensurePreview(ctx, canary); err != nil {
+			return fmt.Errorf("prepare blue/green preview: %w", err)
+		}
+	}
+
+	// The route may refer to the managed Services, so they are created first.
+	if err := c.syncServices(ctx, canary, false); err != nil {
+		return fmt.Errorf("sync services: %w", err)
+	}
+
+	if err := c.trafficManager.CreateCanaryRoute(ctx, canary); err != nil {
+		return fmt.Errorf("create canary route: %w", err)
+	}
+
+	return c.applyStep(ctx, canary, 0, steps[0])
+}
+
+func (c *CanaryController) applyStep(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, index int, step deployv1alpha1.DeployStep) error {
+	if done, err := c.runHooks(ctx, canary, index, HookTypePre, step.PreHooks); err != nil || !done {
+		return err
+	}
+
+	// Blue/green runs the new version at full size from the start, so it is
+	// not sized by weight.
+	if canary.Spec.Strategy.Type != strategy.TypeBlueGreen {
+		target, err := workload.New(c.clientset, canary)
+		if err != nil {
+			return err
+		}
+		if err := target.SetWeight(ctx, step.Weight, step.Replicas); err != nil {
+			return fmt.Errorf("update workload weight: %w", err)
+		}
+	}
+
+	if err := c.syncServices(ctx, canary, false); err != nil {
+		return fmt.Errorf("sync services: %w", err)
+	}
+
+	if err := c.trafficManager.UpdateWeight(ctx, canary, step.Weight); err != nil {
 		return fmt.Errorf("update traffic weight: %w", err)
 	}
 
-	canary.Status.CurrentStep = nextStep
-	canary.Status.CurrentWeight = weight
+	matches := step.Match
+	if len(matches) == 0 {
+		matches = canary.Spec.Strategy.Match
+	}
+	if err := updateMatch(ctx, c.trafficManager, canary, matches); err != nil {
+		return fmt.Errorf("update request match routing: %w", err)
+	}
+
+	if err := updateMirror(ctx, c.trafficManager, canary, step.MirrorPercent); err != nil {
+		return fmt.Errorf("update traffic mirroring: %w", err)
+	}
+
+	canary.Status.Phase = "Progressing"
+	canary.Status.Reason = ""
+	if meta.FindStatusCondition(canary.Status.Conditions, ConditionDeploymentWindow) != nil {
+		setCondition(canary, ConditionDeploymentWindow, metav1.ConditionTrue, "InsideWindow", "")
+	}
+	if meta.FindStatusCondition(canary.Status.Conditions, ConditionDependencies) != nil {
+		setCondition(canary, ConditionDependencies, metav1.ConditionTrue, "DependenciesReady", "")
+	}
+	canary.Status.CurrentStep = index
+	canary.Status.CurrentWeight = step.Weight
 	canary.Status.LastUpdateTime = metav1.Now()
 
 	return c.updateStatus(ctx, canary)
 }
 
+func updateMatch(ctx context.Context, trafficManager TrafficManager, canary *deployv1alpha1.CanaryDeployment, matches []deployv1alpha1.RouteMatch) error {
+	router, ok := trafficManager.(RequestMatchRouter)
+	if !ok {
+		if len(matches) > 0 {
+			return fmt.Errorf("traffic manager does not support request match routing")
+		}
+		return nil
+	}
+
+	return router.UpdateMatch(ctx, canary, matches)
+}
+
+func updateMirror(ctx context.Context, trafficManager TrafficManager, canary *deployv1alpha1.CanaryDeployment, percent int) error {
+	mirror, ok := trafficManager.(TrafficMirror)
+	if !ok {
+		if percent > 0 {
+			return fmt.Errorf("traffic manager does not support traffic mirroring")
+		}
+		return nil
+	}
+
+	return mirror.UpdateMirror(ctx, canary, percent)
+}
+
+func cleanupRoute(ctx context.Context, trafficManager TrafficManager, canary *deployv1alpha1.CanaryDeployment) error {
+	cleaner, ok := trafficManager.(RouteCleaner)
+	if !ok {
+		return nil
+	}
+
+	return cleaner.CleanupCanaryRoute(ctx, canary)
+}
+
+func syncRoutes(ctx context.Context, trafficManager TrafficManager, canaries []*deployv1alpha1.CanaryDeployment) error {
+	syncer, ok := trafficManager.(RouteSyncer)
+	if !ok {
+		return nil
+	}
+
+	return syncer.SyncRoutes(ctx, canaries)
+}
+
+// currentStep returns the step the canary is on. Adaptive rollouts run past
+// the resolved steps, so their current step is derived from the last one.
+func currentStep(canary *deployv1alpha1.CanaryDeployment, steps []deployv1alpha1.DeployStep) *deployv1alpha1.DeployStep {
+	index := canary.Status.CurrentStep
+	if index >= 0 && index < len(steps) {
+		return &steps[index]
+	}
+	if canary.Spec.Strategy.Type == strategy.TypeAdaptive && len(steps) > 0 {
+		step := steps[len(steps)-1]
+		step.Weight = canary.Status.CurrentWeight
+		return &step
+	}
+	return nil
+}
+
+func currentStepContext(canary *deployv1alpha1.CanaryDeployment, steps []deployv1alpha1.DeployStep) StepContext {
+	return StepContext{Index: canary.Status.CurrentStep, Step: currentStep(canary, steps)}
+}
+
+// stepPauseElapsed reports whether the canary has stayed on its current step
+// for at least the step's pause duration.
+func stepPauseElapsed(canary *deployv1alpha1.CanaryDeployment, step *deployv1alpha1.DeployStep) bool {
+	if step == nil || step.Pause == "" {
+		return true
+	}
+
+	pause, err := time.ParseDuration(step.Pause)
+	if err != nil {
+		return true
+	}
+
+	return time.Since(canary.Status.LastUpdateTime.Time) >= pause
+}
+
 func (c *CanaryController) pauseDeployment(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, reason string) error {
 	canary.Status.Phase = "Paused"
 	canary.Status.Reason = reason
@@ -169,8 +395,42 @@ func (c *CanaryController) pauseDeployment(ctx context.Context, canary *deployv1
 }
 
 func (c *CanaryController) finalizeDeployment(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	if err := c.syncServices(ctx, canary, true); err != nil {
+		return fmt.Errorf("promote stable service: %w", err)
+	}
+
+	// The routes keep sending all traffic to the new version. Unlike after a
+	// rollback they are not handed back to the target Service, which still
+	// selects the previous version until it is scaled down or replaced.
+	if err := c.trafficManager.UpdateWeight(ctx, canary, 100); err != nil {
+		return fmt.Errorf("update traffic weight: %w", err)
+	}
+	if err := updateMatch(ctx, c.trafficManager, canary, nil); err != nil {
+		return fmt.Errorf("remove request match routing: %w", err)
+	}
+	if err := updateMirror(ctx, c.trafficManager, canary, 0); err != nil {
+		return fmt.Errorf("stop traffic mirroring: %w", err)
+	}
+
+	target, err := workload.New(c.clientset, canary)
+	if err != nil {
+		return err
+	}
+	if err := target.Complete(ctx); err != nil {
+		return fmt.Errorf("complete workload rollout: %w", err)
+	}
+
 	canary.Status.Phase = "Completed"
 	canary.Status.CurrentWeight = 100
+
+	if canary.Spec.Strategy.Type == strategy.TypeBlueGreen {
+		scaleDownTime, err := blueGreenScaleDownTime(canary)
+		if err != nil {
+			return err
+		}
+		canary.Status.ScaleDownTime = scaleDownTime
+	}
+
 	return c.updateStatus(ctx, canary)
 }
 
@@ -197,6 +457,49 @@ func (c *CanaryController) listCanaryDeployments(ctx context.Context) ([]*deploy
 	return canaries, nil
 }
 
+func (c *CanaryController) listCanaryPolicies(ctx context.Context) ([]*deployv1alpha1.CanaryPolicy, error) {
+	if c.dynamicClient == nil {
+		return nil, fmt.Errorf("dynamic client not initialized")
+	}
+
+	list, err := c.dynamicClient.Resource(canaryPolicyGVR).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list canary policies: %w", err)
+	}
+
+	policies := make([]*deployv1alpha1.CanaryPolicy, 0, len(list.Items))
+	for _, item := range list.Items {
+		policy := &deployv1alpha1.CanaryPolicy{}
+		if err := fromUnstructured(&item, policy); err != nil {
+			fmt.Printf("failed to convert canary policy %s: %v\n", item.GetName(), err)
+			continue
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// setCondition sets a status condition and reports whether it changed.
+func setCondition(canary *deployv1alpha1.CanaryDeployment, conditionType string, status metav1.ConditionStatus, reason, message string) bool {
+	existing := meta.FindStatusCondition(canary.Status.Conditions, conditionType)
+	if existing != nil && existing.Status == status && existing.Reason == reason && existing.Message == message {
+		return false
+	}
+
+	meta.SetStatusCondition(&canary.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: canary.Generation,
+	})
+	return true
+}
+
 func (c *CanaryController) updateStatus(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
 	if c.dynamicClient == nil {
 		return fmt.Errorf("dynamic client not initialized")
@@ -219,11 +522,15 @@ func (c *CanaryController) updateStatus(ctx context.Context, canary *deployv1alp
 }
 
 func convertUnstructuredToCanary(u *unstructured.Unstructured, canary *deployv1alpha1.CanaryDeployment) error {
+	return fromUnstructured(u, canary)
+}
+
+func fromUnstructured(u *unstructured.Unstructured, obj interface{}) error {
 	data, err := u.MarshalJSON()
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(data, canary)
+	return json.Unmarshal(data, obj)
 }
 
 func convertCanaryToUnstructured(canary *deployv1alpha1.CanaryDeployment) (*unstructured.Unstructured, error) {
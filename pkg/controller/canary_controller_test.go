@@ -0,0 +1,377 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/strategy"
+	"github.com/codefarmer009/codedance/pkg/traffic"
+	networkingv1beta1 "istio.io/api/networking/v1beta1"
+	"istio.io/client-go/pkg/apis/networking/v1beta1"
+	istiofake "istio.io/client-go/pkg/clientset/versioned/fake"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestController(t *testing.T, canary *deployv1alpha1.CanaryDeployment, objects ...runtime.Object) (*CanaryController, *fake.Clientset) {
+	t.Helper()
+
+	clientset := fake.NewSimpleClientset(objects...)
+	controller := NewCanaryController(clientset, &mockTrafficManager{}, nil, NewDefaultDecisionEngine(), nil)
+
+	canary.TypeMeta = metav1.TypeMeta{APIVersion: "deploy.codedance.io/v1alpha1", Kind: "CanaryDeployment"}
+	u, err := convertCanaryToUnstructured(canary)
+	if err != nil {
+		t.Fatalf("convert canary: %v", err)
+	}
+	controller.SetDynamicClient(dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			canaryGVR:       "CanaryDeploymentList",
+			canaryPolicyGVR: "CanaryPolicyList",
+		},
+		u,
+	))
+
+	return controller, clientset
+}
+
+func newTestDeployment(name string, replicas int32, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+		},
+	}
+}
+
+type mockMatchTrafficManager struct {
+	mockTrafficManager
+	matchCalled bool
+	lastMatches []deployv1alpha1.RouteMatch
+}
+
+func (m *mockMatchTrafficManager) UpdateMatch(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, matches []deployv1alpha1.RouteMatch) error {
+	m.matchCalled = true
+	m.lastMatches = matches
+	return nil
+}
+
+func newTestCanary() *deployv1alpha1.CanaryDeployment {
+	return &deployv1alpha1.CanaryDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-canary",
+			Namespace: "default",
+		},
+		Spec: deployv1alpha1.CanaryDeploymentSpec{
+			TargetDeployment: "test-app",
+		},
+		Status: deployv1alpha1.CanaryDeploymentStatus{
+			Phase: "Initializing",
+		},
+	}
+}
+
+func TestStartDeployment_AppliesFirstStep(t *testing.T) {
+	canary := newTestCanary()
+	controller, _ := newTestController(t, canary)
+	tm := &mockMatchTrafficManager{}
+	controller.trafficManager = tm
+
+	steps := []deployv1alpha1.DeployStep{
+		{
+			Weight: 0,
+			Pause:  "1h",
+			Match: []deployv1alpha1.RouteMatch{
+				{Headers: map[string]deployv1alpha1.StringMatch{"x-employee": {Exact: "true"}}},
+			},
+		},
+		{Weight: 100, Pause: "0"},
+	}
+
+	if err := controller.startDeployment(context.Background(), canary, steps); err != nil {
+		t.Fatalf("startDeployment() error = %v", err)
+	}
+
+	if !tm.updateWeightCalled || tm.lastWeight != 0 {
+		t.Errorf("UpdateWeight called = %v with %d, want 0", tm.updateWeightCalled, tm.lastWeight)
+	}
+	if !tm.matchCalled || len(tm.lastMatches) != 1 {
+		t.Errorf("UpdateMatch called = %v with %v, want first step match", tm.matchCalled, tm.lastMatches)
+	}
+	if canary.Status.Phase != "Progressing" {
+		t.Errorf("Phase = %s, want Progressing", canary.Status.Phase)
+	}
+}
+
+func TestStartDeployment_CreatesRouteBeforeFirstStep(t *testing.T) {
+	canary := newTestCanary()
+	controller, _ := newTestController(t, canary)
+	tm := &mockTrafficManager{}
+	controller.trafficManager = tm
+
+	steps := []deployv1alpha1.DeployStep{{Weight: 10, Pause: "1h"}}
+	if err := controller.startDeployment(context.Background(), canary, steps); err != nil {
+		t.Fatalf("startDeployment() error = %v", err)
+	}
+
+	want := []string{"CreateCanaryRoute", "UpdateWeight"}
+	if !reflect.DeepEqual(tm.calls, want) {
+		t.Errorf("traffic manager calls = %v, want %v", tm.calls, want)
+	}
+}
+
+func TestStartDeployment_CreateRouteError(t *testing.T) {
+	canary := newTestCanary()
+	controller, _ := newTestController(t, canary)
+	tm := &mockTrafficManager{createRouteError: true}
+	controller.trafficManager = tm
+
+	steps := []deployv1alpha1.DeployStep{{Weight: 10, Pause: "1h"}}
+	if err := controller.startDeployment(context.Background(), canary, steps); err == nil {
+		t.Fatal("startDeployment() error = nil, want error")
+	}
+	if tm.updateWeightCalled {
+		t.Error("UpdateWeight called after CreateCanaryRoute failed")
+	}
+	if canary.Status.Phase != "Initializing" {
+		t.Errorf("Phase = %s, want Initializing", canary.Status.Phase)
+	}
+}
+
+func TestApplyStep_StrategyMatchDefault(t *testing.T) {
+	canary := newTestCanary()
+	canary.Spec.Strategy.Match = []deployv1alpha1.RouteMatch{
+		{Cookie: &deployv1alpha1.CookieMatch{Name: "qa-session"}},
+	}
+	controller, _ := newTestController(t, canary)
+	tm := &mockMatchTrafficManager{}
+	controller.trafficManager = tm
+	ctx := context.Background()
+
+	if err := controller.applyStep(ctx, canary, 0, deployv1alpha1.DeployStep{Weight: 0}); err != nil {
+		t.Fatalf("applyStep() error = %v", err)
+	}
+	if len(tm.lastMatches) != 1 || tm.lastMatches[0].Cookie == nil {
+		t.Errorf("UpdateMatch called with %v, want the strategy match", tm.lastMatches)
+	}
+
+	override := []deployv1alpha1.RouteMatch{{Headers: map[string]deployv1alpha1.StringMatch{"x-qa": {}}}}
+	if err := controller.applyStep(ctx, canary, 1, deployv1alpha1.DeployStep{Weight: 10, Match: override}); err != nil {
+		t.Fatalf("applyStep() error = %v", err)
+	}
+	if len(tm.lastMatches) != 1 || tm.lastMatches[0].Cookie != nil {
+		t.Errorf("UpdateMatch called with %v, want the step match", tm.lastMatches)
+	}
+}
+
+func TestApplyStep_MatchUnsupported(t *testing.T) {
+	canary := newTestCanary()
+	controller, _ := newTestController(t, canary)
+
+	steps := []deployv1alpha1.DeployStep{
+		{
+			Weight: 0,
+			Match: []deployv1alpha1.RouteMatch{
+				{Cookie: &deployv1alpha1.CookieMatch{Name: "beta"}},
+			},
+		},
+	}
+
+	if err := controller.applyStep(context.Background(), canary, 0, steps[0]); err == nil {
+		t.Error("applyStep() error = nil, want error for unsupported match routing")
+	}
+}
+
+func TestProgressAdaptive(t *testing.T) {
+	canary := newTestCanary()
+	canary.Spec.Strategy = deployv1alpha1.DeployStrategy{
+		Type:     "Adaptive",
+		Adaptive: &deployv1alpha1.AdaptiveStrategy{MinStepSize: 5, MaxStepSize: 45, TargetRequestRate: 10},
+	}
+	canary.Status.Phase = "Progressing"
+	canary.Status.CurrentStep = 2
+	canary.Status.CurrentWeight = 20
+
+	controller, _ := newTestController(t, canary)
+	tm := &mockTrafficManager{}
+	controller.trafficManager = tm
+
+	steps := []deployv1alpha1.DeployStep{{Weight: 5, Pause: "10m"}}
+	decision := Decision{Action: ContinueAction, Score: 100}
+	metrics := &HealthMetrics{RequestRate: 50}
+
+	if err := controller.progressAdaptive(context.Background(), canary, steps, decision, metrics); err != nil {
+		t.Fatalf("progressAdaptive() error = %v", err)
+	}
+	if tm.lastWeight != 65 {
+		t.Errorf("UpdateWeight() weight = %d, want 65", tm.lastWeight)
+	}
+	if canary.Status.CurrentStep != 3 || canary.Status.CurrentWeight != 65 {
+		t.Errorf("Status step/weight = %d/%d, want 3/65", canary.Status.CurrentStep, canary.Status.CurrentWeight)
+	}
+
+	step := currentStep(canary, steps)
+	if step == nil || step.Weight != 65 || step.Pause != "10m" {
+		t.Errorf("currentStep() = %+v, want weight 65 pause 10m", step)
+	}
+}
+
+// startWithProvider runs the first reconcile of a new canary against a real
+// traffic provider, in a cluster holding only the target Deployment unless
+// objects are given.
+func startWithProvider(t *testing.T, canary *deployv1alpha1.CanaryDeployment, provider string, manager TrafficManager, objects ...runtime.Object) {
+	t.Helper()
+	canary.Status.Phase = ""
+	canary.Spec.Strategy = deployv1alpha1.DeployStrategy{
+		Type:  strategy.TypeManual,
+		Steps: []deployv1alpha1.DeployStep{{Weight: 10, Pause: "1h"}, {Weight: 100, Pause: "0"}},
+	}
+	if len(objects) == 0 {
+		objects = []runtime.Object{newTestDeployment("test-app", 4, map[string]string{"app": "test-app"})}
+	}
+	controller, _ := newTestController(t, canary, objects...)
+	registry := NewTrafficProviderRegistry(provider)
+	registry.Register(provider, func() (TrafficManager, error) { return manager, nil })
+	controller.trafficManager = registry
+
+	state := &clusterState{canaries: []*deployv1alpha1.CanaryDeployment{canary}}
+	if err := controller.processCanary(context.Background(), canary, state); err != nil {
+		t.Fatalf("processCanary() error = %v", err)
+	}
+	if canary.Status.Phase != "Progressing" || canary.Status.CurrentWeight != 10 {
+		t.Errorf("Status phase/weight = %s/%d, want Progressing/10", canary.Status.Phase, canary.Status.CurrentWeight)
+	}
+}
+
+func TestProcessCanary_GatewayAPIFromEmptyCluster(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvr: "HTTPRouteList",
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "grpcroutes"}: "GRPCRouteList",
+	})
+
+	startWithProvider(t, newTestCanary(), ProviderGatewayAPI, traffic.NewGatewayAPITrafficManager(client))
+
+	route, err := client.Resource(gvr).Namespace("default").Get(context.Background(), "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get HTTPRoute: %v", err)
+	}
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	weights := map[string]int64{}
+	for _, r := range rules[0].(map[string]interface{})["backendRefs"].([]interface{}) {
+		ref := r.(map[string]interface{})
+		weights[ref["name"].(string)] = ref["weight"].(int64)
+	}
+	if weights["test-app"] != 90 || weights["test-app-canary"] != 10 {
+		t.Errorf("backendRef weights = %v, want test-app 90 and test-app-canary 10", weights)
+	}
+}
+
+func TestProcessCanary_SMIFromEmptyCluster(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "split.smi-spec.io", Version: "v1alpha2", Resource: "trafficsplits"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvr: "TrafficSplitList",
+	})
+
+	startWithProvider(t, newTestCanary(), ProviderSMI, traffic.NewSMITrafficManager(client))
+
+	split, err := client.Resource(gvr).Namespace("default").Get(context.Background(), "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get TrafficSplit: %v", err)
+	}
+	backends, _, _ := unstructured.NestedSlice(split.Object, "spec", "backends")
+	weights := map[string]int64{}
+	for _, b := range backends {
+		backend := b.(map[string]interface{})
+		weights[backend["service"].(string)] = backend["weight"].(int64)
+	}
+	if weights["test-app"] != 90 || weights["test-app-canary"] != 10 {
+		t.Errorf("backend weights = %v, want test-app 90 and test-app-canary 10", weights)
+	}
+}
+
+func TestFinalizeDeployment_IstioKeepsTrafficOnNewVersion(t *testing.T) {
+	versioned := func(name, version string) *appsv1.Deployment {
+		deployment := newTestDeployment(name, 2, map[string]string{"app": "test-app", "version": version})
+		deployment.Spec.Template.Labels = map[string]string{"app": "test-app", "version": version}
+		return deployment
+	}
+	canary := newTestCanary()
+	canary.Status.Phase = "Progressing"
+	canary.Status.CurrentStep = 1
+	canary.Status.CurrentWeight = 100
+	controller, clientset := newTestController(t, canary, versioned("test-app", "v1"), versioned("test-app-canary", "v2"))
+
+	istioClient := istiofake.NewSimpleClientset(&v1beta1.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-canary", Namespace: "default"},
+		Spec: networkingv1beta1.VirtualService{
+			Hosts: []string{"test-app"},
+			Http: []*networkingv1beta1.HTTPRoute{{
+				Route: []*networkingv1beta1.HTTPRouteDestination{
+					{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "stable"}, Weight: 100},
+					{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "canary"}},
+				},
+			}},
+		},
+	})
+	manager := traffic.NewIstioTrafficManager(istioClient, clientset)
+	controller.trafficManager = manager
+
+	ctx := context.Background()
+	if err := manager.UpdateWeight(ctx, canary, 100); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+	err := manager.UpdateMatch(ctx, canary, []deployv1alpha1.RouteMatch{
+		{Headers: map[string]deployv1alpha1.StringMatch{"x-beta": {Exact: "1"}}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateMatch() error = %v", err)
+	}
+
+	if err := controller.finalizeDeployment(ctx, canary); err != nil {
+		t.Fatalf("finalizeDeployment() error = %v", err)
+	}
+	if canary.Status.Phase != "Completed" {
+		t.Errorf("Status.Phase = %s, want Completed", canary.Status.Phase)
+	}
+
+	vs, err := istioClient.NetworkingV1beta1().VirtualServices("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get virtual service: %v", err)
+	}
+	if len(vs.Spec.Http) != 1 {
+		t.Fatalf("http routes = %d, want the weighted route only", len(vs.Spec.Http))
+	}
+	weights := map[string]int32{}
+	for _, destination := range vs.Spec.Http[0].Route {
+		weights[destination.Destination.Subset] = destination.Weight
+	}
+	if weights["canary"] != 100 || weights["stable"] != 0 {
+		t.Errorf("subset weights = %v, want all traffic on canary", weights)
+	}
+
+	dr, err := istioClient.NetworkingV1beta1().DestinationRules("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get destination rule: %v", err)
+	}
+	for _, subset := range dr.Spec.Subsets {
+		if subset.Name == "canary" && subset.Labels["version"] != "v2" {
+			t.Errorf("canary subset labels = %v, want version v2", subset.Labels)
+		}
+	}
+	if len(dr.Spec.Subsets) != 2 {
+		t.Errorf("destination rule subsets = %d, want stable and canary kept", len(dr.Spec.Subsets))
+	}
+}
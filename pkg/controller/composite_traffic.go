@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+// CompositeTrafficManager shifts traffic on several providers together, for
+// services reachable through more than one path, such as an nginx Ingress
+// for north-south and an Istio mesh for east-west traffic. Providers are
+// updated in the order they were added.
+type CompositeTrafficManager struct {
+	providers []string
+	managers  []TrafficManager
+}
+
+func NewCompositeTrafficManager() *CompositeTrafficManager {
+	return &CompositeTrafficManager{}
+}
+
+func (m *CompositeTrafficManager) Add(provider string, manager TrafficManager) {
+	m.providers = append(m.providers, provider)
+	m.managers = append(m.managers, manager)
+}
+
+// UpdateWeight updates every provider in order. When one fails, the providers
+// already updated are set back to status.currentWeight, the weight all paths
+// carried before, so they never serve different splits.
+func (m *CompositeTrafficManager) UpdateWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) error {
+	for i, manager := range m.managers {
+		if err := manager.UpdateWeight(ctx, canary, weight); err != nil {
+			return m.revertWeight(ctx, canary, i, fmt.Errorf("%s: %w", m.providers[i], err))
+		}
+	}
+	return nil
+}
+
+// revertWeight reverts the first updated providers in reverse order and
+// returns cause joined with any revert failures.
+func (m *CompositeTrafficManager) revertWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, updated int, cause error) error {
+	errs := []error{cause}
+	for i := updated - 1; i >= 0; i-- {
+		if err := m.managers[i].UpdateWeight(ctx, canary, canary.Status.CurrentWeight); err != nil {
+			errs = append(errs, fmt.Errorf("revert %s to weight %d: %w", m.providers[i], canary.Status.CurrentWeight, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *CompositeTrafficManager) CreateCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	for i, manager := range m.managers {
+		if err := manager.CreateCanaryRoute(ctx, canary); err != nil {
+			return fmt.Errorf("%s: %w", m.providers[i], err)
+		}
+	}
+	return nil
+}
+
+// VerifyWeight returns the first diverging weight of any provider.
+func (m *CompositeTrafficManager) VerifyWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) (int, error) {
+	for i, manager := range m.managers {
+		observed, err := manager.VerifyWeight(ctx, canary, weight)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", m.providers[i], err)
+		}
+		if observed != weight {
+			return observed, nil
+		}
+	}
+	return weight, nil
+}
+
+func (m *CompositeTrafficManager) UpdateMatch(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, matches []deployv1alpha1.RouteMatch) error {
+	for i, manager := range m.managers {
+		if err := updateMatch(ctx, manager, canary, matches); err != nil {
+			return fmt.Errorf("%s: %w", m.providers[i], err)
+		}
+	}
+	return nil
+}
+
+func (m *CompositeTrafficManager) UpdateMirror(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, percent int) error {
+	for i, manager := range m.managers {
+		if err := updateMirror(ctx, manager, canary, percent); err != nil {
+			return fmt.Errorf("%s: %w", m.providers[i], err)
+		}
+	}
+	return nil
+}
+
+func (m *CompositeTrafficManager) CleanupCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	for i, manager := range m.managers {
+		if err := cleanupRoute(ctx, manager, canary); err != nil {
+			return fmt.Errorf("%s: %w", m.providers[i], err)
+		}
+	}
+	return nil
+}
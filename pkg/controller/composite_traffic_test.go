@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+func TestCompositeTrafficManager_UpdateWeight(t *testing.T) {
+	nginx := &mockTrafficManager{}
+	istio := &mockTrafficManager{}
+	composite := NewCompositeTrafficManager()
+	composite.Add(ProviderNginx, nginx)
+	composite.Add(ProviderIstio, istio)
+	canary := newTestCanary()
+	canary.Status.CurrentWeight = 20
+
+	if err := composite.UpdateWeight(context.Background(), canary, 40); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+	if nginx.lastWeight != 40 || istio.lastWeight != 40 {
+		t.Errorf("weights = %d/%d, want 40/40", nginx.lastWeight, istio.lastWeight)
+	}
+}
+
+func TestCompositeTrafficManager_UpdateWeightRevertsOnFailure(t *testing.T) {
+	nginx := &mockTrafficManager{}
+	istio := &mockTrafficManager{shouldError: true}
+	smi := &mockTrafficManager{}
+	composite := NewCompositeTrafficManager()
+	composite.Add(ProviderNginx, nginx)
+	composite.Add(ProviderIstio, istio)
+	composite.Add(ProviderSMI, smi)
+	canary := newTestCanary()
+	canary.Status.CurrentWeight = 20
+
+	if err := composite.UpdateWeight(context.Background(), canary, 40); err == nil {
+		t.Fatal("UpdateWeight() error = nil, want error")
+	}
+	if nginx.lastWeight != 20 {
+		t.Errorf("nginx weight = %d, want reverted to 20", nginx.lastWeight)
+	}
+	if smi.updateWeightCalled {
+		t.Error("providers after the failed one were updated")
+	}
+}
+
+func TestCompositeTrafficManager_VerifyWeight(t *testing.T) {
+	composite := NewCompositeTrafficManager()
+	composite.Add(ProviderNginx, &mockTrafficManager{})
+	composite.Add(ProviderIstio, &mockTrafficManager{drifted: true, observedWeight: 5})
+
+	got, err := composite.VerifyWeight(context.Background(), newTestCanary(), 20)
+	if err != nil || got != 5 {
+		t.Errorf("VerifyWeight() = %d, %v, want 5", got, err)
+	}
+}
+
+func TestTrafficProviderRegistry_ManagerForProviders(t *testing.T) {
+	nginx := &mockTrafficManager{}
+	istio := &mockTrafficManager{}
+	registry := NewTrafficProviderRegistry(ProviderNginx)
+	registry.Register(ProviderNginx, func() (TrafficManager, error) { return nginx, nil })
+	registry.Register(ProviderIstio, func() (TrafficManager, error) { return istio, nil })
+
+	canary := newTestCanary()
+	canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{Providers: []string{ProviderNginx, ProviderIstio}}
+	if err := registry.UpdateWeight(context.Background(), canary, 30); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+	if nginx.lastWeight != 30 || istio.lastWeight != 30 {
+		t.Errorf("weights = %d/%d, want 30/30", nginx.lastWeight, istio.lastWeight)
+	}
+
+	canary.Spec.TrafficRouting.Providers = []string{ProviderNginx, "unknown"}
+	if _, err := registry.ManagerFor(canary); err == nil {
+		t.Error("ManagerFor() error = nil, want error for an unknown provider")
+	}
+}
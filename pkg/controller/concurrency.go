@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	QueueOrderFIFO     = "FIFO"
+	QueueOrderPriority = "Priority"
+)
+
+// ConditionAdmitted marks a canary that has passed admission. It holds its
+// slot from then on, even while it is still starting, for example waiting
+// on the pre hooks of its first step.
+const ConditionAdmitted = "Admitted"
+
+// admitRollout reports whether the canary may start under the concurrency
+// limits of every CanaryPolicy. When it may not, it is queued in the Pending
+// phase with its place in the queue recorded in the status.
+func (c *CanaryController) admitRollout(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, state *clusterState) (bool, error) {
+	if state == nil || admitted(canary) {
+		return true, nil
+	}
+
+	reason := queueReason(canary, state)
+	if reason == "" {
+		setCondition(canary, ConditionAdmitted, metav1.ConditionTrue, "SlotAvailable", "")
+		return true, c.updateStatus(ctx, canary)
+	}
+	if canary.Status.Phase == "Pending" && canary.Status.Reason == reason {
+		return false, nil
+	}
+
+	canary.Status.Phase = "Pending"
+	canary.Status.Reason = reason
+	canary.Status.LastUpdateTime = metav1.Now()
+	return false, c.updateStatus(ctx, canary)
+}
+
+func queueReason(canary *deployv1alpha1.CanaryDeployment, state *clusterState) string {
+	for _, policy := range state.policies {
+		limit := policy.Spec.Concurrency
+		if limit == nil {
+			continue
+		}
+
+		if limit.MaxProgressing > 0 {
+			if reason := checkLimit(canary, state.canaries, limit.MaxProgressing, limit.Order, "集群", func(*deployv1alpha1.CanaryDeployment) bool {
+				return true
+			}); reason != "" {
+				return reason
+			}
+		}
+
+		if limit.MaxProgressingPerNamespace > 0 {
+			scope := fmt.Sprintf("命名空间 %s ", canary.Namespace)
+			if reason := checkLimit(canary, state.canaries, limit.MaxProgressingPerNamespace, limit.Order, scope, func(other *deployv1alpha1.CanaryDeployment) bool {
+				return other.Namespace == canary.Namespace
+			}); reason != "" {
+				return reason
+			}
+		}
+	}
+	return ""
+}
+
+// checkLimit counts the rollouts in progress and those queued ahead of the
+// canary within a scope, and explains why the canary must wait if together
+// they reach the limit. Paused rollouts keep their traffic split, and
+// admitted rollouts that have not shifted traffic yet are about to, so both
+// hold a slot too.
+func checkLimit(canary *deployv1alpha1.CanaryDeployment, canaries []*deployv1alpha1.CanaryDeployment, limit int, order, scope string, inScope func(*deployv1alpha1.CanaryDeployment) bool) string {
+	active, ahead := 0, 0
+	for _, other := range canaries {
+		if (other.Namespace == canary.Namespace && other.Name == canary.Name) || !inScope(other) {
+			continue
+		}
+		switch other.Status.Phase {
+		case "Progressing", "Paused":
+			active++
+		case "Initializing", "Pending":
+			if admitted(other) {
+				active++
+			} else if other.Status.Phase == "Pending" && queuedBefore(other, canary, order) {
+				ahead++
+			}
+		}
+	}
+
+	if active+ahead < limit {
+		return ""
+	}
+	return fmt.Sprintf("排队等待: %s内已有 %d 个发布进行中 (上限 %d)，前面还有 %d 个排队", scope, active, limit, ahead)
+}
+
+func admitted(canary *deployv1alpha1.CanaryDeployment) bool {
+	return meta.IsStatusConditionTrue(canary.Status.Conditions, ConditionAdmitted)
+}
+
+// queuedBefore reports whether a is ahead of b in the queue. FIFO follows
+// creation time; Priority puts higher priorities first and falls back to
+// creation time.
+func queuedBefore(a, b *deployv1alpha1.CanaryDeployment, order string) bool {
+	if order == QueueOrderPriority && a.Spec.Priority != b.Spec.Priority {
+		return a.Spec.Priority > b.Spec.Priority
+	}
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
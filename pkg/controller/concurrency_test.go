@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newQueuedCanary(namespace, name, phase string, priority int, created time.Time) *deployv1alpha1.CanaryDeployment {
+	return &deployv1alpha1.CanaryDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, CreationTimestamp: metav1.NewTime(created)},
+		Spec:       deployv1alpha1.CanaryDeploymentSpec{Priority: priority},
+		Status:     deployv1alpha1.CanaryDeploymentStatus{Phase: phase},
+	}
+}
+
+func newConcurrencyPolicy(limit deployv1alpha1.ConcurrencyLimit) *deployv1alpha1.CanaryPolicy {
+	return &deployv1alpha1.CanaryPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "concurrency"},
+		Spec:       deployv1alpha1.CanaryPolicySpec{Concurrency: &limit},
+	}
+}
+
+func TestQueueReason(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		limit    deployv1alpha1.ConcurrencyLimit
+		canary   *deployv1alpha1.CanaryDeployment
+		others   []*deployv1alpha1.CanaryDeployment
+		queued   bool
+		contains string
+	}{
+		{
+			name:   "under cluster limit",
+			limit:  deployv1alpha1.ConcurrencyLimit{MaxProgressing: 2},
+			canary: newQueuedCanary("default", "web", "Initializing", 0, base),
+			others: []*deployv1alpha1.CanaryDeployment{
+				newQueuedCanary("default", "api", "Progressing", 0, base),
+			},
+		},
+		{
+			name:   "cluster limit reached",
+			limit:  deployv1alpha1.ConcurrencyLimit{MaxProgressing: 2},
+			canary: newQueuedCanary("default", "web", "Initializing", 0, base),
+			others: []*deployv1alpha1.CanaryDeployment{
+				newQueuedCanary("default", "api", "Progressing", 0, base),
+				newQueuedCanary("other", "worker", "Paused", 0, base),
+				newQueuedCanary("other", "done", "Completed", 0, base),
+			},
+			queued:   true,
+			contains: "集群内已有 2 个",
+		},
+		{
+			name:   "namespace limit ignores other namespaces",
+			limit:  deployv1alpha1.ConcurrencyLimit{MaxProgressingPerNamespace: 1},
+			canary: newQueuedCanary("default", "web", "Initializing", 0, base),
+			others: []*deployv1alpha1.CanaryDeployment{
+				newQueuedCanary("other", "api", "Progressing", 0, base),
+			},
+		},
+		{
+			name:   "namespace limit reached",
+			limit:  deployv1alpha1.ConcurrencyLimit{MaxProgressingPerNamespace: 1},
+			canary: newQueuedCanary("default", "web", "Initializing", 0, base),
+			others: []*deployv1alpha1.CanaryDeployment{
+				newQueuedCanary("default", "api", "Progressing", 0, base),
+			},
+			queued:   true,
+			contains: "命名空间 default",
+		},
+		{
+			name:   "FIFO waits behind older pending rollout",
+			limit:  deployv1alpha1.ConcurrencyLimit{MaxProgressing: 2},
+			canary: newQueuedCanary("default", "web", "Pending", 10, base.Add(time.Minute)),
+			others: []*deployv1alpha1.CanaryDeployment{
+				newQueuedCanary("default", "api", "Progressing", 0, base),
+				newQueuedCanary("default", "worker", "Pending", 0, base),
+			},
+			queued:   true,
+			contains: "前面还有 1 个",
+		},
+		{
+			name:   "FIFO head of queue starts",
+			limit:  deployv1alpha1.ConcurrencyLimit{MaxProgressing: 2},
+			canary: newQueuedCanary("default", "web", "Pending", 0, base),
+			others: []*deployv1alpha1.CanaryDeployment{
+				newQueuedCanary("default", "api", "Progressing", 0, base),
+				newQueuedCanary("default", "worker", "Pending", 10, base.Add(time.Minute)),
+			},
+		},
+		{
+			name:   "priority jumps the queue",
+			limit:  deployv1alpha1.ConcurrencyLimit{MaxProgressing: 2, Order: QueueOrderPriority},
+			canary: newQueuedCanary("default", "web", "Pending", 10, base.Add(time.Minute)),
+			others: []*deployv1alpha1.CanaryDeployment{
+				newQueuedCanary("default", "api", "Progressing", 0, base),
+				newQueuedCanary("default", "worker", "Pending", 0, base),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &clusterState{
+				canaries: append(tt.others, tt.canary),
+				policies: []*deployv1alpha1.CanaryPolicy{newConcurrencyPolicy(tt.limit)},
+			}
+			reason := queueReason(tt.canary, state)
+			if (reason != "") != tt.queued {
+				t.Errorf("queueReason() = %q, queued want %v", reason, tt.queued)
+			}
+			if !strings.Contains(reason, tt.contains) {
+				t.Errorf("queueReason() = %q, want it to contain %q", reason, tt.contains)
+			}
+		})
+	}
+}
+
+func TestProcessCanary_QueuedByConcurrencyLimit(t *testing.T) {
+	canary := newTestCanary()
+	canary.Spec.Strategy.Steps = []deployv1alpha1.DeployStep{{Weight: 10, Pause: "1m"}, {Weight: 100}}
+	controller, _ := newTestController(t, canary)
+	tm := &mockTrafficManager{}
+	controller.trafficManager = tm
+
+	running := newQueuedCanary("other", "api", "Progressing", 0, time.Now())
+	state := &clusterState{
+		canaries: []*deployv1alpha1.CanaryDeployment{running, canary},
+		policies: []*deployv1alpha1.CanaryPolicy{newConcurrencyPolicy(deployv1alpha1.ConcurrencyLimit{MaxProgressing: 1})},
+	}
+	ctx := context.Background()
+
+	if err := controller.processCanary(ctx, canary, state); err != nil {
+		t.Fatalf("processCanary() error = %v", err)
+	}
+	if tm.updateWeightCalled {
+		t.Error("traffic shifted while over the concurrency limit")
+	}
+	if canary.Status.Phase != "Pending" || !strings.Contains(canary.Status.Reason, "排队等待") {
+		t.Errorf("Phase = %s, Reason = %q, want queued in Pending", canary.Status.Phase, canary.Status.Reason)
+	}
+
+	running.Status.Phase = "Completed"
+	if err := controller.processCanary(ctx, canary, state); err != nil {
+		t.Fatalf("processCanary() error = %v", err)
+	}
+	if !tm.updateWeightCalled || canary.Status.Phase != "Progressing" {
+		t.Errorf("after slot freed: UpdateWeight called = %v, Phase = %s, want started", tm.updateWeightCalled, canary.Status.Phase)
+	}
+}
+
+func TestProcessCanary_AdmittedCanaryHoldsSlotWhileStarting(t *testing.T) {
+	steps := []deployv1alpha1.DeployStep{
+		{Weight: 10, Pause: "1m", PreHooks: []deployv1alpha1.StepHook{newTestHook("smoke", "")}},
+		{Weight: 100},
+	}
+	first := newQueuedCanary("default", "first", "Pending", 0, time.Now().Add(-time.Minute))
+	first.Spec.TargetDeployment = "first-app"
+	first.Spec.Strategy.Steps = steps
+	second := newQueuedCanary("default", "second", "Pending", 0, time.Now())
+	second.Spec.TargetDeployment = "second-app"
+	second.Spec.Strategy.Steps = steps
+
+	controller, _ := newTestController(t, first)
+	second.TypeMeta = metav1.TypeMeta{APIVersion: "deploy.codedance.io/v1alpha1", Kind: "CanaryDeployment"}
+	u, err := convertCanaryToUnstructured(second)
+	if err != nil {
+		t.Fatalf("convert canary: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := controller.dynamicClient.Resource(canaryGVR).Namespace("default").Create(ctx, u, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create canary: %v", err)
+	}
+	tm := &mockTrafficManager{}
+	controller.trafficManager = tm
+
+	state := &clusterState{
+		canaries: []*deployv1alpha1.CanaryDeployment{first, second},
+		policies: []*deployv1alpha1.CanaryPolicy{newConcurrencyPolicy(deployv1alpha1.ConcurrencyLimit{MaxProgressing: 1})},
+	}
+	for _, canary := range state.canaries {
+		if err := controller.processCanary(ctx, canary, state); err != nil {
+			t.Fatalf("processCanary(%s) error = %v", canary.Name, err)
+		}
+	}
+
+	if !admitted(first) || tm.updateWeightCalled {
+		t.Errorf("first: admitted = %v, UpdateWeight called = %v, want admitted and waiting on its pre hook", admitted(first), tm.updateWeightCalled)
+	}
+	if admitted(second) || !strings.Contains(second.Status.Reason, "已有 1 个发布进行中") {
+		t.Errorf("second: admitted = %v, Reason = %q, want queued behind the starting rollout", admitted(second), second.Status.Reason)
+	}
+}
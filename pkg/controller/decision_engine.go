@@ -2,18 +2,73 @@ package controller
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
 )
 
+// Names accepted in DeployStep.Metrics. Success and error rates are
+// percentages, latency_p99 is in milliseconds and pod_ready_rate is the
+// minimum percentage of ready canary pods.
+const (
+	MetricSuccessRate  = "success_rate"
+	MetricErrorRate    = "error_rate"
+	MetricLatencyP99   = "latency_p99"
+	MetricPodReadyRate = "pod_ready_rate"
+)
+
+const defaultPodReadyRate = 80.0
+
 type DefaultDecisionEngine struct{}
 
 func NewDefaultDecisionEngine() *DefaultDecisionEngine {
 	return &DefaultDecisionEngine{}
 }
 
-func (d *DefaultDecisionEngine) Evaluate(metrics *HealthMetrics, thresholds deployv1alpha1.MetricsConfig) Decision {
+func (d *DefaultDecisionEngine) Evaluate(metrics *HealthMetrics, thresholds deployv1alpha1.MetricsConfig, step StepContext) Decision {
+	decision := d.evaluate(metrics, thresholds, step)
+	if decision.Reason != "" && step.Step != nil {
+		decision.Reason = fmt.Sprintf("第 %d 步 (权重 %d%%): %s", step.Index+1, step.Step.Weight, decision.Reason)
+	}
+	return decision
+}
+
+// applyStepChecks overrides the spec-wide thresholds with the checks of the
+// current step and returns the minimum pod ready rate to enforce.
+func applyStepChecks(thresholds deployv1alpha1.MetricsConfig, step StepContext) (deployv1alpha1.MetricsConfig, float64, error) {
+	podReadyRate := defaultPodReadyRate
+	if step.Step == nil {
+		return thresholds, podReadyRate, nil
+	}
+
+	for _, check := range step.Step.Metrics {
+		switch check.Name {
+		case MetricSuccessRate:
+			thresholds.SuccessRate.Threshold = check.Threshold
+		case MetricErrorRate:
+			thresholds.ErrorRate.Threshold = check.Threshold
+		case MetricLatencyP99:
+			thresholds.Latency.P99 = time.Duration(check.Threshold * float64(time.Millisecond)).String()
+		case MetricPodReadyRate:
+			podReadyRate = check.Threshold
+		default:
+			return thresholds, podReadyRate, fmt.Errorf("未知的步骤指标 %q", check.Name)
+		}
+	}
+
+	return thresholds, podReadyRate, nil
+}
+
+func (d *DefaultDecisionEngine) evaluate(metrics *HealthMetrics, thresholds deployv1alpha1.MetricsConfig, step StepContext) Decision {
+	thresholds, minPodReadyRate, err := applyStepChecks(thresholds, step)
+	if err != nil {
+		return Decision{
+			Action: PauseAction,
+			Reason: err.Error(),
+		}
+	}
+
 	score := 0
 
 	if metrics.SuccessRate >= thresholds.SuccessRate.Threshold {
@@ -35,7 +90,7 @@ func (d *DefaultDecisionEngine) Evaluate(metrics *HealthMetrics, thresholds depl
 	}
 
 	if metrics.Latency.P99 <= maxLatencyP99 {
-		score += 30
+		score += 25 + headroomScore(float64(metrics.Latency.P99), float64(maxLatencyP99))
 	} else if metrics.Latency.P99 <= time.Duration(float64(maxLatencyP99)*1.2) {
 		score += 15
 	} else {
@@ -47,7 +102,7 @@ func (d *DefaultDecisionEngine) Evaluate(metrics *HealthMetrics, thresholds depl
 	}
 
 	if metrics.ErrorRate <= thresholds.ErrorRate.Threshold {
-		score += 30
+		score += 25 + headroomScore(metrics.ErrorRate, thresholds.ErrorRate.Threshold)
 	} else {
 		return Decision{
 			Action: RollbackAction,
@@ -65,7 +120,7 @@ func (d *DefaultDecisionEngine) Evaluate(metrics *HealthMetrics, thresholds depl
 	}
 
 	podHealthRate := float64(metrics.PodHealth.Ready) / float64(totalPods)
-	if podHealthRate < 0.8 {
+	if podHealthRate*100 < minPodReadyRate {
 		return Decision{
 			Action: PauseAction,
 			Reason: fmt.Sprintf("Pod 健康率 %.2f%% 过低", podHealthRate*100),
@@ -88,3 +143,17 @@ func (d *DefaultDecisionEngine) Evaluate(metrics *HealthMetrics, thresholds depl
 		}
 	}
 }
+
+// headroomScore grades a metric that is within its limit from 0 (at the
+// limit) to 5 (at zero), so healthier canaries score closer to 100 without
+// changing which metrics pass.
+func headroomScore(value, limit float64) int {
+	if limit <= 0 {
+		return 5
+	}
+	headroom := 1 - value/limit
+	if headroom < 0 {
+		headroom = 0
+	}
+	return int(math.Round(5 * headroom))
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -52,7 +53,7 @@ func TestDecisionEngine_Evaluate_SuccessRate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			decision := engine.Evaluate(tt.metrics, tt.thresholds)
+			decision := engine.Evaluate(tt.metrics, tt.thresholds, StepContext{})
 			if decision.Action != tt.wantAction {
 				t.Errorf("Evaluate() action = %v, want %v", decision.Action, tt.wantAction)
 			}
@@ -103,7 +104,7 @@ func TestDecisionEngine_Evaluate_ErrorRate(t *testing.T) {
 				ErrorRate:   deployv1alpha1.MetricThreshold{Threshold: tt.threshold},
 			}
 
-			decision := engine.Evaluate(metrics, thresholds)
+			decision := engine.Evaluate(metrics, thresholds, StepContext{})
 			if decision.Action != tt.wantAction {
 				t.Errorf("Evaluate() action = %v, want %v", decision.Action, tt.wantAction)
 			}
@@ -148,7 +149,7 @@ func TestDecisionEngine_Evaluate_Latency(t *testing.T) {
 				ErrorRate:   deployv1alpha1.MetricThreshold{Threshold: 5.0},
 			}
 
-			decision := engine.Evaluate(metrics, thresholds)
+			decision := engine.Evaluate(metrics, thresholds, StepContext{})
 			if decision.Action != tt.wantAction {
 				t.Errorf("Evaluate() action = %v, want %v", decision.Action, tt.wantAction)
 			}
@@ -204,7 +205,7 @@ func TestDecisionEngine_Evaluate_PodHealth(t *testing.T) {
 				ErrorRate:   deployv1alpha1.MetricThreshold{Threshold: 5.0},
 			}
 
-			decision := engine.Evaluate(metrics, thresholds)
+			decision := engine.Evaluate(metrics, thresholds, StepContext{})
 			if decision.Action != tt.wantAction {
 				t.Errorf("Evaluate() action = %v, want %v (reason: %s)", decision.Action, tt.wantAction, decision.Reason)
 			}
@@ -227,7 +228,7 @@ func TestDecisionEngine_Evaluate_InvalidLatencyThreshold(t *testing.T) {
 		ErrorRate:   deployv1alpha1.MetricThreshold{Threshold: 5.0},
 	}
 
-	decision := engine.Evaluate(metrics, thresholds)
+	decision := engine.Evaluate(metrics, thresholds, StepContext{})
 	if decision.Action != PauseAction {
 		t.Errorf("Evaluate() with invalid latency threshold should pause, got %v", decision.Action)
 	}
@@ -235,3 +236,122 @@ func TestDecisionEngine_Evaluate_InvalidLatencyThreshold(t *testing.T) {
 		t.Error("Evaluate() with invalid latency threshold should have a reason")
 	}
 }
+
+func TestDecisionEngine_Evaluate_StepMetrics(t *testing.T) {
+	engine := NewDefaultDecisionEngine()
+
+	metrics := &HealthMetrics{
+		SuccessRate: 97.0,
+		Latency:     LatencyMetrics{P99: 300 * time.Millisecond},
+		ErrorRate:   2.0,
+		PodHealth:   PodHealthMetrics{Ready: 4, NotReady: 1},
+	}
+	thresholds := deployv1alpha1.MetricsConfig{
+		SuccessRate: deployv1alpha1.MetricThreshold{Threshold: 99.0},
+		Latency:     deployv1alpha1.LatencyConfig{P99: "500ms"},
+		ErrorRate:   deployv1alpha1.MetricThreshold{Threshold: 5.0},
+	}
+
+	tests := []struct {
+		name               string
+		step               StepContext
+		wantAction         ActionType
+		wantReasonContains []string
+	}{
+		{
+			name:               "spec thresholds apply without step checks",
+			step:               StepContext{Index: 0, Step: &deployv1alpha1.DeployStep{Weight: 1}},
+			wantAction:         RollbackAction,
+			wantReasonContains: []string{"第 1 步", "权重 1%", "成功率"},
+		},
+		{
+			name: "relaxed success rate at early step",
+			step: StepContext{Index: 0, Step: &deployv1alpha1.DeployStep{
+				Weight:  1,
+				Metrics: []deployv1alpha1.MetricCheck{{Name: MetricSuccessRate, Threshold: 95.0}},
+			}},
+			wantAction: ContinueAction,
+		},
+		{
+			name: "strict latency at later step",
+			step: StepContext{Index: 3, Step: &deployv1alpha1.DeployStep{
+				Weight: 50,
+				Metrics: []deployv1alpha1.MetricCheck{
+					{Name: MetricSuccessRate, Threshold: 95.0},
+					{Name: MetricLatencyP99, Threshold: 200},
+				},
+			}},
+			wantAction:         PauseAction,
+			wantReasonContains: []string{"第 4 步", "权重 50%", "P99"},
+		},
+		{
+			name: "additional pod ready rate check",
+			step: StepContext{Index: 2, Step: &deployv1alpha1.DeployStep{
+				Weight: 25,
+				Metrics: []deployv1alpha1.MetricCheck{
+					{Name: MetricSuccessRate, Threshold: 95.0},
+					{Name: MetricPodReadyRate, Threshold: 90},
+				},
+			}},
+			wantAction:         PauseAction,
+			wantReasonContains: []string{"第 3 步", "Pod"},
+		},
+		{
+			name: "unknown step metric pauses",
+			step: StepContext{Index: 0, Step: &deployv1alpha1.DeployStep{
+				Metrics: []deployv1alpha1.MetricCheck{{Name: "cpu", Threshold: 80}},
+			}},
+			wantAction:         PauseAction,
+			wantReasonContains: []string{"cpu"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := engine.Evaluate(metrics, thresholds, tt.step)
+			if decision.Action != tt.wantAction {
+				t.Errorf("Evaluate() action = %v, want %v (reason: %s)", decision.Action, tt.wantAction, decision.Reason)
+			}
+			for _, want := range tt.wantReasonContains {
+				if !strings.Contains(decision.Reason, want) {
+					t.Errorf("Evaluate() reason = %q, want it to contain %q", decision.Reason, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecisionEngine_Evaluate_ScoreReflectsHeadroom(t *testing.T) {
+	engine := NewDefaultDecisionEngine()
+
+	thresholds := deployv1alpha1.MetricsConfig{
+		SuccessRate: deployv1alpha1.MetricThreshold{Threshold: 95.0},
+		Latency:     deployv1alpha1.LatencyConfig{P99: "500ms"},
+		ErrorRate:   deployv1alpha1.MetricThreshold{Threshold: 5.0},
+	}
+	healthy := &HealthMetrics{
+		SuccessRate: 99.9,
+		Latency:     LatencyMetrics{P99: 50 * time.Millisecond},
+		ErrorRate:   0.1,
+		PodHealth:   PodHealthMetrics{Ready: 3},
+	}
+	marginal := &HealthMetrics{
+		SuccessRate: 95.5,
+		Latency:     LatencyMetrics{P99: 490 * time.Millisecond},
+		ErrorRate:   4.9,
+		PodHealth:   PodHealthMetrics{Ready: 3},
+	}
+
+	healthyDecision := engine.Evaluate(healthy, thresholds, StepContext{})
+	marginalDecision := engine.Evaluate(marginal, thresholds, StepContext{})
+
+	if healthyDecision.Action != ContinueAction || marginalDecision.Action != ContinueAction {
+		t.Fatalf("Evaluate() actions = %v/%v, want continue for both", healthyDecision.Action, marginalDecision.Action)
+	}
+	if healthyDecision.Score <= marginalDecision.Score {
+		t.Errorf("healthy score %d should exceed marginal score %d", healthyDecision.Score, marginalDecision.Score)
+	}
+	if marginalDecision.Score < 90 || healthyDecision.Score > 100 {
+		t.Errorf("scores %d/%d outside continue range [90, 100]", marginalDecision.Score, healthyDecision.Score)
+	}
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const ConditionDependencies = "Dependencies"
+
+// checkDependencies reports whether every dependsOn entry of the canary is
+// satisfied. While it is not, or when the dependencies form a cycle, the
+// rollout is held and the blocking dependency is recorded in the status.
+func (c *CanaryController) checkDependencies(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, state *clusterState) (bool, error) {
+	if len(canary.Spec.DependsOn) == 0 {
+		return true, nil
+	}
+
+	var canaries []*deployv1alpha1.CanaryDeployment
+	if state != nil {
+		canaries = state.canaries
+	}
+
+	conditionReason := "DependencyCycle"
+	reason := ""
+	if cycle := dependencyCycle(canary, canaries); cycle != nil {
+		reason = fmt.Sprintf("依赖存在环: %s", strings.Join(cycle, " -> "))
+	} else {
+		conditionReason = "BlockedOnDependency"
+		reason = blockingDependency(canary, canaries)
+	}
+	if reason == "" {
+		return true, nil
+	}
+
+	changed := setCondition(canary, ConditionDependencies, metav1.ConditionFalse, conditionReason, reason)
+	if !changed && canary.Status.Reason == reason {
+		return false, nil
+	}
+	canary.Status.Reason = reason
+	return false, c.updateStatus(ctx, canary)
+}
+
+// blockingDependency describes the first unsatisfied dependency, or returns
+// an empty string when all are satisfied.
+func blockingDependency(canary *deployv1alpha1.CanaryDeployment, canaries []*deployv1alpha1.CanaryDeployment) string {
+	for _, dep := range canary.Spec.DependsOn {
+		key := dependencyKey(canary, dep)
+		target := findCanary(canaries, key)
+		if target == nil {
+			return fmt.Sprintf("被 %s 阻塞: 依赖不存在", key)
+		}
+		if dependencySatisfied(dep, target) {
+			continue
+		}
+		if target.Status.Phase == "Failed" {
+			return fmt.Sprintf("被 %s 阻塞: 依赖已失败", key)
+		}
+
+		want := "Completed"
+		switch {
+		case dep.Phase != "" && dep.Weight > 0:
+			want = fmt.Sprintf("%s 或权重 %d%%", dep.Phase, dep.Weight)
+		case dep.Phase != "":
+			want = dep.Phase
+		case dep.Weight > 0:
+			want = fmt.Sprintf("权重 %d%%", dep.Weight)
+		}
+		return fmt.Sprintf("被 %s 阻塞: 等待达到 %s，当前 %s (权重 %d%%)",
+			key, want, target.Status.Phase, target.Status.CurrentWeight)
+	}
+	return ""
+}
+
+func dependencySatisfied(dep deployv1alpha1.RolloutDependency, target *deployv1alpha1.CanaryDeployment) bool {
+	phase := target.Status.Phase
+	if phase == "Completed" {
+		return true
+	}
+	if dep.Phase != "" && phase == dep.Phase {
+		return true
+	}
+	if dep.Weight > 0 && phase != "Failed" && target.Status.CurrentWeight >= dep.Weight {
+		return true
+	}
+	return false
+}
+
+// failedDependency returns the rollback reason when a dependency declared
+// with rollbackTogether has failed. Only rollouts that have started are
+// rolled back; the others have nothing to undo and stay blocked on the
+// failed dependency.
+func failedDependency(canary *deployv1alpha1.CanaryDeployment, state *clusterState) string {
+	if state == nil {
+		return ""
+	}
+	if phase := canary.Status.Phase; phase != "Progressing" && phase != "Paused" {
+		return ""
+	}
+	for _, dep := range canary.Spec.DependsOn {
+		if !dep.RollbackTogether {
+			continue
+		}
+		key := dependencyKey(canary, dep)
+		if target := findCanary(state.canaries, key); target != nil && target.Status.Phase == "Failed" {
+			return fmt.Sprintf("依赖 %s 已失败，一同回滚", key)
+		}
+	}
+	return ""
+}
+
+// dependencyCycle returns the cycle through the canary, starting and ending
+// with it, or nil if its dependencies do not lead back to it.
+func dependencyCycle(canary *deployv1alpha1.CanaryDeployment, canaries []*deployv1alpha1.CanaryDeployment) []string {
+	start := canary.Namespace + "/" + canary.Name
+	visited := map[string]bool{}
+
+	var visit func(current *deployv1alpha1.CanaryDeployment, path []string) []string
+	visit = func(current *deployv1alpha1.CanaryDeployment, path []string) []string {
+		for _, dep := range current.Spec.DependsOn {
+			key := dependencyKey(current, dep)
+			if key == start {
+				return append(path, key)
+			}
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+			if next := findCanary(canaries, key); next != nil {
+				if cycle := visit(next, append(path, key)); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		return nil
+	}
+
+	return visit(canary, []string{start})
+}
+
+func dependencyKey(canary *deployv1alpha1.CanaryDeployment, dep deployv1alpha1.RolloutDependency) string {
+	namespace := dep.Namespace
+	if namespace == "" {
+		namespace = canary.Namespace
+	}
+	return namespace + "/" + dep.Name
+}
+
+func findCanary(canaries []*deployv1alpha1.CanaryDeployment, key string) *deployv1alpha1.CanaryDeployment {
+	for _, canary := range canaries {
+		if canary.Namespace+"/"+canary.Name == key {
+			return canary
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newDependencyCanary(name, phase string, weight int, deps ...deployv1alpha1.RolloutDependency) *deployv1alpha1.CanaryDeployment {
+	return &deployv1alpha1.CanaryDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       deployv1alpha1.CanaryDeploymentSpec{DependsOn: deps},
+		Status:     deployv1alpha1.CanaryDeploymentStatus{Phase: phase, CurrentWeight: weight},
+	}
+}
+
+func TestBlockingDependency(t *testing.T) {
+	tests := []struct {
+		name    string
+		dep     deployv1alpha1.RolloutDependency
+		target  *deployv1alpha1.CanaryDeployment
+		blocked bool
+	}{
+		{
+			name:    "default waits for completion",
+			dep:     deployv1alpha1.RolloutDependency{Name: "api"},
+			target:  newDependencyCanary("api", "Progressing", 50),
+			blocked: true,
+		},
+		{
+			name:   "completed",
+			dep:    deployv1alpha1.RolloutDependency{Name: "api"},
+			target: newDependencyCanary("api", "Completed", 100),
+		},
+		{
+			name:   "phase reached",
+			dep:    deployv1alpha1.RolloutDependency{Name: "api", Phase: "Progressing"},
+			target: newDependencyCanary("api", "Progressing", 10),
+		},
+		{
+			name:   "weight reached",
+			dep:    deployv1alpha1.RolloutDependency{Name: "api", Weight: 50},
+			target: newDependencyCanary("api", "Progressing", 50),
+		},
+		{
+			name:    "weight not reached",
+			dep:     deployv1alpha1.RolloutDependency{Name: "api", Weight: 50},
+			target:  newDependencyCanary("api", "Progressing", 20),
+			blocked: true,
+		},
+		{
+			name:    "failed dependency",
+			dep:     deployv1alpha1.RolloutDependency{Name: "api", Weight: 10},
+			target:  newDependencyCanary("api", "Failed", 0),
+			blocked: true,
+		},
+		{
+			name:    "missing dependency",
+			dep:     deployv1alpha1.RolloutDependency{Name: "api", Namespace: "other"},
+			target:  newDependencyCanary("api", "Completed", 100),
+			blocked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canary := newDependencyCanary("worker", "Initializing", 0, tt.dep)
+			reason := blockingDependency(canary, []*deployv1alpha1.CanaryDeployment{tt.target, canary})
+			if (reason != "") != tt.blocked {
+				t.Errorf("blockingDependency() = %q, blocked want %v", reason, tt.blocked)
+			}
+			if tt.blocked && !strings.Contains(reason, "default/api") && !strings.Contains(reason, "other/api") {
+				t.Errorf("blockingDependency() = %q, want dependency name", reason)
+			}
+		})
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	api := newDependencyCanary("api", "Initializing", 0, deployv1alpha1.RolloutDependency{Name: "frontend"})
+	worker := newDependencyCanary("worker", "Initializing", 0, deployv1alpha1.RolloutDependency{Name: "api"})
+	frontend := newDependencyCanary("frontend", "Initializing", 0, deployv1alpha1.RolloutDependency{Name: "worker"})
+	standalone := newDependencyCanary("standalone", "Initializing", 0, deployv1alpha1.RolloutDependency{Name: "api"})
+	canaries := []*deployv1alpha1.CanaryDeployment{api, worker, frontend, standalone}
+
+	cycle := dependencyCycle(worker, canaries)
+	want := "default/worker -> default/api -> default/frontend -> default/worker"
+	if strings.Join(cycle, " -> ") != want {
+		t.Errorf("dependencyCycle() = %v, want %s", cycle, want)
+	}
+
+	if cycle := dependencyCycle(standalone, canaries); cycle != nil {
+		t.Errorf("dependencyCycle() = %v for canary outside the cycle, want nil", cycle)
+	}
+}
+
+func TestProcessCanary_BlockedOnDependency(t *testing.T) {
+	canary := newTestCanary()
+	canary.Spec.DependsOn = []deployv1alpha1.RolloutDependency{{Name: "api"}}
+	canary.Spec.Strategy.Steps = []deployv1alpha1.DeployStep{{Weight: 10, Pause: "1m"}, {Weight: 100}}
+	controller, _ := newTestController(t, canary)
+	tm := &mockTrafficManager{}
+	controller.trafficManager = tm
+
+	api := newDependencyCanary("api", "Progressing", 30)
+	state := &clusterState{canaries: []*deployv1alpha1.CanaryDeployment{api, canary}}
+	ctx := context.Background()
+
+	if err := controller.processCanary(ctx, canary, state); err != nil {
+		t.Fatalf("processCanary() error = %v", err)
+	}
+	if tm.updateWeightCalled {
+		t.Error("traffic shifted before dependency completed")
+	}
+	if !strings.Contains(canary.Status.Reason, "被 default/api 阻塞") {
+		t.Errorf("Reason = %q, want blocked on default/api", canary.Status.Reason)
+	}
+	cond := meta.FindStatusCondition(canary.Status.Conditions, ConditionDependencies)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "BlockedOnDependency" {
+		t.Errorf("condition = %+v, want Dependencies False BlockedOnDependency", cond)
+	}
+
+	api.Status.Phase = "Completed"
+	api.Status.CurrentWeight = 100
+	if err := controller.processCanary(ctx, canary, state); err != nil {
+		t.Fatalf("processCanary() error = %v", err)
+	}
+	if !tm.updateWeightCalled || canary.Status.Phase != "Progressing" {
+		t.Errorf("after dependency completed: UpdateWeight called = %v, Phase = %s, want started", tm.updateWeightCalled, canary.Status.Phase)
+	}
+	cond = meta.FindStatusCondition(canary.Status.Conditions, ConditionDependencies)
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("condition = %+v, want Dependencies True", cond)
+	}
+}
+
+func TestProcessCanary_RollbackTogether(t *testing.T) {
+	canary := newTestCanary()
+	canary.Status.Phase = "Progressing"
+	canary.Status.CurrentWeight = 20
+	canary.Spec.DependsOn = []deployv1alpha1.RolloutDependency{{Name: "api", Weight: 10, RollbackTogether: true}}
+	controller, clientset := newTestController(t, canary,
+		newTestDeployment("test-app-canary", 2, map[string]string{"app": "test-app"}),
+	)
+	tm := &mockTrafficManager{}
+	rollbackManager := NewDefaultRollbackManager(clientset, tm)
+	rollbackManager.SetController(controller)
+	controller.rollbackManager = rollbackManager
+
+	state := &clusterState{canaries: []*deployv1alpha1.CanaryDeployment{newDependencyCanary("api", "Failed", 0), canary}}
+	if err := controller.processCanary(context.Background(), canary, state); err != nil {
+		t.Fatalf("processCanary() error = %v", err)
+	}
+
+	if canary.Status.Phase != "Failed" {
+		t.Errorf("Phase = %s, want Failed", canary.Status.Phase)
+	}
+	if !tm.updateWeightCalled || tm.lastWeight != 0 {
+		t.Errorf("UpdateWeight called = %v with %d, want rollback to 0", tm.updateWeightCalled, tm.lastWeight)
+	}
+}
+
+func TestProcessCanary_RollbackTogetherBeforeStart(t *testing.T) {
+	for _, phase := range []string{"Initializing", "Pending"} {
+		t.Run(phase, func(t *testing.T) {
+			canary := newTestCanary()
+			canary.Status.Phase = phase
+			canary.Spec.Strategy.Steps = []deployv1alpha1.DeployStep{{Weight: 10, Pause: "1m"}, {Weight: 100}}
+			canary.Spec.DependsOn = []deployv1alpha1.RolloutDependency{{Name: "api", RollbackTogether: true}}
+			controller, clientset := newTestController(t, canary)
+			tm := &mockTrafficManager{}
+			rollbackManager := NewDefaultRollbackManager(clientset, tm)
+			rollbackManager.SetController(controller)
+			controller.rollbackManager = rollbackManager
+			controller.trafficManager = tm
+
+			state := &clusterState{canaries: []*deployv1alpha1.CanaryDeployment{newDependencyCanary("api", "Failed", 0), canary}}
+			if err := controller.processCanary(context.Background(), canary, state); err != nil {
+				t.Fatalf("processCanary() error = %v", err)
+			}
+
+			if canary.Status.Phase != phase {
+				t.Errorf("Phase = %s, want %s", canary.Status.Phase, phase)
+			}
+			if len(tm.calls) != 0 {
+				t.Errorf("traffic manager calls = %v, want none", tm.calls)
+			}
+			if !strings.Contains(canary.Status.Reason, "依赖已失败") {
+				t.Errorf("Reason = %q, want blocked on the failed dependency", canary.Status.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	DriftPolicyRestore = "Restore"
+	DriftPolicyPause   = "Pause"
+	DriftPolicyIgnore  = "Ignore"
+)
+
+const EventReasonTrafficDrift = "TrafficDrift"
+
+func driftPolicy(canary *deployv1alpha1.CanaryDeployment) string {
+	if routing := canary.Spec.TrafficRouting; routing != nil && routing.DriftPolicy != "" {
+		return routing.DriftPolicy
+	}
+	return DriftPolicyRestore
+}
+
+// checkTrafficDrift compares the weight the traffic provider applies with
+// status.currentWeight, which someone editing the route by hand or another
+// controller rewriting it can make diverge. A drift is reported as a warning
+// event and then restored or holds the rollout, depending on the drift
+// policy. It reports whether the rollout may proceed.
+func (c *CanaryController) checkTrafficDrift(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) (bool, error) {
+	policy := driftPolicy(canary)
+	if policy == DriftPolicyIgnore {
+		return true, nil
+	}
+
+	desired := canary.Status.CurrentWeight
+	observed, err := c.trafficManager.VerifyWeight(ctx, canary, desired)
+	if err != nil {
+		return false, fmt.Errorf("verify traffic weight: %w", err)
+	}
+	if observed == desired {
+		return true, nil
+	}
+
+	message := fmt.Sprintf("流量权重漂移: 实际 %d%%，期望 %d%%", observed, desired)
+	switch policy {
+	case DriftPolicyPause:
+		if canary.Status.Phase == "Paused" && canary.Status.Reason == message {
+			return false, nil
+		}
+		c.recordEvent(ctx, canary, corev1.EventTypeWarning, EventReasonTrafficDrift, message+"，暂停发布")
+		return false, c.pauseDeployment(ctx, canary, message)
+	case DriftPolicyRestore:
+		c.recordEvent(ctx, canary, corev1.EventTypeWarning, EventReasonTrafficDrift, message+"，恢复期望权重")
+		if err := c.trafficManager.UpdateWeight(ctx, canary, desired); err != nil {
+			return false, fmt.Errorf("restore traffic weight: %w", err)
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown drift policy %q", policy)
+	}
+}
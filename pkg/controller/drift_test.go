@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckTrafficDrift(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		drifted     bool
+		wantSynced  bool
+		wantRestore bool
+		wantPhase   string
+		wantEvents  int
+	}{
+		{name: "in sync", drifted: false, wantSynced: true, wantPhase: "Progressing"},
+		{name: "restore by default", drifted: true, wantSynced: true, wantRestore: true, wantPhase: "Progressing", wantEvents: 1},
+		{name: "pause", policy: DriftPolicyPause, drifted: true, wantSynced: false, wantPhase: "Paused", wantEvents: 1},
+		{name: "ignore", policy: DriftPolicyIgnore, drifted: true, wantSynced: true, wantPhase: "Progressing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canary := newTestCanary()
+			canary.Status.Phase = "Progressing"
+			canary.Status.CurrentWeight = 20
+			if tt.policy != "" {
+				canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{DriftPolicy: tt.policy}
+			}
+			controller, clientset := newTestController(t, canary)
+			tm := &mockTrafficManager{drifted: tt.drifted, observedWeight: 50}
+			controller.trafficManager = tm
+
+			synced, err := controller.checkTrafficDrift(context.Background(), canary)
+			if err != nil {
+				t.Fatalf("checkTrafficDrift() error = %v", err)
+			}
+			if synced != tt.wantSynced {
+				t.Errorf("checkTrafficDrift() = %v, want %v", synced, tt.wantSynced)
+			}
+			if tm.updateWeightCalled != tt.wantRestore {
+				t.Errorf("UpdateWeight called = %v, want %v", tm.updateWeightCalled, tt.wantRestore)
+			}
+			if tt.wantRestore && tm.lastWeight != 20 {
+				t.Errorf("restored weight = %d, want 20", tm.lastWeight)
+			}
+			if canary.Status.Phase != tt.wantPhase {
+				t.Errorf("phase = %s, want %s", canary.Status.Phase, tt.wantPhase)
+			}
+
+			events, err := clientset.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("list events: %v", err)
+			}
+			if len(events.Items) != tt.wantEvents {
+				t.Fatalf("events = %d, want %d", len(events.Items), tt.wantEvents)
+			}
+			if tt.wantEvents > 0 {
+				event := events.Items[0]
+				if event.Type != "Warning" || event.Reason != EventReasonTrafficDrift || event.InvolvedObject.Name != canary.Name {
+					t.Errorf("event = %s/%s on %s, want Warning/%s on %s", event.Type, event.Reason, event.InvolvedObject.Name, EventReasonTrafficDrift, canary.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckTrafficDrift_PausedOnce(t *testing.T) {
+	canary := newTestCanary()
+	canary.Status.Phase = "Progressing"
+	canary.Status.CurrentWeight = 20
+	canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{DriftPolicy: DriftPolicyPause}
+	controller, clientset := newTestController(t, canary)
+	controller.trafficManager = &mockTrafficManager{drifted: true, observedWeight: 0}
+
+	for i := 0; i < 2; i++ {
+		if _, err := controller.checkTrafficDrift(context.Background(), canary); err != nil {
+			t.Fatalf("checkTrafficDrift() error = %v", err)
+		}
+	}
+
+	events, err := clientset.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events.Items) != 1 {
+		t.Errorf("events = %d, want 1", len(events.Items))
+	}
+}
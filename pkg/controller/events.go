@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const eventSource = "canary-controller"
+
+// recordEvent records a Kubernetes event on the canary. Failures are only
+// logged, so events never hold up a rollout.
+func (c *CanaryController) recordEvent(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, eventType, reason, message string) {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", canary.Name, now.UnixNano()),
+			Namespace: canary.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      deployv1alpha1.SchemeGroupVersion.String(),
+			Kind:            "CanaryDeployment",
+			Name:            canary.Name,
+			Namespace:       canary.Namespace,
+			UID:             canary.UID,
+			ResourceVersion: canary.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: eventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if _, err := c.clientset.CoreV1().Events(canary.Namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		fmt.Printf("record event %s for canary %s failed: %v\n", reason, canary.Name, err)
+	}
+}
@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	HookTypePre  = "Pre"
+	HookTypePost = "Post"
+
+	HookPhaseRunning   = "Running"
+	HookPhaseSucceeded = "Succeeded"
+	HookPhaseFailed    = "Failed"
+
+	HookFailureRollback = "Rollback"
+	HookFailurePause    = "Pause"
+)
+
+const (
+	hookCanaryLabel    = "deploy.codedance.io/canary"
+	defaultHookTimeout = 10 * time.Minute
+)
+
+// SetHookLogsURL sets the template used to link hook Jobs to their logs.
+// {namespace} and {job} are replaced with the Job's namespace and name.
+func (c *CanaryController) SetHookLogsURL(template string) {
+	c.hookLogsURL = template
+}
+
+// runHooks runs the hooks of a step one after another and reports whether
+// all of them have succeeded. Running Jobs are checked again on the next
+// reconcile; a failed hook rolls back or pauses the canary. Deleting the Job
+// of a failed hook runs it again.
+func (c *CanaryController) runHooks(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, index int, hookType string, hooks []deployv1alpha1.StepHook) (bool, error) {
+	for _, hook := range hooks {
+		status := findHookStatus(canary, index, hookType, hook.Name)
+		if status != nil && status.Phase == HookPhaseSucceeded {
+			continue
+		}
+
+		var job *batchv1.Job
+		if status != nil {
+			var err error
+			job, err = c.clientset.BatchV1().Jobs(canary.Namespace).Get(ctx, status.JobName, metav1.GetOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return false, fmt.Errorf("get hook job %s: %w", status.JobName, err)
+			}
+			if apierrors.IsNotFound(err) {
+				job = nil
+			}
+		}
+
+		if job == nil {
+			if err := c.startHook(ctx, canary, index, hookType, hook); err != nil {
+				return false, err
+			}
+			return false, c.updateStatus(ctx, canary)
+		}
+
+		if status.Phase == HookPhaseRunning {
+			timeout, err := hookTimeout(hook)
+			if err != nil {
+				return false, err
+			}
+			if !syncHookStatus(status, job, timeout) {
+				return false, nil
+			}
+			if status.Phase == HookPhaseSucceeded {
+				if err := c.updateStatus(ctx, canary); err != nil {
+					return false, err
+				}
+				continue
+			}
+		}
+
+		return false, c.failHook(ctx, canary, hook, status)
+	}
+
+	return true, nil
+}
+
+func (c *CanaryController) startHook(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, index int, hookType string, hook deployv1alpha1.StepHook) error {
+	timeout, err := hookTimeout(hook)
+	if err != nil {
+		return err
+	}
+
+	job := &batchv1.Job{}
+	hook.Template.ObjectMeta.DeepCopyInto(&job.ObjectMeta)
+	hook.Template.Spec.DeepCopyInto(&job.Spec)
+
+	job.Name = hookJobName(canary.Name, index, hookType, hook.Name)
+	job.Namespace = canary.Namespace
+	job.GenerateName = ""
+	if job.Labels == nil {
+		job.Labels = make(map[string]string)
+	}
+	job.Labels[hookCanaryLabel] = canary.Name
+	job.OwnerReferences = append(job.OwnerReferences, metav1.OwnerReference{
+		APIVersion: "deploy.codedance.io/v1alpha1",
+		Kind:       "CanaryDeployment",
+		Name:       canary.Name,
+		UID:        canary.UID,
+	})
+	if job.Spec.ActiveDeadlineSeconds == nil {
+		deadline := int64(timeout.Seconds())
+		job.Spec.ActiveDeadlineSeconds = &deadline
+	}
+	if job.Spec.Template.Spec.RestartPolicy == "" {
+		job.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	}
+
+	jobs := c.clientset.BatchV1().Jobs(canary.Namespace)
+	_, err = jobs.Create(ctx, job, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// A Job left over from an earlier run that was never recorded in
+		// status cannot be trusted, so it is replaced.
+		propagation := metav1.DeletePropagationBackground
+		if err := jobs.Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete stale hook job %s: %w", job.Name, err)
+		}
+		return fmt.Errorf("hook job %s already exists, deleted it to retry", job.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("create hook job %s: %w", job.Name, err)
+	}
+
+	status := deployv1alpha1.HookStatus{
+		Name:      hook.Name,
+		Type:      hookType,
+		Step:      index,
+		JobName:   job.Name,
+		Phase:     HookPhaseRunning,
+		LogsURL:   c.hookLogsLink(canary.Namespace, job.Name),
+		StartTime: metav1.Now(),
+	}
+	if existing := findHookStatus(canary, index, hookType, hook.Name); existing != nil {
+		*existing = status
+	} else {
+		canary.Status.Hooks = append(canary.Status.Hooks, status)
+	}
+	return nil
+}
+
+// failHook applies the hook's failure policy. A paused canary is only
+// updated again if the reason changed.
+func (c *CanaryController) failHook(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, hook deployv1alpha1.StepHook, status *deployv1alpha1.HookStatus) error {
+	kind := "前置"
+	if status.Type == HookTypePost {
+		kind = "后置"
+	}
+	reason := fmt.Sprintf("第 %d 步%s钩子 %s 失败: %s", status.Step+1, kind, hook.Name, status.Message)
+
+	switch hook.OnFailure {
+	case HookFailurePause:
+		if canary.Status.Phase == "Paused" && canary.Status.Reason == reason {
+			return nil
+		}
+		return c.pauseDeployment(ctx, canary, reason)
+	case "", HookFailureRollback:
+		return c.rollbackManager.Rollback(ctx, canary, reason)
+	default:
+		return fmt.Errorf("invalid onFailure %q for hook %s", hook.OnFailure, hook.Name)
+	}
+}
+
+// syncHookStatus copies the outcome of the Job into status and reports
+// whether the hook finished.
+func syncHookStatus(status *deployv1alpha1.HookStatus, job *batchv1.Job, timeout time.Duration) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			finishHook(status, HookPhaseSucceeded, condition.Message)
+			return true
+		case batchv1.JobFailed:
+			message := condition.Message
+			if message == "" {
+				message = condition.Reason
+			}
+			finishHook(status, HookPhaseFailed, message)
+			return true
+		}
+	}
+
+	if time.Since(status.StartTime.Time) > timeout {
+		finishHook(status, HookPhaseFailed, fmt.Sprintf("超时 (%v)", timeout))
+		return true
+	}
+	return false
+}
+
+func finishHook(status *deployv1alpha1.HookStatus, phase, message string) {
+	now := metav1.Now()
+	status.Phase = phase
+	status.Message = message
+	status.CompletionTime = &now
+}
+
+func findHookStatus(canary *deployv1alpha1.CanaryDeployment, index int, hookType, name string) *deployv1alpha1.HookStatus {
+	for i := range canary.Status.Hooks {
+		hook := &canary.Status.Hooks[i]
+		if hook.Step == index && hook.Type == hookType && hook.Name == name {
+			return hook
+		}
+	}
+	return nil
+}
+
+func hookTimeout(hook deployv1alpha1.StepHook) (time.Duration, error) {
+	if hook.Timeout == "" {
+		return defaultHookTimeout, nil
+	}
+	timeout, err := time.ParseDuration(hook.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q for hook %s: %w", hook.Timeout, hook.Name, err)
+	}
+	return timeout, nil
+}
+
+// hookJobName builds a Job name unique per canary, step and hook, shortened
+// with a hash when it would exceed the 63 character label limit.
+func hookJobName(canaryName string, index int, hookType, hookName string) string {
+	name := fmt.Sprintf("%s-%d-%s-%s", canaryName, index, strings.ToLower(hookType), hookName)
+	if len(name) <= 63 {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%s-%08x", strings.TrimRight(name[:54], "-."), h.Sum32())
+}
+
+func (c *CanaryController) hookLogsLink(namespace, job string) string {
+	if c.hookLogsURL == "" {
+		return ""
+	}
+	return strings.NewReplacer("{namespace}", namespace, "{job}", job).Replace(c.hookLogsURL)
+}
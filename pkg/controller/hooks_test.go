@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestHook(name, onFailure string) deployv1alpha1.StepHook {
+	return deployv1alpha1.StepHook{
+		Name:      name,
+		Timeout:   "5m",
+		OnFailure: onFailure,
+		Template: batchv1.JobTemplateSpec{
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "test", Image: "busybox"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func setJobCondition(t *testing.T, clientset *fake.Clientset, name string, conditionType batchv1.JobConditionType, message string) {
+	t.Helper()
+
+	ctx := context.Background()
+	job, err := clientset.BatchV1().Jobs("default").Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get job %s: %v", name, err)
+	}
+	job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+		Type:    conditionType,
+		Status:  corev1.ConditionTrue,
+		Message: message,
+	})
+	if _, err := clientset.BatchV1().Jobs("default").UpdateStatus(ctx, job, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update job %s: %v", name, err)
+	}
+}
+
+func TestApplyStep_PreHookHoldsTraffic(t *testing.T) {
+	canary := newTestCanary()
+	controller, clientset := newTestController(t, canary)
+	controller.SetHookLogsURL("https://logs.example.com/?ns={namespace}&job={job}")
+	tm := &mockTrafficManager{}
+	controller.trafficManager = tm
+
+	step := deployv1alpha1.DeployStep{
+		Weight:   10,
+		PreHooks: []deployv1alpha1.StepHook{newTestHook("smoke", "")},
+	}
+	ctx := context.Background()
+
+	if err := controller.applyStep(ctx, canary, 1, step); err != nil {
+		t.Fatalf("applyStep() error = %v", err)
+	}
+	if tm.updateWeightCalled {
+		t.Error("UpdateWeight called before pre hook finished")
+	}
+
+	job, err := clientset.BatchV1().Jobs("default").Get(ctx, "test-canary-1-pre-smoke", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get hook job: %v", err)
+	}
+	if job.Labels[hookCanaryLabel] != "test-canary" {
+		t.Errorf("job labels = %v, want %s=test-canary", job.Labels, hookCanaryLabel)
+	}
+	if job.Spec.ActiveDeadlineSeconds == nil || *job.Spec.ActiveDeadlineSeconds != 300 {
+		t.Errorf("activeDeadlineSeconds = %v, want 300", job.Spec.ActiveDeadlineSeconds)
+	}
+	if job.Spec.Template.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Errorf("restartPolicy = %s, want Never", job.Spec.Template.Spec.RestartPolicy)
+	}
+
+	if len(canary.Status.Hooks) != 1 {
+		t.Fatalf("status hooks = %v, want one entry", canary.Status.Hooks)
+	}
+	status := canary.Status.Hooks[0]
+	if status.Phase != HookPhaseRunning || status.Type != HookTypePre || status.Step != 1 {
+		t.Errorf("hook status = %+v, want running pre hook for step 1", status)
+	}
+	if status.LogsURL != "https://logs.example.com/?ns=default&job=test-canary-1-pre-smoke" {
+		t.Errorf("LogsURL = %q", status.LogsURL)
+	}
+
+	setJobCondition(t, clientset, "test-canary-1-pre-smoke", batchv1.JobComplete, "")
+
+	if err := controller.applyStep(ctx, canary, 1, step); err != nil {
+		t.Fatalf("applyStep() error = %v", err)
+	}
+	if !tm.updateWeightCalled || tm.lastWeight != 10 {
+		t.Errorf("UpdateWeight called = %v with %d, want 10", tm.updateWeightCalled, tm.lastWeight)
+	}
+	if canary.Status.Hooks[0].Phase != HookPhaseSucceeded || canary.Status.Hooks[0].CompletionTime == nil {
+		t.Errorf("hook status = %+v, want succeeded with completion time", canary.Status.Hooks[0])
+	}
+}
+
+func TestRunHooks_FailurePauses(t *testing.T) {
+	canary := newTestCanary()
+	canary.Status.Phase = "Progressing"
+	controller, clientset := newTestController(t, canary)
+	hooks := []deployv1alpha1.StepHook{newTestHook("integration", HookFailurePause)}
+	ctx := context.Background()
+
+	if done, err := controller.runHooks(ctx, canary, 2, HookTypePost, hooks); err != nil || done {
+		t.Fatalf("runHooks() = %v, %v, want false, nil", done, err)
+	}
+
+	setJobCondition(t, clientset, "test-canary-2-post-integration", batchv1.JobFailed, "BackoffLimitExceeded")
+
+	if done, err := controller.runHooks(ctx, canary, 2, HookTypePost, hooks); err != nil || done {
+		t.Fatalf("runHooks() = %v, %v, want false, nil", done, err)
+	}
+	if canary.Status.Phase != "Paused" {
+		t.Errorf("Phase = %s, want Paused", canary.Status.Phase)
+	}
+	if !strings.Contains(canary.Status.Reason, "integration") || !strings.Contains(canary.Status.Reason, "BackoffLimitExceeded") {
+		t.Errorf("Reason = %q, want hook name and job message", canary.Status.Reason)
+	}
+
+	if err := clientset.BatchV1().Jobs("default").Delete(ctx, "test-canary-2-post-integration", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete job: %v", err)
+	}
+	if done, err := controller.runHooks(ctx, canary, 2, HookTypePost, hooks); err != nil || done {
+		t.Fatalf("runHooks() = %v, %v, want false, nil", done, err)
+	}
+	if canary.Status.Hooks[0].Phase != HookPhaseRunning {
+		t.Errorf("hook phase = %s, want Running after the failed job was deleted", canary.Status.Hooks[0].Phase)
+	}
+}
+
+func TestRunHooks_TimeoutRollsBack(t *testing.T) {
+	canary := newTestCanary()
+	canary.Status.Phase = "Progressing"
+	controller, clientset := newTestController(t, canary,
+		newTestDeployment("test-app-canary", 2, map[string]string{"app": "test-app"}),
+	)
+	tm := &mockTrafficManager{}
+	rollbackManager := NewDefaultRollbackManager(clientset, tm)
+	rollbackManager.SetController(controller)
+	controller.rollbackManager = rollbackManager
+
+	hook := newTestHook("smoke", "")
+	hook.Timeout = "1m"
+	hooks := []deployv1alpha1.StepHook{hook}
+	ctx := context.Background()
+
+	if _, err := controller.runHooks(ctx, canary, 0, HookTypePre, hooks); err != nil {
+		t.Fatalf("runHooks() error = %v", err)
+	}
+	canary.Status.Hooks[0].StartTime = metav1.NewTime(time.Now().Add(-2 * time.Minute))
+
+	if done, err := controller.runHooks(ctx, canary, 0, HookTypePre, hooks); err != nil || done {
+		t.Fatalf("runHooks() = %v, %v, want false, nil", done, err)
+	}
+	if canary.Status.Phase != "Failed" {
+		t.Errorf("Phase = %s, want Failed", canary.Status.Phase)
+	}
+	if !tm.updateWeightCalled || tm.lastWeight != 0 {
+		t.Errorf("UpdateWeight called = %v with %d, want rollback to 0", tm.updateWeightCalled, tm.lastWeight)
+	}
+	if canary.Status.Hooks[0].Phase != HookPhaseFailed {
+		t.Errorf("hook phase = %s, want Failed", canary.Status.Hooks[0].Phase)
+	}
+}
+
+func TestHookJobName(t *testing.T) {
+	short := hookJobName("web", 3, HookTypePost, "tests")
+	if short != "web-3-post-tests" {
+		t.Errorf("hookJobName() = %q, want web-3-post-tests", short)
+	}
+
+	long := hookJobName(strings.Repeat("a", 50), 3, HookTypePre, strings.Repeat("b", 20))
+	if len(long) > 63 {
+		t.Errorf("hookJobName() length = %d, want <= 63", len(long))
+	}
+	if long == hookJobName(strings.Repeat("a", 50), 4, HookTypePre, strings.Repeat("b", 20)) {
+		t.Error("hookJobName() collides for different steps")
+	}
+}
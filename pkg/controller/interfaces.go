@@ -10,6 +10,39 @@ import (
 type TrafficManager interface {
 	UpdateWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) error
 	CreateCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error
+	// VerifyWeight reads back the canary weight the provider applies. It
+	// returns weight when every route it manages carries that weight, and
+	// otherwise the first diverging weight found.
+	VerifyWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) (int, error)
+}
+
+// RequestMatchRouter is implemented by traffic managers that can route
+// requests matching headers, cookies or other attributes to the canary
+// independently of the weight. An empty match list removes such routes.
+type RequestMatchRouter interface {
+	UpdateMatch(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, matches []deployv1alpha1.RouteMatch) error
+}
+
+// TrafficMirror is implemented by traffic managers that can shadow a
+// percentage of live requests to the canary. A percent of 0 stops mirroring.
+type TrafficMirror interface {
+	UpdateMirror(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, percent int) error
+}
+
+// RouteCleaner is implemented by traffic managers that set up routing
+// objects of their own for a rollout, such as Istio subsets. It is called
+// once the rollout has been rolled back; completed rollouts keep their
+// routes with all traffic on the new version.
+type RouteCleaner interface {
+	CleanupCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error
+}
+
+// RouteSyncer is implemented by traffic managers that keep their routes only
+// in the controller process. It is called on every reconcile with the
+// CanaryDeployments routed through the manager, so that the routes of
+// deleted ones are dropped and those lost in a restart are recreated.
+type RouteSyncer interface {
+	SyncRoutes(ctx context.Context, canaries []*deployv1alpha1.CanaryDeployment) error
 }
 
 type MetricsAnalyzer interface {
@@ -17,7 +50,14 @@ type MetricsAnalyzer interface {
 }
 
 type DecisionEngine interface {
-	Evaluate(metrics *HealthMetrics, thresholds deployv1alpha1.MetricsConfig) Decision
+	Evaluate(metrics *HealthMetrics, thresholds deployv1alpha1.MetricsConfig, step StepContext) Decision
+}
+
+// StepContext identifies the step whose metrics are being evaluated. Step is
+// nil when the evaluation is not tied to a step.
+type StepContext struct {
+	Index int
+	Step  *deployv1alpha1.DeployStep
 }
 
 type RollbackManager interface {
@@ -28,6 +68,7 @@ type HealthMetrics struct {
 	SuccessRate float64
 	Latency     LatencyMetrics
 	ErrorRate   float64
+	RequestRate float64
 	PodHealth   PodHealthMetrics
 	Resources   ResourceMetrics
 }
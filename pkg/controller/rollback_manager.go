@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/workload"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
@@ -33,6 +34,18 @@ func (r *DefaultRollbackManager) Rollback(ctx context.Context, canary *deployv1a
 		return fmt.Errorf("revert traffic: %w", err)
 	}
 
+	if err := updateMatch(ctx, r.trafficManager, canary, nil); err != nil {
+		return fmt.Errorf("revert request match routing: %w", err)
+	}
+
+	if err := updateMirror(ctx, r.trafficManager, canary, 0); err != nil {
+		return fmt.Errorf("stop traffic mirroring: %w", err)
+	}
+
+	if err := cleanupRoute(ctx, r.trafficManager, canary); err != nil {
+		return fmt.Errorf("clean up canary route: %w", err)
+	}
+
 	if err := r.deleteCanaryPods(ctx, canary); err != nil {
 		return fmt.Errorf("delete canary pods: %w", err)
 	}
@@ -52,19 +65,9 @@ func (r *DefaultRollbackManager) Rollback(ctx context.Context, canary *deployv1a
 }
 
 func (r *DefaultRollbackManager) deleteCanaryPods(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
-	deployment, err := r.clientset.AppsV1().
-		Deployments(canary.Namespace).
-		Get(ctx, canary.Spec.TargetDeployment+"-canary", metav1.GetOptions{})
+	target, err := workload.New(r.clientset, canary)
 	if err != nil {
 		return err
 	}
-
-	replicas := int32(0)
-	deployment.Spec.Replicas = &replicas
-
-	_, err = r.clientset.AppsV1().
-		Deployments(canary.Namespace).
-		Update(ctx, deployment, metav1.UpdateOptions{})
-
-	return err
+	return target.Rollback(ctx)
 }
@@ -15,11 +15,16 @@ type mockTrafficManager struct {
 	updateWeightCalled bool
 	lastWeight         int
 	shouldError        bool
+	drifted            bool
+	observedWeight     int
+	createRouteError   bool
+	calls              []string
 }
 
 func (m *mockTrafficManager) UpdateWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) error {
 	m.updateWeightCalled = true
 	m.lastWeight = weight
+	m.calls = append(m.calls, "UpdateWeight")
 	if m.shouldError {
 		return context.DeadlineExceeded
 	}
@@ -27,9 +32,20 @@ func (m *mockTrafficManager) UpdateWeight(ctx context.Context, canary *deployv1a
 }
 
 func (m *mockTrafficManager) CreateCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	m.calls = append(m.calls, "CreateCanaryRoute")
+	if m.createRouteError {
+		return context.DeadlineExceeded
+	}
 	return nil
 }
 
+func (m *mockTrafficManager) VerifyWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) (int, error) {
+	if m.drifted {
+		return m.observedWeight, nil
+	}
+	return weight, nil
+}
+
 func TestNewDefaultRollbackManager(t *testing.T) {
 	mockTM := &mockTrafficManager{}
 	manager := NewDefaultRollbackManager(nil, mockTM)
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const ConditionDeploymentWindow = "DeploymentWindow"
+
+// checkDeploymentWindow reports whether the canary may shift traffic now
+// under its own schedule and every CanaryPolicy schedule. When it may not,
+// the reason is recorded in the status and the rollout holds.
+func (c *CanaryController) checkDeploymentWindow(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, state *clusterState) (bool, error) {
+	schedules := []*deployv1alpha1.DeploymentSchedule{canary.Spec.Schedule}
+	if state != nil {
+		for _, policy := range state.policies {
+			schedules = append(schedules, policy.Spec.Schedule)
+		}
+	}
+
+	open, reason, err := checkSchedules(time.Now(), schedules)
+	if err != nil {
+		return false, fmt.Errorf("evaluate deployment schedule: %w", err)
+	}
+	if open {
+		return true, nil
+	}
+
+	changed := setCondition(canary, ConditionDeploymentWindow, metav1.ConditionFalse, "WaitingForWindow", reason)
+	if !changed && canary.Status.Reason == reason {
+		return false, nil
+	}
+	canary.Status.Reason = reason
+	return false, c.updateStatus(ctx, canary)
+}
+
+// checkSchedules reports whether traffic may be shifted at now under every
+// given schedule. When it may not, the returned string explains why.
+func checkSchedules(now time.Time, schedules []*deployv1alpha1.DeploymentSchedule) (bool, string, error) {
+	for _, schedule := range schedules {
+		if schedule == nil {
+			continue
+		}
+		open, reason, err := checkSchedule(now, schedule)
+		if err != nil || !open {
+			return open, reason, err
+		}
+	}
+	return true, "", nil
+}
+
+func checkSchedule(now time.Time, schedule *deployv1alpha1.DeploymentSchedule) (bool, string, error) {
+	for _, blackout := range schedule.Blackouts {
+		if !now.Before(blackout.Start.Time) && now.Before(blackout.End.Time) {
+			reason := fmt.Sprintf("处于冻结期，至 %s 结束", blackout.End.Format(time.RFC3339))
+			if blackout.Reason != "" {
+				reason = fmt.Sprintf("处于冻结期 (%s)，至 %s 结束", blackout.Reason, blackout.End.Format(time.RFC3339))
+			}
+			return false, reason, nil
+		}
+	}
+
+	if len(schedule.Windows) == 0 {
+		return true, "", nil
+	}
+
+	tz := schedule.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return false, "", fmt.Errorf("invalid timezone %q: %w", tz, err)
+	}
+	local := now.In(loc)
+
+	for _, window := range schedule.Windows {
+		inside, err := windowContains(window, local)
+		if err != nil {
+			return false, "", err
+		}
+		if inside {
+			return true, "", nil
+		}
+	}
+
+	return false, fmt.Sprintf("等待发布窗口 (%s)", describeWindows(schedule.Windows, tz)), nil
+}
+
+// windowContains reports whether local falls inside the window. Windows whose
+// end is not after their start span midnight, and Days refers to the day the
+// window opens.
+func windowContains(window deployv1alpha1.DeploymentWindow, local time.Time) (bool, error) {
+	start, err := parseClock(window.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(window.End)
+	if err != nil {
+		return false, err
+	}
+
+	clock := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	day := local.Weekday()
+
+	if start < end {
+		if clock < start || clock >= end {
+			return false, nil
+		}
+		return dayAllowed(window.Days, day)
+	}
+
+	if clock >= start {
+		return dayAllowed(window.Days, day)
+	}
+	if clock < end {
+		return dayAllowed(window.Days, (day+6)%7)
+	}
+	return false, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid window time %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func dayAllowed(days []string, day time.Weekday) (bool, error) {
+	if len(days) == 0 {
+		return true, nil
+	}
+	for _, d := range days {
+		if len(d) < 3 {
+			return false, fmt.Errorf("invalid window day %q", d)
+		}
+		matched := false
+		for wd := time.Sunday; wd <= time.Saturday; wd++ {
+			if strings.EqualFold(d[:3], wd.String()[:3]) {
+				matched = true
+				if wd == day {
+					return true, nil
+				}
+			}
+		}
+		if !matched {
+			return false, fmt.Errorf("invalid window day %q", d)
+		}
+	}
+	return false, nil
+}
+
+func describeWindows(windows []deployv1alpha1.DeploymentWindow, tz string) string {
+	parts := make([]string, 0, len(windows))
+	for _, w := range windows {
+		days := "每天"
+		if len(w.Days) > 0 {
+			days = strings.Join(w.Days, ",")
+		}
+		parts = append(parts, fmt.Sprintf("%s %s-%s", days, w.Start, w.End))
+	}
+	return strings.Join(parts, "; ") + " " + tz
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckSchedules(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+
+	officeHours := &deployv1alpha1.DeploymentSchedule{
+		Timezone: "Asia/Shanghai",
+		Windows: []deployv1alpha1.DeploymentWindow{
+			{Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, Start: "09:00", End: "17:00"},
+		},
+	}
+	nightly := &deployv1alpha1.DeploymentSchedule{
+		Windows: []deployv1alpha1.DeploymentWindow{
+			{Days: []string{"Saturday"}, Start: "22:00", End: "02:00"},
+		},
+	}
+	freeze := &deployv1alpha1.DeploymentSchedule{
+		Blackouts: []deployv1alpha1.BlackoutPeriod{
+			{
+				Start:  metav1.NewTime(time.Date(2026, 10, 1, 0, 0, 0, 0, shanghai)),
+				End:    metav1.NewTime(time.Date(2026, 10, 8, 0, 0, 0, 0, shanghai)),
+				Reason: "国庆封网",
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		schedules  []*deployv1alpha1.DeploymentSchedule
+		wantOpen   bool
+		wantReason string
+	}{
+		{
+			name:     "no schedules",
+			now:      time.Date(2026, 10, 19, 3, 0, 0, 0, shanghai),
+			wantOpen: true,
+		},
+		{
+			name:      "inside weekday window",
+			now:       time.Date(2026, 10, 19, 10, 30, 0, 0, shanghai),
+			schedules: []*deployv1alpha1.DeploymentSchedule{officeHours},
+			wantOpen:  true,
+		},
+		{
+			name:       "weekday night",
+			now:        time.Date(2026, 10, 19, 23, 0, 0, 0, shanghai),
+			schedules:  []*deployv1alpha1.DeploymentSchedule{officeHours},
+			wantReason: "等待发布窗口",
+		},
+		{
+			name:       "weekend",
+			now:        time.Date(2026, 10, 18, 10, 30, 0, 0, shanghai),
+			schedules:  []*deployv1alpha1.DeploymentSchedule{officeHours},
+			wantReason: "等待发布窗口",
+		},
+		{
+			name:      "window evaluated in its timezone",
+			now:       time.Date(2026, 10, 19, 2, 0, 0, 0, time.UTC),
+			schedules: []*deployv1alpha1.DeploymentSchedule{officeHours},
+			wantOpen:  true,
+		},
+		{
+			name:      "overnight window after midnight belongs to previous day",
+			now:       time.Date(2026, 10, 18, 1, 0, 0, 0, time.UTC),
+			schedules: []*deployv1alpha1.DeploymentSchedule{nightly},
+			wantOpen:  true,
+		},
+		{
+			name:       "blackout inside window",
+			now:        time.Date(2026, 10, 5, 10, 0, 0, 0, shanghai),
+			schedules:  []*deployv1alpha1.DeploymentSchedule{officeHours, freeze},
+			wantReason: "国庆封网",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			open, reason, err := checkSchedules(tt.now, tt.schedules)
+			if err != nil {
+				t.Fatalf("checkSchedules() error = %v", err)
+			}
+			if open != tt.wantOpen {
+				t.Errorf("checkSchedules() open = %v, want %v (reason: %s)", open, tt.wantOpen, reason)
+			}
+			if tt.wantReason != "" && !strings.Contains(reason, tt.wantReason) {
+				t.Errorf("checkSchedules() reason = %q, want it to contain %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestCheckSchedules_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *deployv1alpha1.DeploymentSchedule
+	}{
+		{
+			name: "unknown timezone",
+			schedule: &deployv1alpha1.DeploymentSchedule{
+				Timezone: "Mars/Olympus",
+				Windows:  []deployv1alpha1.DeploymentWindow{{Start: "09:00", End: "17:00"}},
+			},
+		},
+		{
+			name: "bad clock",
+			schedule: &deployv1alpha1.DeploymentSchedule{
+				Windows: []deployv1alpha1.DeploymentWindow{{Start: "9am", End: "17:00"}},
+			},
+		},
+		{
+			name: "bad day",
+			schedule: &deployv1alpha1.DeploymentSchedule{
+				Windows: []deployv1alpha1.DeploymentWindow{{Days: []string{"Funday"}, Start: "00:00", End: "23:59"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := checkSchedules(time.Now(), []*deployv1alpha1.DeploymentSchedule{tt.schedule}); err == nil {
+				t.Error("checkSchedules() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestCheckDeploymentWindow_RecordsWaiting(t *testing.T) {
+	canary := newTestCanary()
+	now := time.Now()
+	canary.Spec.Schedule = &deployv1alpha1.DeploymentSchedule{
+		Blackouts: []deployv1alpha1.BlackoutPeriod{
+			{Start: metav1.NewTime(now.Add(-time.Hour)), End: metav1.NewTime(now.Add(time.Hour))},
+		},
+	}
+	controller, _ := newTestController(t, canary)
+	tm := &mockTrafficManager{}
+	controller.trafficManager = tm
+
+	canary.Spec.Strategy.Steps = []deployv1alpha1.DeployStep{{Weight: 10, Pause: "1m"}, {Weight: 100}}
+	if err := controller.processCanary(context.Background(), canary, &clusterState{}); err != nil {
+		t.Fatalf("processCanary() error = %v", err)
+	}
+
+	if tm.updateWeightCalled {
+		t.Error("traffic shifted during blackout")
+	}
+	if !strings.Contains(canary.Status.Reason, "冻结期") {
+		t.Errorf("Reason = %q, want blackout reason", canary.Status.Reason)
+	}
+	cond := meta.FindStatusCondition(canary.Status.Conditions, ConditionDeploymentWindow)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "WaitingForWindow" {
+		t.Errorf("condition = %+v, want DeploymentWindow False WaitingForWindow", cond)
+	}
+}
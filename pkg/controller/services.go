@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/workload"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// serviceOwnerAnnotation marks the Services managed for a canary. Its value
+// is the name of the CanaryDeployment.
+const serviceOwnerAnnotation = "deploy.codedance.io/canary"
+
+// syncServices creates the stable and canary Services when spec.services is
+// set and pins each selector to the pods of one version. Once promoted, the
+// stable Service selects the promoted pods; its selector is switched in a
+// single update, so there is no moment it selects no ready pods.
+func (c *CanaryController) syncServices(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, promoted bool) error {
+	if canary.Spec.Services == nil {
+		return nil
+	}
+
+	sourceName, stableName, canaryName := workload.ServiceNames(canary)
+	source, err := c.clientset.CoreV1().Services(canary.Namespace).Get(ctx, sourceName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get service %s: %w", sourceName, err)
+	}
+
+	stableLabels, canaryLabels, err := workload.VersionLabels(ctx, c.clientset, canary)
+	if err != nil {
+		return err
+	}
+	if promoted {
+		stableLabels = canaryLabels
+	}
+
+	if err := c.ensureVersionService(ctx, canary, source, stableName, stableLabels); err != nil {
+		return err
+	}
+	return c.ensureVersionService(ctx, canary, source, canaryName, canaryLabels)
+}
+
+// ensureVersionService creates or updates a Service with the ports of source
+// and its selector narrowed by versionLabels.
+func (c *CanaryController) ensureVersionService(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, source *corev1.Service, name string, versionLabels map[string]string) error {
+	selector := make(map[string]string, len(source.Spec.Selector)+len(versionLabels))
+	maps.Copy(selector, source.Spec.Selector)
+	maps.Copy(selector, versionLabels)
+
+	ports := make([]corev1.ServicePort, 0, len(source.Spec.Ports))
+	for _, p := range source.Spec.Ports {
+		p.NodePort = 0
+		ports = append(ports, p)
+	}
+
+	services := c.clientset.CoreV1().Services(canary.Namespace)
+	service, err := services.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   canary.Namespace,
+				Labels:      maps.Clone(source.Labels),
+				Annotations: map[string]string{serviceOwnerAnnotation: canary.Name},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeClusterIP,
+				Ports:    ports,
+				Selector: selector,
+			},
+		}
+		if _, err := services.Create(ctx, service, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("create service %s: %w", name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get service %s: %w", name, err)
+	}
+
+	if service.Annotations[serviceOwnerAnnotation] == canary.Name &&
+		maps.Equal(service.Spec.Selector, selector) &&
+		equality.Semantic.DeepEqual(service.Spec.Ports, ports) {
+		return nil
+	}
+	if service.Annotations == nil {
+		service.Annotations = make(map[string]string)
+	}
+	service.Annotations[serviceOwnerAnnotation] = canary.Name
+	service.Spec.Ports = ports
+	service.Spec.Selector = selector
+	if _, err := services.Update(ctx, service, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update service %s: %w", name, err)
+	}
+	return nil
+}
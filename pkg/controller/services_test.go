@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/traffic"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newVersionedTestDeployment(name, version string) *appsv1.Deployment {
+	deployment := newTestDeployment(name, 2, map[string]string{"app": "test-app"})
+	deployment.Spec.Template.Labels = map[string]string{"app": "test-app", "version": version}
+	return deployment
+}
+
+func newSourceService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-app", Namespace: "default", Labels: map[string]string{"team": "shop"}},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeNodePort,
+			Selector: map[string]string{"app": "test-app"},
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080), NodePort: 30080},
+			},
+		},
+	}
+}
+
+func getService(t *testing.T, clientset *fake.Clientset, name string) *corev1.Service {
+	t.Helper()
+	service, err := clientset.CoreV1().Services("default").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service %s: %v", name, err)
+	}
+	return service
+}
+
+func TestSyncServices(t *testing.T) {
+	canary := newTestCanary()
+	canary.Spec.Services = &deployv1alpha1.ManagedServices{}
+	stable := newVersionedTestDeployment("test-app", "v1")
+	canaryDeployment := newVersionedTestDeployment("test-app-canary", "v2")
+	controller, clientset := newTestController(t, canary, newSourceService(), stable, canaryDeployment)
+	ctx := context.Background()
+
+	if err := controller.syncServices(ctx, canary, false); err != nil {
+		t.Fatalf("syncServices() error = %v", err)
+	}
+
+	stableService := getService(t, clientset, "test-app-stable")
+	if want := map[string]string{"app": "test-app", "version": "v1"}; !maps.Equal(stableService.Spec.Selector, want) {
+		t.Errorf("stable selector = %v, want %v", stableService.Spec.Selector, want)
+	}
+	if stableService.Spec.Type != corev1.ServiceTypeClusterIP || stableService.Spec.Ports[0].NodePort != 0 || stableService.Spec.Ports[0].TargetPort.IntValue() != 8080 {
+		t.Errorf("stable service spec = %+v, want ClusterIP with cloned ports and no node port", stableService.Spec)
+	}
+	if stableService.Labels["team"] != "shop" || stableService.Annotations[serviceOwnerAnnotation] != canary.Name {
+		t.Errorf("stable service metadata = %v %v, want source labels and owner annotation", stableService.Labels, stableService.Annotations)
+	}
+
+	canaryService := getService(t, clientset, "test-app-canary")
+	if want := map[string]string{"app": "test-app", "version": "v2"}; !maps.Equal(canaryService.Spec.Selector, want) {
+		t.Errorf("canary selector = %v, want %v", canaryService.Spec.Selector, want)
+	}
+
+	if err := controller.syncServices(ctx, canary, true); err != nil {
+		t.Fatalf("syncServices() promoted error = %v", err)
+	}
+	stableService = getService(t, clientset, "test-app-stable")
+	if stableService.Spec.Selector["version"] != "v2" {
+		t.Errorf("promoted stable selector = %v, want version v2", stableService.Spec.Selector)
+	}
+}
+
+func TestSyncServices_Disabled(t *testing.T) {
+	canary := newTestCanary()
+	controller, clientset := newTestController(t, canary, newSourceService())
+
+	if err := controller.syncServices(context.Background(), canary, false); err != nil {
+		t.Fatalf("syncServices() error = %v", err)
+	}
+	services, _ := clientset.CoreV1().Services("default").List(context.Background(), metav1.ListOptions{})
+	if len(services.Items) != 1 {
+		t.Errorf("services = %d, want only the source service", len(services.Items))
+	}
+}
+
+func TestSyncServices_AdoptsExistingService(t *testing.T) {
+	canary := newTestCanary()
+	canary.Spec.Services = &deployv1alpha1.ManagedServices{StableService: "shop-stable"}
+	stable := newVersionedTestDeployment("test-app", "v1")
+	canaryDeployment := newVersionedTestDeployment("test-app-canary", "v2")
+	existing := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-app-canary", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "test-app"}},
+	}
+	controller, clientset := newTestController(t, canary, newSourceService(), stable, canaryDeployment, existing)
+
+	if err := controller.syncServices(context.Background(), canary, false); err != nil {
+		t.Fatalf("syncServices() error = %v", err)
+	}
+
+	getService(t, clientset, "shop-stable")
+	canaryService := getService(t, clientset, "test-app-canary")
+	if canaryService.Spec.Selector["version"] != "v2" || len(canaryService.Spec.Ports) != 1 {
+		t.Errorf("adopted canary service spec = %+v, want version v2 selector and cloned ports", canaryService.Spec)
+	}
+}
+
+func TestSyncServices_SMIUsesManagedServices(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "split.smi-spec.io", Version: "v1alpha2", Resource: "trafficsplits"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvr: "TrafficSplitList",
+	})
+	canary := newTestCanary()
+	canary.Spec.Services = &deployv1alpha1.ManagedServices{}
+
+	startWithProvider(t, canary, ProviderSMI, traffic.NewSMITrafficManager(client),
+		newSourceService(),
+		newVersionedTestDeployment("test-app", "v1"),
+		newVersionedTestDeployment("test-app-canary", "v2"),
+	)
+
+	split, err := client.Resource(gvr).Namespace("default").Get(context.Background(), "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get TrafficSplit: %v", err)
+	}
+	if root, _, _ := unstructured.NestedString(split.Object, "spec", "service"); root != "test-app" {
+		t.Errorf("root service = %s, want test-app", root)
+	}
+	backends, _, _ := unstructured.NestedSlice(split.Object, "spec", "backends")
+	weights := map[string]int64{}
+	for _, b := range backends {
+		backend := b.(map[string]interface{})
+		weights[backend["service"].(string)] = backend["weight"].(int64)
+	}
+	if want := map[string]int64{"test-app-stable": 90, "test-app-canary": 10}; !maps.Equal(weights, want) {
+		t.Errorf("backend weights = %v, want %v", weights, want)
+	}
+}
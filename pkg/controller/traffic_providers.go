@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+const (
+	ProviderIstio        = "istio"
+	ProviderNginx        = "nginx"
+	ProviderGatewayAPI   = "gatewayAPI"
+	ProviderSMI          = "smi"
+	ProviderReplicaRatio = "replicaRatio"
+	ProviderProxy        = "proxy"
+)
+
+// TrafficProviderFactory creates the traffic manager of a provider.
+type TrafficProviderFactory func() (TrafficManager, error)
+
+// TrafficProviderRegistry is a TrafficManager that hands each canary to the
+// provider selected by its spec.trafficRouting, or to the default provider.
+// Managers are created on first use, so only the clients of providers that
+// canaries actually use are needed.
+type TrafficProviderRegistry struct {
+	defaultProvider string
+	factories       map[string]TrafficProviderFactory
+
+	mu       sync.Mutex
+	managers map[string]TrafficManager
+}
+
+func NewTrafficProviderRegistry(defaultProvider string) *TrafficProviderRegistry {
+	return &TrafficProviderRegistry{
+		defaultProvider: defaultProvider,
+		factories:       make(map[string]TrafficProviderFactory),
+		managers:        make(map[string]TrafficManager),
+	}
+}
+
+func (r *TrafficProviderRegistry) Register(provider string, factory TrafficProviderFactory) {
+	r.factories[provider] = factory
+}
+
+// ProviderFor returns the provider a canary uses: the explicit
+// spec.trafficRouting.provider, else the provider whose settings section is
+// present, else the default.
+func (r *TrafficProviderRegistry) ProviderFor(canary *deployv1alpha1.CanaryDeployment) string {
+	routing := canary.Spec.TrafficRouting
+	switch {
+	case routing == nil:
+		return r.defaultProvider
+	case routing.Provider != "":
+		return routing.Provider
+	case routing.Istio != nil:
+		return ProviderIstio
+	case routing.Nginx != nil:
+		return ProviderNginx
+	case routing.GatewayAPI != nil:
+		return ProviderGatewayAPI
+	case routing.SMI != nil:
+		return ProviderSMI
+	case routing.Proxy != nil:
+		return ProviderProxy
+	default:
+		return r.defaultProvider
+	}
+}
+
+// providersFor returns every provider a canary is routed through.
+func (r *TrafficProviderRegistry) providersFor(canary *deployv1alpha1.CanaryDeployment) []string {
+	if routing := canary.Spec.TrafficRouting; routing != nil && len(routing.Providers) > 0 {
+		return routing.Providers
+	}
+	return []string{r.ProviderFor(canary)}
+}
+
+// ManagerFor returns the traffic manager of the canary's provider, creating
+// it on first use. A failed creation is retried on the next call. Canaries
+// listing several spec.trafficRouting.providers get a composite of them.
+func (r *TrafficProviderRegistry) ManagerFor(canary *deployv1alpha1.CanaryDeployment) (TrafficManager, error) {
+	if routing := canary.Spec.TrafficRouting; routing != nil && len(routing.Providers) > 0 {
+		composite := NewCompositeTrafficManager()
+		for _, provider := range routing.Providers {
+			manager, err := r.manager(provider)
+			if err != nil {
+				return nil, err
+			}
+			composite.Add(provider, manager)
+		}
+		return composite, nil
+	}
+	return r.manager(r.ProviderFor(canary))
+}
+
+func (r *TrafficProviderRegistry) manager(provider string) (TrafficManager, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if manager, ok := r.managers[provider]; ok {
+		return manager, nil
+	}
+	factory, ok := r.factories[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown traffic provider %q", provider)
+	}
+	manager, err := factory()
+	if err != nil {
+		return nil, fmt.Errorf("create %s traffic manager: %w", provider, err)
+	}
+	r.managers[provider] = manager
+	return manager, nil
+}
+
+func (r *TrafficProviderRegistry) UpdateWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) error {
+	manager, err := r.ManagerFor(canary)
+	if err != nil {
+		return err
+	}
+	return manager.UpdateWeight(ctx, canary, weight)
+}
+
+func (r *TrafficProviderRegistry) CreateCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	manager, err := r.ManagerFor(canary)
+	if err != nil {
+		return err
+	}
+	return manager.CreateCanaryRoute(ctx, canary)
+}
+
+func (r *TrafficProviderRegistry) VerifyWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) (int, error) {
+	manager, err := r.ManagerFor(canary)
+	if err != nil {
+		return 0, err
+	}
+	return manager.VerifyWeight(ctx, canary, weight)
+}
+
+func (r *TrafficProviderRegistry) UpdateMatch(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, matches []deployv1alpha1.RouteMatch) error {
+	manager, err := r.ManagerFor(canary)
+	if err != nil {
+		return err
+	}
+	return updateMatch(ctx, manager, canary, matches)
+}
+
+func (r *TrafficProviderRegistry) UpdateMirror(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, percent int) error {
+	manager, err := r.ManagerFor(canary)
+	if err != nil {
+		return err
+	}
+	return updateMirror(ctx, manager, canary, percent)
+}
+
+func (r *TrafficProviderRegistry) CleanupCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	manager, err := r.ManagerFor(canary)
+	if err != nil {
+		return err
+	}
+	return cleanupRoute(ctx, manager, canary)
+}
+
+// SyncRoutes hands every manager the canaries routed through it. Managers
+// of providers no canary uses any more are included, so that they drop the
+// routes of deleted canaries, and managers of providers only ended canaries
+// use are created, so that they restore routes lost in a restart.
+func (r *TrafficProviderRegistry) SyncRoutes(ctx context.Context, canaries []*deployv1alpha1.CanaryDeployment) error {
+	routed := make(map[string][]*deployv1alpha1.CanaryDeployment)
+	for _, canary := range canaries {
+		for _, provider := range r.providersFor(canary) {
+			routed[provider] = append(routed[provider], canary)
+		}
+	}
+
+	r.mu.Lock()
+	providers := make([]string, 0, len(r.managers))
+	for provider := range r.managers {
+		providers = append(providers, provider)
+	}
+	r.mu.Unlock()
+	for provider := range routed {
+		if _, ok := r.factories[provider]; ok && !slices.Contains(providers, provider) {
+			providers = append(providers, provider)
+		}
+	}
+	sort.Strings(providers)
+
+	var errs []error
+	for _, provider := range providers {
+		manager, err := r.manager(provider)
+		if err == nil {
+			err = syncRoutes(ctx, manager, routed[provider])
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", provider, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+func TestTrafficProviderRegistry_ProviderFor(t *testing.T) {
+	registry := NewTrafficProviderRegistry(ProviderNginx)
+
+	tests := []struct {
+		name    string
+		routing *deployv1alpha1.TrafficRouting
+		want    string
+	}{
+		{name: "no routing", want: ProviderNginx},
+		{name: "empty routing", routing: &deployv1alpha1.TrafficRouting{}, want: ProviderNginx},
+		{name: "explicit provider", routing: &deployv1alpha1.TrafficRouting{Provider: ProviderReplicaRatio}, want: ProviderReplicaRatio},
+		{name: "istio section", routing: &deployv1alpha1.TrafficRouting{Istio: &deployv1alpha1.IstioTrafficRouting{}}, want: ProviderIstio},
+		{name: "gateway api section", routing: &deployv1alpha1.TrafficRouting{GatewayAPI: &deployv1alpha1.GatewayAPITrafficRouting{}}, want: ProviderGatewayAPI},
+		{name: "smi section", routing: &deployv1alpha1.TrafficRouting{SMI: &deployv1alpha1.SMITrafficRouting{}}, want: ProviderSMI},
+		{name: "proxy section", routing: &deployv1alpha1.TrafficRouting{Proxy: &deployv1alpha1.ProxyTrafficRouting{}}, want: ProviderProxy},
+		{
+			name:    "provider wins over section",
+			routing: &deployv1alpha1.TrafficRouting{Provider: ProviderNginx, Istio: &deployv1alpha1.IstioTrafficRouting{}},
+			want:    ProviderNginx,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canary := newTestCanary()
+			canary.Spec.TrafficRouting = tt.routing
+			if got := registry.ProviderFor(canary); got != tt.want {
+				t.Errorf("ProviderFor() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrafficProviderRegistry_Dispatch(t *testing.T) {
+	istio := &mockMatchTrafficManager{}
+	nginx := &mockTrafficManager{}
+	created := map[string]int{}
+
+	registry := NewTrafficProviderRegistry(ProviderNginx)
+	registry.Register(ProviderIstio, func() (TrafficManager, error) {
+		created[ProviderIstio]++
+		return istio, nil
+	})
+	registry.Register(ProviderNginx, func() (TrafficManager, error) {
+		created[ProviderNginx]++
+		return nginx, nil
+	})
+	registry.Register(ProviderSMI, func() (TrafficManager, error) {
+		created[ProviderSMI]++
+		return nil, errors.New("smi unavailable")
+	})
+	ctx := context.Background()
+
+	meshCanary := newTestCanary()
+	meshCanary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{Provider: ProviderIstio}
+	ingressCanary := newTestCanary()
+
+	for i := 0; i < 2; i++ {
+		if err := registry.UpdateWeight(ctx, meshCanary, 20); err != nil {
+			t.Fatalf("UpdateWeight(istio) error = %v", err)
+		}
+	}
+	if err := registry.UpdateWeight(ctx, ingressCanary, 30); err != nil {
+		t.Fatalf("UpdateWeight(nginx) error = %v", err)
+	}
+
+	if istio.lastWeight != 20 || nginx.lastWeight != 30 {
+		t.Errorf("weights istio = %d, nginx = %d, want 20 and 30", istio.lastWeight, nginx.lastWeight)
+	}
+	if created[ProviderIstio] != 1 || created[ProviderNginx] != 1 {
+		t.Errorf("managers created = %v, want each provider created once", created)
+	}
+
+	matches := []deployv1alpha1.RouteMatch{{Headers: map[string]deployv1alpha1.StringMatch{"x-canary": {Exact: "true"}}}}
+	if err := registry.UpdateMatch(ctx, meshCanary, matches); err != nil || !istio.matchCalled {
+		t.Errorf("UpdateMatch(istio) error = %v, called = %v, want delegated", err, istio.matchCalled)
+	}
+	if err := registry.UpdateMatch(ctx, ingressCanary, matches); err == nil {
+		t.Error("UpdateMatch() error = nil for a provider without match routing")
+	}
+	if err := registry.UpdateMatch(ctx, ingressCanary, nil); err != nil {
+		t.Errorf("UpdateMatch(nil) error = %v, want nil for a provider without match routing", err)
+	}
+
+	failing := newTestCanary()
+	failing.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{SMI: &deployv1alpha1.SMITrafficRouting{}}
+	for i := 0; i < 2; i++ {
+		if err := registry.UpdateWeight(ctx, failing, 10); err == nil {
+			t.Error("UpdateWeight() error = nil, want the factory error")
+		}
+	}
+	if created[ProviderSMI] != 2 {
+		t.Errorf("failed factory called %d times, want a retry on each use", created[ProviderSMI])
+	}
+
+	unknown := newTestCanary()
+	unknown.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{Provider: "traefik"}
+	if err := registry.UpdateWeight(ctx, unknown, 10); err == nil {
+		t.Error("UpdateWeight() error = nil, want error for an unknown provider")
+	}
+}
+
+type mockRouteSyncer struct {
+	mockTrafficManager
+	synced [][]string
+}
+
+func (m *mockRouteSyncer) SyncRoutes(ctx context.Context, canaries []*deployv1alpha1.CanaryDeployment) error {
+	names := []string{}
+	for _, canary := range canaries {
+		names = append(names, canary.Name)
+	}
+	m.synced = append(m.synced, names)
+	return nil
+}
+
+func TestTrafficProviderRegistry_SyncRoutes(t *testing.T) {
+	proxy := &mockRouteSyncer{}
+	registry := NewTrafficProviderRegistry(ProviderNginx)
+	registry.Register(ProviderNginx, func() (TrafficManager, error) { return &mockTrafficManager{}, nil })
+	registry.Register(ProviderProxy, func() (TrafficManager, error) { return proxy, nil })
+	ctx := context.Background()
+
+	proxied := newTestCanary()
+	proxied.Name = "proxied"
+	proxied.Status.Phase = "Completed"
+	proxied.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{Proxy: &deployv1alpha1.ProxyTrafficRouting{}}
+	both := newTestCanary()
+	both.Name = "both"
+	both.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{Providers: []string{ProviderNginx, ProviderProxy}}
+	ingress := newTestCanary()
+	ingress.Name = "ingress"
+
+	if err := registry.SyncRoutes(ctx, []*deployv1alpha1.CanaryDeployment{proxied, both, ingress}); err != nil {
+		t.Fatalf("SyncRoutes() error = %v", err)
+	}
+	if err := registry.SyncRoutes(ctx, []*deployv1alpha1.CanaryDeployment{ingress}); err != nil {
+		t.Fatalf("SyncRoutes() after deletion error = %v", err)
+	}
+
+	want := [][]string{{"proxied", "both"}, {}}
+	if !reflect.DeepEqual(proxy.synced, want) {
+		t.Errorf("synced canaries = %v, want %v", proxy.synced, want)
+	}
+}
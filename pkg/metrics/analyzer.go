@@ -7,11 +7,11 @@ import (
 
 	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
 	"github.com/codefarmer009/codedance/pkg/controller"
+	"github.com/codefarmer009/codedance/pkg/workload"
 	promapi "github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -68,6 +68,12 @@ func (m *PrometheusAnalyzer) Collect(ctx context.Context, canary *deployv1alpha1
 	}
 	metrics.ErrorRate = errorRate
 
+	requestRate, err := m.queryRequestRate(ctx, canary)
+	if err != nil {
+		return nil, err
+	}
+	metrics.RequestRate = requestRate
+
 	podHealth, err := m.queryPodHealth(ctx, canary)
 	if err != nil {
 		return nil, err
@@ -109,8 +115,11 @@ func (m *PrometheusAnalyzer) queryLatency(ctx context.Context, canary *deployv1a
 	if query == "" {
 		query = fmt.Sprintf(`
 			histogram_quantile(0.99,
-				sum(rate(http_request_duration_seconds_bucket{app="%s"}[5m])) by (le))
-		`, canary.Name)
+				sum(rate(http_request_duration_seconds_bucket{
+					app="%s",
+					version="%s"
+				}[5m])) by (le))
+		`, canary.Name, canary.Spec.CanaryVersion)
 	}
 
 	result, _, err := m.promClient.Query(ctx, query, time.Now())
@@ -149,6 +158,25 @@ func (m *PrometheusAnalyzer) queryErrorRate(ctx context.Context, canary *deployv
 	return parseFloatFromResult(result), nil
 }
 
+func (m *PrometheusAnalyzer) queryRequestRate(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) (float64, error) {
+	query := canary.Spec.Metrics.RequestRate.Query
+	if query == "" {
+		query = fmt.Sprintf(`
+			sum(rate(http_requests_total{
+				app="%s",
+				version="%s"
+			}[5m]))
+		`, canary.Name, canary.Spec.CanaryVersion)
+	}
+
+	result, _, err := m.promClient.Query(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return parseFloatFromResult(result), nil
+}
+
 func (m *PrometheusAnalyzer) queryPodHealth(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) (controller.PodHealthMetrics, error) {
 	if m.clientset == nil {
 		return controller.PodHealthMetrics{
@@ -158,22 +186,18 @@ func (m *PrometheusAnalyzer) queryPodHealth(ctx context.Context, canary *deployv
 		}, nil
 	}
 
-	deploymentName := canary.Spec.TargetDeployment + "-canary"
-	deployment, err := m.clientset.AppsV1().Deployments(canary.Namespace).Get(ctx, deploymentName, metav1.GetOptions{})
+	target, err := workload.New(m.clientset, canary)
 	if err != nil {
-		return controller.PodHealthMetrics{}, fmt.Errorf("failed to get canary deployment: %w", err)
+		return controller.PodHealthMetrics{}, err
 	}
 
-	selector := metav1.FormatLabelSelector(deployment.Spec.Selector)
-	pods, err := m.clientset.CoreV1().Pods(canary.Namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: selector,
-	})
+	pods, err := target.CanaryPods(ctx)
 	if err != nil {
-		return controller.PodHealthMetrics{}, fmt.Errorf("failed to list pods: %w", err)
+		return controller.PodHealthMetrics{}, err
 	}
 
 	podHealth := controller.PodHealthMetrics{}
-	for _, pod := range pods.Items {
+	for _, pod := range pods {
 		switch pod.Status.Phase {
 		case corev1.PodRunning:
 			if isPodReady(&pod) {
@@ -0,0 +1,109 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+const (
+	defaultMinStepSize       = 5
+	defaultMaxStepSize       = 50
+	defaultTargetRequestRate = 10.0
+
+	// continueScore is the lowest health score for which the decision engine
+	// lets a rollout continue; scores above it measure how much headroom the
+	// canary has left.
+	continueScore = 90
+)
+
+// AdaptiveStrategy starts at StartWeight and lets NextWeight size every
+// following step from the health score and observed request rate.
+type AdaptiveStrategy struct {
+	StartWeight       int
+	MinStepSize       int
+	MaxStepSize       int
+	TargetRequestRate float64
+	StepInterval      string
+}
+
+func NewAdaptiveStrategy() *AdaptiveStrategy {
+	return &AdaptiveStrategy{}
+}
+
+func NewAdaptiveStrategyFromSpec(spec deployv1alpha1.DeployStrategy) *AdaptiveStrategy {
+	s := &AdaptiveStrategy{
+		StartWeight:  spec.StartWeight,
+		StepInterval: spec.StepInterval,
+	}
+	if spec.Adaptive != nil {
+		s.MinStepSize = spec.Adaptive.MinStepSize
+		s.MaxStepSize = spec.Adaptive.MaxStepSize
+		s.TargetRequestRate = spec.Adaptive.TargetRequestRate
+	}
+	return s
+}
+
+// GenerateSteps returns the first step only; later steps are produced by
+// NextWeight as the rollout progresses.
+func (s *AdaptiveStrategy) GenerateSteps() ([]deployv1alpha1.DeployStep, error) {
+	minStep, maxStep := s.stepBounds()
+	if minStep <= 0 || maxStep < minStep || maxStep > 100 {
+		return nil, fmt.Errorf("invalid adaptive step bounds [%d, %d]", minStep, maxStep)
+	}
+
+	interval := s.StepInterval
+	if interval == "" {
+		interval = defaultStepInterval
+	}
+	if _, err := time.ParseDuration(interval); err != nil {
+		return nil, fmt.Errorf("invalid stepInterval %q: %w", interval, err)
+	}
+
+	startWeight := valueOrDefault(s.StartWeight, minStep)
+	if err := validateWeightRange(startWeight, 100); err != nil {
+		return nil, err
+	}
+
+	return []deployv1alpha1.DeployStep{{Weight: startWeight, Pause: interval}}, nil
+}
+
+// NextWeight scales the step size with both the health score above the
+// continue threshold and how close the request rate is to the target, so
+// clearly healthy canaries with plenty of traffic take the largest steps.
+func (s *AdaptiveStrategy) NextWeight(currentWeight, score int, requestRate float64) int {
+	minStep, maxStep := s.stepBounds()
+
+	health := clamp01(float64(score-continueScore) / float64(100-continueScore))
+
+	confidence := 1.0
+	target := s.TargetRequestRate
+	if target == 0 {
+		target = defaultTargetRequestRate
+	}
+	if target > 0 {
+		confidence = clamp01(requestRate / target)
+	}
+
+	size := minStep + int(math.Round(float64(maxStep-minStep)*health*confidence))
+	if next := currentWeight + size; next < 100 {
+		return next
+	}
+	return 100
+}
+
+func (s *AdaptiveStrategy) stepBounds() (int, int) {
+	return valueOrDefault(s.MinStepSize, defaultMinStepSize), valueOrDefault(s.MaxStepSize, defaultMaxStepSize)
+}
+
+func clamp01(v float64) float64 {
+	if math.IsNaN(v) || v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
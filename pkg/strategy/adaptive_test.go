@@ -0,0 +1,87 @@
+package strategy
+
+import (
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+func TestAdaptiveStrategy_GenerateSteps(t *testing.T) {
+	strategy := NewAdaptiveStrategyFromSpec(deployv1alpha1.DeployStrategy{
+		Type:         TypeAdaptive,
+		StepInterval: "15m",
+		Adaptive:     &deployv1alpha1.AdaptiveStrategy{MinStepSize: 2, MaxStepSize: 40},
+	})
+
+	steps, err := strategy.GenerateSteps()
+	if err != nil {
+		t.Fatalf("GenerateSteps() error = %v", err)
+	}
+	if len(steps) != 1 {
+		t.Fatalf("GenerateSteps() returned %d steps, want 1", len(steps))
+	}
+	if steps[0].Weight != 2 || steps[0].Pause != "15m" {
+		t.Errorf("First step = %+v, want weight 2 pause 15m", steps[0])
+	}
+
+	invalid := &AdaptiveStrategy{MinStepSize: 30, MaxStepSize: 10}
+	if _, err := invalid.GenerateSteps(); err == nil {
+		t.Error("GenerateSteps() with min > max error = nil, want error")
+	}
+}
+
+func TestAdaptiveStrategy_NextWeight(t *testing.T) {
+	strategy := &AdaptiveStrategy{MinStepSize: 5, MaxStepSize: 45, TargetRequestRate: 100}
+
+	tests := []struct {
+		name        string
+		current     int
+		score       int
+		requestRate float64
+		want        int
+	}{
+		{
+			name:        "healthy with plenty of traffic takes max step",
+			current:     10,
+			score:       100,
+			requestRate: 500,
+			want:        55,
+		},
+		{
+			name:        "marginal score takes min step",
+			current:     10,
+			score:       90,
+			requestRate: 500,
+			want:        15,
+		},
+		{
+			name:        "healthy but little traffic stays small",
+			current:     10,
+			score:       100,
+			requestRate: 25,
+			want:        25,
+		},
+		{
+			name:        "no traffic takes min step",
+			current:     10,
+			score:       100,
+			requestRate: 0,
+			want:        15,
+		},
+		{
+			name:        "capped at 100",
+			current:     80,
+			score:       100,
+			requestRate: 500,
+			want:        100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strategy.NextWeight(tt.current, tt.score, tt.requestRate); got != tt.want {
+				t.Errorf("NextWeight() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package strategy
+
+import (
+	"fmt"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+const defaultPreviewDuration = "10m"
+
+// BlueGreenStrategy keeps the new version at 0% live traffic while it is
+// analysed through the preview service, then cuts over to 100% in one step.
+type BlueGreenStrategy struct {
+	PreviewDuration string
+}
+
+func NewBlueGreenStrategy() *BlueGreenStrategy {
+	return &BlueGreenStrategy{}
+}
+
+func NewBlueGreenStrategyFromSpec(spec deployv1alpha1.DeployStrategy) *BlueGreenStrategy {
+	s := &BlueGreenStrategy{}
+	if spec.BlueGreen != nil {
+		s.PreviewDuration = spec.BlueGreen.PreviewDuration
+	}
+	return s
+}
+
+func (s *BlueGreenStrategy) GenerateSteps() ([]deployv1alpha1.DeployStep, error) {
+	duration := s.PreviewDuration
+	if duration == "" {
+		duration = defaultPreviewDuration
+	}
+	if _, err := time.ParseDuration(duration); err != nil {
+		return nil, fmt.Errorf("invalid previewDuration %q: %w", duration, err)
+	}
+
+	return []deployv1alpha1.DeployStep{
+		{Weight: 0, Pause: duration},
+		{Weight: 100, Pause: "0"},
+	}, nil
+}
@@ -0,0 +1,35 @@
+package strategy
+
+import (
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+func TestBlueGreenStrategy_GenerateSteps(t *testing.T) {
+	strategy := NewBlueGreenStrategyFromSpec(deployv1alpha1.DeployStrategy{
+		Type:      TypeBlueGreen,
+		BlueGreen: &deployv1alpha1.BlueGreenStrategy{PreviewDuration: "20m"},
+	})
+
+	steps, err := strategy.GenerateSteps()
+	if err != nil {
+		t.Fatalf("GenerateSteps() error = %v", err)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("GenerateSteps() returned %d steps, want 2", len(steps))
+	}
+	if steps[0].Weight != 0 || steps[0].Pause != "20m" {
+		t.Errorf("Preview step = %+v, want weight 0 pause 20m", steps[0])
+	}
+	if steps[1].Weight != 100 {
+		t.Errorf("Cutover step weight = %d, want 100", steps[1].Weight)
+	}
+}
+
+func TestBlueGreenStrategy_GenerateSteps_InvalidDuration(t *testing.T) {
+	strategy := &BlueGreenStrategy{PreviewDuration: "later"}
+	if _, err := strategy.GenerateSteps(); err == nil {
+		t.Error("GenerateSteps() error = nil, want error")
+	}
+}
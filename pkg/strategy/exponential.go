@@ -1,22 +1,76 @@
 package strategy
 
 import (
+	"fmt"
+	"math"
+
 	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
 )
 
-type ExponentialStrategy struct{}
+const defaultGrowthFactor = 2.0
+
+// ExponentialStrategy multiplies the weight by GrowthFactor on every step,
+// i.e. a factor of 2 doubles the weight and 1.5 raises it by half.
+type ExponentialStrategy struct {
+	StartWeight  int
+	GrowthFactor float64
+	MaxWeight    int
+	StepInterval string
+	StepCount    int
+}
 
 func NewExponentialStrategy() *ExponentialStrategy {
 	return &ExponentialStrategy{}
 }
 
-func (s *ExponentialStrategy) GenerateSteps() []deployv1alpha1.DeployStep {
-	return []deployv1alpha1.DeployStep{
-		{Weight: 1, Pause: "5m"},
-		{Weight: 5, Pause: "5m"},
-		{Weight: 10, Pause: "10m"},
-		{Weight: 25, Pause: "10m"},
-		{Weight: 50, Pause: "15m"},
-		{Weight: 100, Pause: "0"},
+func NewExponentialStrategyFromSpec(spec deployv1alpha1.DeployStrategy) *ExponentialStrategy {
+	return &ExponentialStrategy{
+		StartWeight:  spec.StartWeight,
+		GrowthFactor: spec.GrowthFactor,
+		MaxWeight:    spec.MaxWeight,
+		StepInterval: spec.StepInterval,
+		StepCount:    spec.StepCount,
+	}
+}
+
+func (s *ExponentialStrategy) GenerateSteps() ([]deployv1alpha1.DeployStep, error) {
+	if *s == (ExponentialStrategy{}) {
+		return []deployv1alpha1.DeployStep{
+			{Weight: 1, Pause: "5m"},
+			{Weight: 5, Pause: "5m"},
+			{Weight: 10, Pause: "10m"},
+			{Weight: 25, Pause: "10m"},
+			{Weight: 50, Pause: "15m"},
+			{Weight: 100, Pause: "0"},
+		}, nil
+	}
+
+	maxWeight := valueOrDefault(s.MaxWeight, 100)
+	startWeight := valueOrDefault(s.StartWeight, 1)
+	if err := validateWeightRange(startWeight, maxWeight); err != nil {
+		return nil, err
+	}
+
+	growth := s.GrowthFactor
+	if growth == 0 {
+		growth = defaultGrowthFactor
+		if rampSteps := rampStepCount(s.StepCount, maxWeight); rampSteps > 1 && startWeight < maxWeight {
+			growth = math.Pow(float64(maxWeight)/float64(startWeight), 1/float64(rampSteps-1))
+		}
+	}
+	if growth <= 1 || math.IsNaN(growth) || math.IsInf(growth, 0) {
+		return nil, fmt.Errorf("growthFactor must be greater than 1, got %v", growth)
 	}
+
+	weights := []int{}
+	for w := startWeight; w < maxWeight; {
+		weights = append(weights, w)
+		next := int(math.Ceil(float64(w)*growth - 1e-9))
+		if next <= w {
+			next = w + 1
+		}
+		w = next
+	}
+
+	return buildSteps(weights, maxWeight, s.StepInterval, s.StepCount)
 }
@@ -6,7 +6,10 @@ import (
 
 func TestExponentialStrategy_GenerateSteps(t *testing.T) {
 	strategy := NewExponentialStrategy()
-	steps := strategy.GenerateSteps()
+	steps, err := strategy.GenerateSteps()
+	if err != nil {
+		t.Fatalf("GenerateSteps() error = %v", err)
+	}
 
 	if len(steps) == 0 {
 		t.Fatal("GenerateSteps() returned empty steps")
@@ -44,3 +47,85 @@ func TestExponentialStrategy_GenerateSteps(t *testing.T) {
 		t.Errorf("First exponential step weight = %d, expected < 5", steps[0].Weight)
 	}
 }
+
+func TestExponentialStrategy_GenerateSteps_Parameterized(t *testing.T) {
+	tests := []struct {
+		name        string
+		strategy    *ExponentialStrategy
+		wantWeights []int
+	}{
+		{
+			name:        "default growth doubles weight",
+			strategy:    &ExponentialStrategy{StartWeight: 5},
+			wantWeights: []int{5, 10, 20, 40, 80, 100},
+		},
+		{
+			name:        "growth by half",
+			strategy:    &ExponentialStrategy{StartWeight: 10, GrowthFactor: 1.5},
+			wantWeights: []int{10, 15, 23, 35, 53, 80, 100},
+		},
+		{
+			name:        "triple growth",
+			strategy:    &ExponentialStrategy{StartWeight: 1, GrowthFactor: 3},
+			wantWeights: []int{1, 3, 9, 27, 81, 100},
+		},
+		{
+			name:        "step count derives growth",
+			strategy:    &ExponentialStrategy{StartWeight: 1, StepCount: 3},
+			wantWeights: []int{1, 10, 100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := tt.strategy.GenerateSteps()
+			if err != nil {
+				t.Fatalf("GenerateSteps() error = %v", err)
+			}
+			if len(steps) != len(tt.wantWeights) {
+				t.Fatalf("GenerateSteps() returned %d steps, want %d", len(steps), len(tt.wantWeights))
+			}
+			for i, step := range steps {
+				if step.Weight != tt.wantWeights[i] {
+					t.Errorf("Step %d weight = %d, want %d", i, step.Weight, tt.wantWeights[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExponentialStrategy_GenerateSteps_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy *ExponentialStrategy
+	}{
+		{
+			name:     "step count too small to reach 100",
+			strategy: &ExponentialStrategy{StartWeight: 1, GrowthFactor: 2, StepCount: 4},
+		},
+		{
+			name:     "growth of 1 never grows",
+			strategy: &ExponentialStrategy{StartWeight: 1, GrowthFactor: 1},
+		},
+		{
+			name:     "growth below 1 shrinks",
+			strategy: &ExponentialStrategy{StartWeight: 1, GrowthFactor: 0.5},
+		},
+		{
+			name:     "negative growth",
+			strategy: &ExponentialStrategy{StartWeight: 1, GrowthFactor: -0.5},
+		},
+		{
+			name:     "max weight above 100",
+			strategy: &ExponentialStrategy{StartWeight: 1, MaxWeight: 120},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.strategy.GenerateSteps(); err == nil {
+				t.Error("GenerateSteps() error = nil, want error")
+			}
+		})
+	}
+}
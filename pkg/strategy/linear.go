@@ -1,22 +1,71 @@
 package strategy
 
 import (
+	"fmt"
+
 	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
 )
 
-type LinearStrategy struct{}
+const defaultLinearIncrement = 10
+
+type LinearStrategy struct {
+	StartWeight   int
+	StepIncrement int
+	MaxWeight     int
+	StepInterval  string
+	StepCount     int
+}
 
 func NewLinearStrategy() *LinearStrategy {
 	return &LinearStrategy{}
 }
 
-func (s *LinearStrategy) GenerateSteps() []deployv1alpha1.DeployStep {
-	return []deployv1alpha1.DeployStep{
-		{Weight: 5, Pause: "5m"},
-		{Weight: 10, Pause: "5m"},
-		{Weight: 25, Pause: "10m"},
-		{Weight: 50, Pause: "10m"},
-		{Weight: 75, Pause: "10m"},
-		{Weight: 100, Pause: "0"},
+func NewLinearStrategyFromSpec(spec deployv1alpha1.DeployStrategy) *LinearStrategy {
+	return &LinearStrategy{
+		StartWeight:   spec.StartWeight,
+		StepIncrement: spec.StepIncrement,
+		MaxWeight:     spec.MaxWeight,
+		StepInterval:  spec.StepInterval,
+		StepCount:     spec.StepCount,
+	}
+}
+
+func (s *LinearStrategy) GenerateSteps() ([]deployv1alpha1.DeployStep, error) {
+	if *s == (LinearStrategy{}) {
+		return []deployv1alpha1.DeployStep{
+			{Weight: 5, Pause: "5m"},
+			{Weight: 10, Pause: "5m"},
+			{Weight: 25, Pause: "10m"},
+			{Weight: 50, Pause: "10m"},
+			{Weight: 75, Pause: "10m"},
+			{Weight: 100, Pause: "0"},
+		}, nil
+	}
+
+	maxWeight := valueOrDefault(s.MaxWeight, 100)
+	increment := s.StepIncrement
+	startWeight := s.StartWeight
+	if startWeight == 0 {
+		startWeight = valueOrDefault(increment, defaultLinearIncrement)
 	}
+
+	if increment == 0 {
+		increment = defaultLinearIncrement
+		if rampSteps := rampStepCount(s.StepCount, maxWeight); rampSteps > 1 {
+			increment = max(1, ceilDiv(maxWeight-startWeight, rampSteps-1))
+		}
+	}
+	if increment <= 0 {
+		return nil, fmt.Errorf("stepIncrement must be positive, got %d", increment)
+	}
+	if err := validateWeightRange(startWeight, maxWeight); err != nil {
+		return nil, err
+	}
+
+	weights := []int{}
+	for w := startWeight; w < maxWeight; w += increment {
+		weights = append(weights, w)
+	}
+
+	return buildSteps(weights, maxWeight, s.StepInterval, s.StepCount)
 }
@@ -6,7 +6,10 @@ import (
 
 func TestLinearStrategy_GenerateSteps(t *testing.T) {
 	strategy := NewLinearStrategy()
-	steps := strategy.GenerateSteps()
+	steps, err := strategy.GenerateSteps()
+	if err != nil {
+		t.Fatalf("GenerateSteps() error = %v", err)
+	}
 
 	if len(steps) == 0 {
 		t.Fatal("GenerateSteps() returned empty steps")
@@ -39,3 +42,86 @@ func TestLinearStrategy_GenerateSteps(t *testing.T) {
 		t.Errorf("Last step weight = %d, want 100", steps[len(steps)-1].Weight)
 	}
 }
+
+func TestLinearStrategy_GenerateSteps_Parameterized(t *testing.T) {
+	tests := []struct {
+		name        string
+		strategy    *LinearStrategy
+		wantWeights []int
+		wantPause   string
+	}{
+		{
+			name:        "start and increment",
+			strategy:    &LinearStrategy{StartWeight: 20, StepIncrement: 20, StepInterval: "30m"},
+			wantWeights: []int{20, 40, 60, 80, 100},
+			wantPause:   "30m",
+		},
+		{
+			name:        "step count derives increment",
+			strategy:    &LinearStrategy{StartWeight: 25, StepCount: 4},
+			wantWeights: []int{25, 50, 75, 100},
+			wantPause:   "5m",
+		},
+		{
+			name:        "max weight below 100 appends final step",
+			strategy:    &LinearStrategy{StartWeight: 10, StepIncrement: 20, MaxWeight: 50},
+			wantWeights: []int{10, 30, 50, 100},
+			wantPause:   "5m",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := tt.strategy.GenerateSteps()
+			if err != nil {
+				t.Fatalf("GenerateSteps() error = %v", err)
+			}
+			if len(steps) != len(tt.wantWeights) {
+				t.Fatalf("GenerateSteps() returned %d steps, want %d", len(steps), len(tt.wantWeights))
+			}
+			for i, step := range steps {
+				if step.Weight != tt.wantWeights[i] {
+					t.Errorf("Step %d weight = %d, want %d", i, step.Weight, tt.wantWeights[i])
+				}
+			}
+			if steps[0].Pause != tt.wantPause {
+				t.Errorf("Step 0 pause = %s, want %s", steps[0].Pause, tt.wantPause)
+			}
+			if steps[len(steps)-1].Pause != "0" {
+				t.Errorf("Last step pause = %s, want 0", steps[len(steps)-1].Pause)
+			}
+		})
+	}
+}
+
+func TestLinearStrategy_GenerateSteps_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy *LinearStrategy
+	}{
+		{
+			name:     "step count too small to reach 100",
+			strategy: &LinearStrategy{StartWeight: 10, StepIncrement: 10, StepCount: 3},
+		},
+		{
+			name:     "start above max weight",
+			strategy: &LinearStrategy{StartWeight: 60, MaxWeight: 50},
+		},
+		{
+			name:     "negative increment",
+			strategy: &LinearStrategy{StartWeight: 10, StepIncrement: -5},
+		},
+		{
+			name:     "invalid step interval",
+			strategy: &LinearStrategy{StartWeight: 10, StepInterval: "soon"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.strategy.GenerateSteps(); err == nil {
+				t.Error("GenerateSteps() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package strategy
+
+import (
+	"fmt"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+const (
+	TypeLinear      = "Linear"
+	TypeExponential = "Exponential"
+	TypeManual      = "Manual"
+	TypeBlueGreen   = "BlueGreen"
+	TypeAdaptive    = "Adaptive"
+)
+
+const defaultStepInterval = "5m"
+
+type Strategy interface {
+	GenerateSteps() ([]deployv1alpha1.DeployStep, error)
+}
+
+// ResolveSteps returns the explicit steps of the strategy, or generates them
+// from the strategy parameters when none are given. BlueGreen and Adaptive
+// always generate their steps and reject explicit ones.
+func ResolveSteps(spec deployv1alpha1.DeployStrategy) ([]deployv1alpha1.DeployStep, error) {
+	if (spec.Type == TypeBlueGreen || spec.Type == TypeAdaptive) && len(spec.Steps) > 0 {
+		return nil, fmt.Errorf("strategy type %q generates its own steps and does not accept explicit steps", spec.Type)
+	}
+
+	switch spec.Type {
+	case TypeBlueGreen:
+		return NewBlueGreenStrategyFromSpec(spec).GenerateSteps()
+	case TypeAdaptive:
+		return NewAdaptiveStrategyFromSpec(spec).GenerateSteps()
+	}
+	if len(spec.Steps) > 0 {
+		return spec.Steps, nil
+	}
+
+	var s Strategy
+	switch spec.Type {
+	case TypeLinear:
+		s = NewLinearStrategyFromSpec(spec)
+	case TypeExponential:
+		s = NewExponentialStrategyFromSpec(spec)
+	default:
+		return nil, fmt.Errorf("strategy type %q requires explicit steps", spec.Type)
+	}
+
+	return s.GenerateSteps()
+}
+
+func buildSteps(weights []int, maxWeight int, interval string, stepCount int) ([]deployv1alpha1.DeployStep, error) {
+	if interval == "" {
+		interval = defaultStepInterval
+	}
+	if _, err := time.ParseDuration(interval); err != nil {
+		return nil, fmt.Errorf("invalid stepInterval %q: %w", interval, err)
+	}
+
+	weights = append(weights, maxWeight)
+	if maxWeight < 100 {
+		weights = append(weights, 100)
+	}
+
+	if stepCount > 0 && len(weights) > stepCount {
+		return nil, fmt.Errorf("strategy needs %d steps to reach 100%%, exceeds stepCount %d", len(weights), stepCount)
+	}
+
+	steps := make([]deployv1alpha1.DeployStep, 0, len(weights))
+	for _, w := range weights {
+		steps = append(steps, deployv1alpha1.DeployStep{Weight: w, Pause: interval})
+	}
+	steps[len(steps)-1].Pause = "0"
+
+	if err := validateSteps(steps); err != nil {
+		return nil, err
+	}
+
+	return steps, nil
+}
+
+func validateSteps(steps []deployv1alpha1.DeployStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("no steps generated")
+	}
+	for i := 1; i < len(steps); i++ {
+		if steps[i].Weight <= steps[i-1].Weight {
+			return fmt.Errorf("step %d weight %d is not greater than previous weight %d",
+				i, steps[i].Weight, steps[i-1].Weight)
+		}
+	}
+	if last := steps[len(steps)-1].Weight; last != 100 {
+		return fmt.Errorf("steps must terminate at 100, got %d", last)
+	}
+	return nil
+}
+
+func validateWeightRange(startWeight, maxWeight int) error {
+	if maxWeight <= 0 || maxWeight > 100 {
+		return fmt.Errorf("maxWeight must be within (0, 100], got %d", maxWeight)
+	}
+	if startWeight <= 0 || startWeight > maxWeight {
+		return fmt.Errorf("startWeight must be within (0, maxWeight %d], got %d", maxWeight, startWeight)
+	}
+	return nil
+}
+
+// rampStepCount returns how many of stepCount steps are available for the
+// ramp up to maxWeight, leaving room for the final 100% step.
+func rampStepCount(stepCount, maxWeight int) int {
+	if stepCount > 0 && maxWeight < 100 {
+		return stepCount - 1
+	}
+	return stepCount
+}
+
+func valueOrDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
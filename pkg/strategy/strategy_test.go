@@ -0,0 +1,69 @@
+package strategy
+
+import (
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+func TestResolveSteps(t *testing.T) {
+	explicit := []deployv1alpha1.DeployStep{
+		{Weight: 50, Pause: "1m"},
+		{Weight: 100, Pause: "0"},
+	}
+
+	tests := []struct {
+		name        string
+		spec        deployv1alpha1.DeployStrategy
+		wantWeights []int
+		wantErr     bool
+	}{
+		{
+			name:        "explicit steps are returned as is",
+			spec:        deployv1alpha1.DeployStrategy{Type: TypeLinear, Steps: explicit, StartWeight: 10},
+			wantWeights: []int{50, 100},
+		},
+		{
+			name:        "linear parameters generate steps",
+			spec:        deployv1alpha1.DeployStrategy{Type: TypeLinear, StartWeight: 50, StepIncrement: 50},
+			wantWeights: []int{50, 100},
+		},
+		{
+			name:        "exponential parameters generate steps",
+			spec:        deployv1alpha1.DeployStrategy{Type: TypeExponential, StartWeight: 25},
+			wantWeights: []int{25, 50, 100},
+		},
+		{
+			name:    "blue/green strategy with explicit steps",
+			spec:    deployv1alpha1.DeployStrategy{Type: TypeBlueGreen, Steps: explicit},
+			wantErr: true,
+		},
+		{
+			name:    "adaptive strategy with explicit steps",
+			spec:    deployv1alpha1.DeployStrategy{Type: TypeAdaptive, Steps: explicit},
+			wantErr: true,
+		},
+		{
+			name:    "manual strategy without steps",
+			spec:    deployv1alpha1.DeployStrategy{Type: TypeManual},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := ResolveSteps(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveSteps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(steps) != len(tt.wantWeights) {
+				t.Fatalf("ResolveSteps() returned %d steps, want %d", len(steps), len(tt.wantWeights))
+			}
+			for i, step := range steps {
+				if step.Weight != tt.wantWeights[i] {
+					t.Errorf("Step %d weight = %d, want %d", i, step.Weight, tt.wantWeights[i])
+				}
+			}
+		})
+	}
+}
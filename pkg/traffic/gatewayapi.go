@@ -0,0 +1,281 @@
+package traffic
+
+import (
+	"context"
+	"fmt"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/workload"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const gatewayAPIVersion = "gateway.networking.k8s.io/v1"
+
+var (
+	httpRouteGVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+	grpcRouteGVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "grpcroutes"}
+)
+
+// GatewayAPITrafficManager splits traffic through the backendRefs weights of
+// Gateway API HTTPRoutes and GRPCRoutes. Routes are handled as unstructured
+// objects, so any Gateway API implementation serving v1 works.
+type GatewayAPITrafficManager struct {
+	dynamicClient dynamic.Interface
+}
+
+func NewGatewayAPITrafficManager(dynamicClient dynamic.Interface) *GatewayAPITrafficManager {
+	return &GatewayAPITrafficManager{
+		dynamicClient: dynamicClient,
+	}
+}
+
+type gatewayRoute struct {
+	gvr  schema.GroupVersionResource
+	kind string
+	name string
+}
+
+// UpdateWeight sets the weights of the stable and canary backendRefs in every
+// rule that routes to the stable Service, adding the canary backendRef where
+// it is missing. Other rules and backendRefs are left alone.
+func (m *GatewayAPITrafficManager) UpdateWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) error {
+	for _, route := range gatewayRoutes(canary) {
+		client := m.dynamicClient.Resource(route.gvr).Namespace(canary.Namespace)
+		obj, err := client.Get(ctx, route.name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get %s %s: %w", route.kind, route.name, err)
+		}
+
+		rules, _, err := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		if err != nil {
+			return fmt.Errorf("invalid rules in %s %s: %w", route.kind, route.name, err)
+		}
+
+		managed := 0
+		for _, r := range rules {
+			rule, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			refs, _ := rule["backendRefs"].([]interface{})
+			stable := findBackendRef(refs, stableServiceName(canary), canary.Namespace)
+			if stable == nil {
+				continue
+			}
+			canaryRef := findBackendRef(refs, canaryServiceName(canary), canary.Namespace)
+			if canaryRef == nil {
+				canaryRef = map[string]interface{}{"name": canaryServiceName(canary)}
+				if port, ok := stable["port"]; ok {
+					canaryRef["port"] = port
+				}
+				rule["backendRefs"] = append(refs, canaryRef)
+			}
+			stable["weight"] = int64(100 - weight)
+			canaryRef["weight"] = int64(weight)
+			managed++
+		}
+		if managed == 0 {
+			return fmt.Errorf("%s %s has no rule with a backendRef to service %s", route.kind, route.name, stableServiceName(canary))
+		}
+
+		if err := unstructured.SetNestedSlice(obj.Object, rules, "spec", "rules"); err != nil {
+			return err
+		}
+		if _, err := client.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("update %s %s: %w", route.kind, route.name, err)
+		}
+	}
+	return nil
+}
+
+// VerifyWeight reads the canary weight back from every rule of the
+// configured routes that has a backendRef to the stable Service.
+func (m *GatewayAPITrafficManager) VerifyWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) (int, error) {
+	var observed []int
+	for _, route := range gatewayRoutes(canary) {
+		obj, err := m.dynamicClient.Resource(route.gvr).Namespace(canary.Namespace).Get(ctx, route.name, metav1.GetOptions{})
+		if err != nil {
+			return 0, fmt.Errorf("failed to get %s %s: %w", route.kind, route.name, err)
+		}
+
+		rules, _, err := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		if err != nil {
+			return 0, fmt.Errorf("invalid rules in %s %s: %w", route.kind, route.name, err)
+		}
+		for _, r := range rules {
+			rule, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			refs, _ := rule["backendRefs"].([]interface{})
+			stable := findBackendRef(refs, stableServiceName(canary), canary.Namespace)
+			if stable == nil {
+				continue
+			}
+			var canaryWeight int64
+			if canaryRef := findBackendRef(refs, canaryServiceName(canary), canary.Namespace); canaryRef != nil {
+				canaryWeight = backendRefWeight(canaryRef)
+			}
+			observed = append(observed, canaryPercent(backendRefWeight(stable), canaryWeight))
+		}
+	}
+	return divergingWeight(weight, observed), nil
+}
+
+// CreateCanaryRoute creates each configured route that does not exist yet,
+// with a single rule sending all traffic to the stable Service.
+func (m *GatewayAPITrafficManager) CreateCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	routing := gatewayRouting(canary)
+	port := int64(routing.Port)
+	if port == 0 {
+		port = 80
+	}
+
+	parentRefs := make([]interface{}, 0, len(routing.ParentRefs))
+	for _, ref := range routing.ParentRefs {
+		parentRefs = append(parentRefs, parentRefObject(ref))
+	}
+	hostnames := make([]interface{}, 0, len(routing.Hostnames))
+	for _, hostname := range routing.Hostnames {
+		hostnames = append(hostnames, hostname)
+	}
+
+	for _, route := range gatewayRoutes(canary) {
+		client := m.dynamicClient.Resource(route.gvr).Namespace(canary.Namespace)
+		_, err := client.Get(ctx, route.name, metav1.GetOptions{})
+		if err == nil {
+			continue
+		}
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get %s %s: %w", route.kind, route.name, err)
+		}
+
+		spec := map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{
+					"backendRefs": []interface{}{
+						map[string]interface{}{"name": stableServiceName(canary), "port": port, "weight": int64(100)},
+						map[string]interface{}{"name": canaryServiceName(canary), "port": port, "weight": int64(0)},
+					},
+				},
+			},
+		}
+		if len(parentRefs) > 0 {
+			spec["parentRefs"] = parentRefs
+		}
+		if len(hostnames) > 0 {
+			spec["hostnames"] = hostnames
+		}
+
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": gatewayAPIVersion,
+			"kind":       route.kind,
+			"metadata": map[string]interface{}{
+				"name":      route.name,
+				"namespace": canary.Namespace,
+			},
+			"spec": spec,
+		}}
+		if _, err := client.Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("create %s %s: %w", route.kind, route.name, err)
+		}
+	}
+	return nil
+}
+
+func gatewayRouting(canary *deployv1alpha1.CanaryDeployment) *deployv1alpha1.GatewayAPITrafficRouting {
+	if routing := canary.Spec.TrafficRouting; routing != nil && routing.GatewayAPI != nil {
+		return routing.GatewayAPI
+	}
+	return &deployv1alpha1.GatewayAPITrafficRouting{}
+}
+
+func gatewayRoutes(canary *deployv1alpha1.CanaryDeployment) []gatewayRoute {
+	routing := gatewayRouting(canary)
+	var routes []gatewayRoute
+	if routing.HTTPRoute != "" {
+		routes = append(routes, gatewayRoute{gvr: httpRouteGVR, kind: "HTTPRoute", name: routing.HTTPRoute})
+	}
+	if routing.GRPCRoute != "" {
+		routes = append(routes, gatewayRoute{gvr: grpcRouteGVR, kind: "GRPCRoute", name: routing.GRPCRoute})
+	}
+	if len(routes) == 0 {
+		routes = append(routes, gatewayRoute{gvr: httpRouteGVR, kind: "HTTPRoute", name: canary.Name})
+	}
+	return routes
+}
+
+func stableServiceName(canary *deployv1alpha1.CanaryDeployment) string {
+	if name := gatewayRouting(canary).StableService; name != "" {
+		return name
+	}
+	_, stable, _ := workload.ServiceNames(canary)
+	return stable
+}
+
+func canaryServiceName(canary *deployv1alpha1.CanaryDeployment) string {
+	if name := gatewayRouting(canary).CanaryService; name != "" {
+		return name
+	}
+	_, _, canaryService := workload.ServiceNames(canary)
+	return canaryService
+}
+
+// findBackendRef returns the backendRef to the named Service in the
+// namespace, or nil.
+func findBackendRef(refs []interface{}, name, namespace string) map[string]interface{} {
+	for _, r := range refs {
+		ref, ok := r.(map[string]interface{})
+		if !ok || ref["name"] != name {
+			continue
+		}
+		if kind, _ := ref["kind"].(string); kind != "" && kind != "Service" {
+			continue
+		}
+		if group, _ := ref["group"].(string); group != "" {
+			continue
+		}
+		if ns, _ := ref["namespace"].(string); ns != "" && ns != namespace {
+			continue
+		}
+		return ref
+	}
+	return nil
+}
+
+// backendRefWeight returns the weight of a backendRef, which Gateway API
+// defaults to 1.
+func backendRefWeight(ref map[string]interface{}) int64 {
+	switch weight := ref["weight"].(type) {
+	case int64:
+		return weight
+	case float64:
+		return int64(weight)
+	default:
+		return 1
+	}
+}
+
+func parentRefObject(ref deployv1alpha1.GatewayParentRef) map[string]interface{} {
+	obj := map[string]interface{}{"name": ref.Name}
+	if ref.Group != "" {
+		obj["group"] = ref.Group
+	}
+	if ref.Kind != "" {
+		obj["kind"] = ref.Kind
+	}
+	if ref.Namespace != "" {
+		obj["namespace"] = ref.Namespace
+	}
+	if ref.SectionName != "" {
+		obj["sectionName"] = ref.SectionName
+	}
+	if ref.Port != 0 {
+		obj["port"] = int64(ref.Port)
+	}
+	return obj
+}
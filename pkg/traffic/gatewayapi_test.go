@@ -0,0 +1,196 @@
+package traffic
+
+import (
+	"context"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newGatewayClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			httpRouteGVR: "HTTPRouteList",
+			grpcRouteGVR: "GRPCRouteList",
+		},
+		objects...,
+	)
+}
+
+func newGatewayRoute(kind, name string, rules ...interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": gatewayAPIVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"spec":       map[string]interface{}{"rules": rules},
+	}}
+}
+
+func backendRule(refs ...map[string]interface{}) map[string]interface{} {
+	backendRefs := make([]interface{}, 0, len(refs))
+	for _, ref := range refs {
+		backendRefs = append(backendRefs, ref)
+	}
+	return map[string]interface{}{"backendRefs": backendRefs}
+}
+
+// backendWeights returns the weight of each backendRef by name in a rule.
+func backendWeights(t *testing.T, obj *unstructured.Unstructured, rule int) map[string]int64 {
+	t.Helper()
+	rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+	refs := rules[rule].(map[string]interface{})["backendRefs"].([]interface{})
+	weights := map[string]int64{}
+	for _, r := range refs {
+		ref := r.(map[string]interface{})
+		weight, _ := ref["weight"].(int64)
+		weights[ref["name"].(string)] = weight
+	}
+	return weights
+}
+
+func TestGatewayAPITrafficManager_UpdateWeight(t *testing.T) {
+	route := newGatewayRoute("HTTPRoute", "test-canary",
+		backendRule(
+			map[string]interface{}{"name": "test-app", "port": int64(8080), "weight": int64(100)},
+		),
+		backendRule(
+			map[string]interface{}{"name": "docs", "port": int64(80), "weight": int64(100)},
+		),
+	)
+	client := newGatewayClient(route)
+	manager := NewGatewayAPITrafficManager(client)
+	ctx := context.Background()
+
+	if err := manager.UpdateWeight(ctx, newTestCanary(), 25); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+
+	got, err := client.Resource(httpRouteGVR).Namespace("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get httproute: %v", err)
+	}
+	weights := backendWeights(t, got, 0)
+	if weights["test-app"] != 75 || weights["test-app-canary"] != 25 {
+		t.Errorf("weights = %v, want test-app 75 and test-app-canary 25", weights)
+	}
+	if weights := backendWeights(t, got, 1); weights["docs"] != 100 || len(weights) != 1 {
+		t.Errorf("unrelated rule weights = %v, want unchanged", weights)
+	}
+
+	rules, _, _ := unstructured.NestedSlice(got.Object, "spec", "rules")
+	for _, r := range rules[0].(map[string]interface{})["backendRefs"].([]interface{}) {
+		ref := r.(map[string]interface{})
+		if ref["name"] == "test-app-canary" && ref["port"] != int64(8080) {
+			t.Errorf("canary backendRef port = %v, want the stable port 8080", ref["port"])
+		}
+	}
+}
+
+func TestGatewayAPITrafficManager_UpdateWeightGRPCRoute(t *testing.T) {
+	route := newGatewayRoute("GRPCRoute", "payments",
+		backendRule(
+			map[string]interface{}{"name": "payments-v1", "port": int64(9090), "weight": int64(100)},
+			map[string]interface{}{"name": "payments-v2", "port": int64(9090), "weight": int64(0)},
+		),
+	)
+	client := newGatewayClient(route)
+	manager := NewGatewayAPITrafficManager(client)
+	canary := newTestCanary()
+	canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{
+		GatewayAPI: &deployv1alpha1.GatewayAPITrafficRouting{
+			GRPCRoute:     "payments",
+			StableService: "payments-v1",
+			CanaryService: "payments-v2",
+		},
+	}
+	ctx := context.Background()
+
+	if err := manager.UpdateWeight(ctx, canary, 50); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+
+	got, _ := client.Resource(grpcRouteGVR).Namespace("default").Get(ctx, "payments", metav1.GetOptions{})
+	if weights := backendWeights(t, got, 0); weights["payments-v1"] != 50 || weights["payments-v2"] != 50 {
+		t.Errorf("weights = %v, want 50/50", weights)
+	}
+}
+
+func TestGatewayAPITrafficManager_UpdateWeightWithoutStableBackend(t *testing.T) {
+	route := newGatewayRoute("HTTPRoute", "test-canary",
+		backendRule(map[string]interface{}{"name": "other", "port": int64(80)}),
+	)
+	manager := NewGatewayAPITrafficManager(newGatewayClient(route))
+
+	if err := manager.UpdateWeight(context.Background(), newTestCanary(), 10); err == nil {
+		t.Error("UpdateWeight() error = nil, want error when no rule routes to the stable service")
+	}
+}
+
+func TestGatewayAPITrafficManager_CreateCanaryRoute(t *testing.T) {
+	client := newGatewayClient()
+	manager := NewGatewayAPITrafficManager(client)
+	canary := newTestCanary()
+	canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{
+		GatewayAPI: &deployv1alpha1.GatewayAPITrafficRouting{
+			Port:       8080,
+			ParentRefs: []deployv1alpha1.GatewayParentRef{{Name: "public", Namespace: "gateways", SectionName: "https"}},
+			Hostnames:  []string{"app.example.com"},
+		},
+	}
+	ctx := context.Background()
+
+	if err := manager.CreateCanaryRoute(ctx, canary); err != nil {
+		t.Fatalf("CreateCanaryRoute() error = %v", err)
+	}
+
+	got, err := client.Resource(httpRouteGVR).Namespace("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get httproute: %v", err)
+	}
+	parentRefs, _, _ := unstructured.NestedSlice(got.Object, "spec", "parentRefs")
+	if len(parentRefs) != 1 {
+		t.Fatalf("parentRefs = %v, want one", parentRefs)
+	}
+	parent := parentRefs[0].(map[string]interface{})
+	if parent["name"] != "public" || parent["namespace"] != "gateways" || parent["sectionName"] != "https" {
+		t.Errorf("parentRef = %v, want gateways/public section https", parent)
+	}
+	hostnames, _, _ := unstructured.NestedStringSlice(got.Object, "spec", "hostnames")
+	if len(hostnames) != 1 || hostnames[0] != "app.example.com" {
+		t.Errorf("hostnames = %v, want [app.example.com]", hostnames)
+	}
+	if weights := backendWeights(t, got, 0); weights["test-app"] != 100 || weights["test-app-canary"] != 0 {
+		t.Errorf("weights = %v, want all traffic on stable", weights)
+	}
+
+	if err := manager.CreateCanaryRoute(ctx, canary); err != nil {
+		t.Errorf("CreateCanaryRoute() on existing route error = %v", err)
+	}
+}
+
+func TestGatewayAPITrafficManager_VerifyWeight(t *testing.T) {
+	route := newGatewayRoute("HTTPRoute", "test-canary",
+		backendRule(
+			map[string]interface{}{"name": "test-app", "weight": int64(3)},
+			map[string]interface{}{"name": "test-app-canary", "weight": int64(1)},
+		),
+		backendRule(
+			map[string]interface{}{"name": "docs", "weight": int64(100)},
+		),
+	)
+	manager := NewGatewayAPITrafficManager(newGatewayClient(route))
+	ctx := context.Background()
+
+	if got, err := manager.VerifyWeight(ctx, newTestCanary(), 25); err != nil || got != 25 {
+		t.Errorf("VerifyWeight() = %d, %v, want 25", got, err)
+	}
+	if got, err := manager.VerifyWeight(ctx, newTestCanary(), 10); err != nil || got != 25 {
+		t.Errorf("VerifyWeight() = %d, %v, want the observed 25", got, err)
+	}
+}
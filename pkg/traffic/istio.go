@@ -2,12 +2,17 @@ package traffic
 
 import (
 	"context"
+	"fmt"
+	"regexp"
 
 	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/workload"
 	networkingv1beta1 "istio.io/api/networking/v1beta1"
 	"istio.io/client-go/pkg/apis/networking/v1beta1"
 	versionedclient "istio.io/client-go/pkg/clientset/versioned"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
@@ -17,27 +22,57 @@ func NewIstioClient(config *rest.Config) (versionedclient.Interface, error) {
 
 type IstioTrafficManager struct {
 	istioClient versionedclient.Interface
+	clientset   kubernetes.Interface
 }
 
-func NewIstioTrafficManager(istioClient versionedclient.Interface) *IstioTrafficManager {
+func NewIstioTrafficManager(istioClient versionedclient.Interface, clientset kubernetes.Interface) *IstioTrafficManager {
 	return &IstioTrafficManager{
 		istioClient: istioClient,
+		clientset:   clientset,
 	}
 }
 
 func (m *IstioTrafficManager) UpdateWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) error {
+	if weight > 0 {
+		if err := m.ensureDestinationRule(ctx, canary); err != nil {
+			return err
+		}
+	}
+
 	vs, err := m.istioClient.NetworkingV1beta1().
 		VirtualServices(canary.Namespace).
-		Get(ctx, canary.Name, metav1.GetOptions{})
+		Get(ctx, virtualServiceName(canary), metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
 
-	for i, route := range vs.Spec.Http {
-		if len(route.Route) == 2 {
-			vs.Spec.Http[i].Route[0].Weight = int32(100 - weight)
-			vs.Spec.Http[i].Route[1].Weight = int32(weight)
+	routes, err := managedRoutes(vs, canary)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		stable := subsetDestination(route.Route, canary, stableSubset)
+		canaryDestination := subsetDestination(route.Route, canary, canarySubset)
+		if canaryDestination == nil {
+			canaryDestination = &networkingv1beta1.HTTPRouteDestination{
+				Destination: &networkingv1beta1.Destination{
+					Host:   stable.Destination.Host,
+					Port:   stable.Destination.Port,
+					Subset: canarySubset,
+				},
+			}
+			route.Route = append(route.Route, canaryDestination)
 		}
+		stable.Weight = int32(100 - weight)
+		canaryDestination.Weight = int32(weight)
+	}
+
+	l4Routes, err := managedL4Routes(vs, canary)
+	if err != nil {
+		return err
+	}
+	for _, route := range l4Routes {
+		setL4Weight(route, canary, weight)
 	}
 
 	_, err = m.istioClient.NetworkingV1beta1().
@@ -47,28 +82,53 @@ func (m *IstioTrafficManager) UpdateWeight(ctx context.Context, canary *deployv1
 	return err
 }
 
+// CreateCanaryRoute creates the VirtualService unless it already exists, in
+// which case only the DestinationRule subsets are set up.
 func (m *IstioTrafficManager) CreateCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	if err := m.ensureDestinationRule(ctx, canary); err != nil {
+		return err
+	}
+
+	_, err := m.istioClient.NetworkingV1beta1().
+		VirtualServices(canary.Namespace).
+		Get(ctx, virtualServiceName(canary), metav1.GetOptions{})
+	if err == nil || !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	routing := istioRouting(canary)
+	hosts := routing.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{workload.TargetName(canary)}
+	}
+	routeName := ""
+	if len(routing.Routes) > 0 {
+		routeName = routing.Routes[0]
+	}
+
 	vs := &v1beta1.VirtualService{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      canary.Name,
+			Name:      virtualServiceName(canary),
 			Namespace: canary.Namespace,
 		},
 		Spec: networkingv1beta1.VirtualService{
-			Hosts: []string{canary.Name + ".example.com"},
+			Hosts:    hosts,
+			Gateways: routing.Gateways,
 			Http: []*networkingv1beta1.HTTPRoute{
 				{
+					Name: routeName,
 					Route: []*networkingv1beta1.HTTPRouteDestination{
 						{
 							Destination: &networkingv1beta1.Destination{
-								Host:   canary.Spec.TargetDeployment,
-								Subset: "stable",
+								Host:   workload.TargetName(canary),
+								Subset: stableSubset,
 							},
 							Weight: 100,
 						},
 						{
 							Destination: &networkingv1beta1.Destination{
-								Host:   canary.Spec.TargetDeployment,
-								Subset: "canary",
+								Host:   workload.TargetName(canary),
+								Subset: canarySubset,
 							},
 							Weight: 0,
 						},
@@ -78,9 +138,335 @@ func (m *IstioTrafficManager) CreateCanaryRoute(ctx context.Context, canary *dep
 		},
 	}
 
-	_, err := m.istioClient.NetworkingV1beta1().
+	_, err = m.istioClient.NetworkingV1beta1().
 		VirtualServices(canary.Namespace).
 		Create(ctx, vs, metav1.CreateOptions{})
 
 	return err
 }
+
+// VerifyWeight reads the canary weight back from every route UpdateWeight
+// manages in the VirtualService.
+func (m *IstioTrafficManager) VerifyWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) (int, error) {
+	vs, err := m.istioClient.NetworkingV1beta1().
+		VirtualServices(canary.Namespace).
+		Get(ctx, virtualServiceName(canary), metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	routes, err := managedRoutes(vs, canary)
+	if err != nil {
+		return 0, err
+	}
+	l4Routes, err := managedL4Routes(vs, canary)
+	if err != nil {
+		return 0, err
+	}
+
+	observed := make([]int, 0, len(routes)+len(l4Routes))
+	for _, route := range routes {
+		var stableWeight, canaryWeight int64
+		if stable := subsetDestination(route.Route, canary, stableSubset); stable != nil {
+			stableWeight = int64(stable.Weight)
+		}
+		if canaryDestination := subsetDestination(route.Route, canary, canarySubset); canaryDestination != nil {
+			canaryWeight = int64(canaryDestination.Weight)
+		}
+		observed = append(observed, canaryPercent(stableWeight, canaryWeight))
+	}
+	for _, route := range l4Routes {
+		observed = append(observed, l4CanaryPercent(*route, canary))
+	}
+	return divergingWeight(weight, observed), nil
+}
+
+func istioRouting(canary *deployv1alpha1.CanaryDeployment) *deployv1alpha1.IstioTrafficRouting {
+	if routing := canary.Spec.TrafficRouting; routing != nil && routing.Istio != nil {
+		return routing.Istio
+	}
+	return &deployv1alpha1.IstioTrafficRouting{}
+}
+
+func virtualServiceName(canary *deployv1alpha1.CanaryDeployment) string {
+	if name := istioRouting(canary).VirtualService; name != "" {
+		return name
+	}
+	return canary.Name
+}
+
+// hasRouteSelectors reports whether spec.trafficRouting.istio lists routes
+// of any protocol. Without any, every route with both subsets is managed.
+func hasRouteSelectors(routing *deployv1alpha1.IstioTrafficRouting) bool {
+	return len(routing.Routes) > 0 || len(routing.TLSRoutes) > 0 || len(routing.TCPRoutes) > 0
+}
+
+// managedRoutes returns the HTTP routes the canary reweights: the routes
+// named in spec.trafficRouting.istio.routes, each of which must have a
+// stable destination, or else every route with both a stable and a canary
+// destination.
+func managedRoutes(vs *v1beta1.VirtualService, canary *deployv1alpha1.CanaryDeployment) ([]*networkingv1beta1.HTTPRoute, error) {
+	names := istioRouting(canary).Routes
+	if len(names) == 0 {
+		if hasRouteSelectors(istioRouting(canary)) {
+			return nil, nil
+		}
+		var routes []*networkingv1beta1.HTTPRoute
+		for _, route := range vs.Spec.Http {
+			if route.Name == canaryMatchRouteName {
+				continue
+			}
+			if subsetDestination(route.Route, canary, stableSubset) != nil && subsetDestination(route.Route, canary, canarySubset) != nil {
+				routes = append(routes, route)
+			}
+		}
+		return routes, nil
+	}
+
+	routes := make([]*networkingv1beta1.HTTPRoute, 0, len(names))
+	for _, name := range names {
+		var found *networkingv1beta1.HTTPRoute
+		for _, route := range vs.Spec.Http {
+			if route.Name == name {
+				found = route
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("route %q not found in virtualservice %s", name, vs.Name)
+		}
+		if subsetDestination(found.Route, canary, stableSubset) == nil {
+			return nil, fmt.Errorf("route %q in virtualservice %s has no destination for subset %q", name, vs.Name, stableSubset)
+		}
+		routes = append(routes, found)
+	}
+	return routes, nil
+}
+
+// subsetDestination returns the destination of the target host with the
+// given subset, or nil.
+func subsetDestination(destinations []*networkingv1beta1.HTTPRouteDestination, canary *deployv1alpha1.CanaryDeployment, subset string) *networkingv1beta1.HTTPRouteDestination {
+	for _, destination := range destinations {
+		if destination.Destination == nil || destination.Destination.Subset != subset {
+			continue
+		}
+		if hostMatches(destination.Destination.Host, workload.TargetName(canary), canary.Namespace) {
+			return destination
+		}
+	}
+	return nil
+}
+
+const canaryMatchRouteName = "codedance-canary-match"
+
+func (m *IstioTrafficManager) UpdateMatch(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, matches []deployv1alpha1.RouteMatch) error {
+	if len(matches) > 0 {
+		if err := m.ensureDestinationRule(ctx, canary); err != nil {
+			return err
+		}
+	}
+
+	vs, err := m.istioClient.NetworkingV1beta1().
+		VirtualServices(canary.Namespace).
+		Get(ctx, virtualServiceName(canary), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	routes := make([]*networkingv1beta1.HTTPRoute, 0, len(vs.Spec.Http)+1)
+	if len(matches) > 0 {
+		routes = append(routes, buildMatchRoute(canary, matches))
+	}
+	for _, route := range vs.Spec.Http {
+		if route.Name != canaryMatchRouteName {
+			routes = append(routes, route)
+		}
+	}
+	vs.Spec.Http = routes
+
+	_, err = m.istioClient.NetworkingV1beta1().
+		VirtualServices(canary.Namespace).
+		Update(ctx, vs, metav1.UpdateOptions{})
+
+	return err
+}
+
+func buildMatchRoute(canary *deployv1alpha1.CanaryDeployment, matches []deployv1alpha1.RouteMatch) *networkingv1beta1.HTTPRoute {
+	route := &networkingv1beta1.HTTPRoute{
+		Name: canaryMatchRouteName,
+		Route: []*networkingv1beta1.HTTPRouteDestination{
+			{
+				Destination: &networkingv1beta1.Destination{
+					Host:   workload.TargetName(canary),
+					Subset: canarySubset,
+				},
+				Weight: 100,
+			},
+		},
+	}
+
+	for _, match := range matches {
+		request := &networkingv1beta1.HTTPMatchRequest{
+			Headers:      toIstioStringMatches(match.Headers),
+			QueryParams:  toIstioStringMatches(match.QueryParams),
+			SourceLabels: match.SourceLabels,
+		}
+		if match.Cookie != nil {
+			if request.Headers == nil {
+				request.Headers = map[string]*networkingv1beta1.StringMatch{}
+			}
+			request.Headers["cookie"] = &networkingv1beta1.StringMatch{
+				MatchType: &networkingv1beta1.StringMatch_Regex{Regex: cookieRegex(match.Cookie)},
+			}
+		}
+		route.Match = append(route.Match, request)
+	}
+
+	return route
+}
+
+func toIstioStringMatches(in map[string]deployv1alpha1.StringMatch) map[string]*networkingv1beta1.StringMatch {
+	if len(in) == 0 {
+		return nil
+	}
+
+	out := make(map[string]*networkingv1beta1.StringMatch, len(in))
+	for key, sm := range in {
+		switch {
+		case sm.Regex != "":
+			out[key] = &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Regex{Regex: sm.Regex}}
+		case sm.Prefix != "":
+			out[key] = &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Prefix{Prefix: sm.Prefix}}
+		default:
+			out[key] = &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Exact{Exact: sm.Exact}}
+		}
+	}
+	return out
+}
+
+// cookieRegex matches a Cookie header containing the given cookie. Like
+// nginx canary-by-cookie, the value defaults to "always".
+func cookieRegex(cookie *deployv1alpha1.CookieMatch) string {
+	value := cookie.Value
+	if value == "" {
+		value = "always"
+	}
+	return fmt.Sprintf("^(.*?;\\s*)?%s=%s(;.*)?$", regexp.QuoteMeta(cookie.Name), regexp.QuoteMeta(value))
+}
+
+// CleanupCanaryRoute runs once the rollout has been rolled back. The stable
+// and canary destinations of each managed route are merged into one for the
+// plain Service host, which selects the stable pods again, so that the
+// subsets can be removed from the DestinationRule without leaving routes to
+// undefined subsets.
+func (m *IstioTrafficManager) CleanupCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	vs, err := m.istioClient.NetworkingV1beta1().
+		VirtualServices(canary.Namespace).
+		Get(ctx, virtualServiceName(canary), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		routes, err := managedRoutes(vs, canary)
+		if err != nil {
+			return err
+		}
+		for _, route := range routes {
+			releaseSubsets(route, canary)
+		}
+		l4Routes, err := managedL4Routes(vs, canary)
+		if err != nil {
+			return err
+		}
+		for _, route := range l4Routes {
+			releaseL4Subsets(route, canary)
+		}
+
+		http := make([]*networkingv1beta1.HTTPRoute, 0, len(vs.Spec.Http))
+		for _, route := range vs.Spec.Http {
+			if route.Name != canaryMatchRouteName {
+				http = append(http, route)
+			}
+		}
+		vs.Spec.Http = http
+
+		if _, err := m.istioClient.NetworkingV1beta1().
+			VirtualServices(canary.Namespace).
+			Update(ctx, vs, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return m.removeDestinationRuleSubsets(ctx, canary)
+}
+
+// releaseSubsets replaces the stable and canary destinations of a route with
+// a single destination without subset. Its weight is their combined weight,
+// or unset when it is the only destination left.
+func releaseSubsets(route *networkingv1beta1.HTTPRoute, canary *deployv1alpha1.CanaryDeployment) {
+	stable := subsetDestination(route.Route, canary, stableSubset)
+	canaryDestination := subsetDestination(route.Route, canary, canarySubset)
+
+	merged := &networkingv1beta1.HTTPRouteDestination{
+		Destination: &networkingv1beta1.Destination{
+			Host: stable.Destination.Host,
+			Port: stable.Destination.Port,
+		},
+		Headers: stable.Headers,
+		Weight:  stable.Weight,
+	}
+	if canaryDestination != nil {
+		merged.Weight += canaryDestination.Weight
+	}
+
+	destinations := []*networkingv1beta1.HTTPRouteDestination{merged}
+	for _, destination := range route.Route {
+		if destination != stable && destination != canaryDestination {
+			destinations = append(destinations, destination)
+		}
+	}
+	if len(destinations) == 1 {
+		merged.Weight = 0
+	}
+	route.Route = destinations
+	route.Mirror = nil
+	route.MirrorPercentage = nil
+}
+
+func (m *IstioTrafficManager) UpdateMirror(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, percent int) error {
+	if percent > 0 {
+		if err := m.ensureDestinationRule(ctx, canary); err != nil {
+			return err
+		}
+	}
+
+	vs, err := m.istioClient.NetworkingV1beta1().
+		VirtualServices(canary.Namespace).
+		Get(ctx, virtualServiceName(canary), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	routes, err := managedRoutes(vs, canary)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		if percent <= 0 {
+			route.Mirror = nil
+			route.MirrorPercentage = nil
+			continue
+		}
+		route.Mirror = &networkingv1beta1.Destination{
+			Host:   workload.TargetName(canary),
+			Subset: canarySubset,
+		}
+		route.MirrorPercentage = &networkingv1beta1.Percent{Value: float64(percent)}
+	}
+
+	_, err = m.istioClient.NetworkingV1beta1().
+		VirtualServices(canary.Namespace).
+		Update(ctx, vs, metav1.UpdateOptions{})
+
+	return err
+}
@@ -0,0 +1,161 @@
+package traffic
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/workload"
+	networkingv1beta1 "istio.io/api/networking/v1beta1"
+	"istio.io/client-go/pkg/apis/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	stableSubset = "stable"
+	canarySubset = "canary"
+
+	// destinationRuleOwnerAnnotation marks a DestinationRule created for a
+	// canary. It is deleted when the rollout ends, whereas a DestinationRule
+	// that already existed only loses the subsets added to it.
+	destinationRuleOwnerAnnotation = "deploy.codedance.io/canary"
+)
+
+// ensureDestinationRule defines the stable and canary subsets on the
+// DestinationRule for the target host, creating one if none exists. The
+// subsets select pods by version label; the traffic policy of an existing
+// DestinationRule, and of existing subsets, is kept.
+func (m *IstioTrafficManager) ensureDestinationRule(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	stableLabels, canaryLabels, err := workload.VersionLabels(ctx, m.clientset, canary)
+	if err != nil {
+		return fmt.Errorf("resolve version labels: %w", err)
+	}
+	subsets := []*networkingv1beta1.Subset{
+		{Name: stableSubset, Labels: stableLabels},
+		{Name: canarySubset, Labels: canaryLabels},
+	}
+
+	dr, err := m.findDestinationRule(ctx, canary)
+	if err != nil {
+		return err
+	}
+	if dr == nil {
+		dr = &v1beta1.DestinationRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        canary.Name,
+				Namespace:   canary.Namespace,
+				Annotations: map[string]string{destinationRuleOwnerAnnotation: canary.Name},
+			},
+			Spec: networkingv1beta1.DestinationRule{
+				Host:    workload.TargetName(canary),
+				Subsets: subsets,
+			},
+		}
+		if _, err := m.istioClient.NetworkingV1beta1().DestinationRules(canary.Namespace).Create(ctx, dr, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("create destination rule: %w", err)
+		}
+		return nil
+	}
+
+	if !setSubsets(&dr.Spec, subsets) {
+		return nil
+	}
+	if _, err := m.istioClient.NetworkingV1beta1().DestinationRules(canary.Namespace).Update(ctx, dr, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update destination rule %s: %w", dr.Name, err)
+	}
+	return nil
+}
+
+// removeDestinationRuleSubsets undoes ensureDestinationRule.
+func (m *IstioTrafficManager) removeDestinationRuleSubsets(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	dr, err := m.findDestinationRule(ctx, canary)
+	if err != nil || dr == nil {
+		return err
+	}
+
+	destinationRules := m.istioClient.NetworkingV1beta1().DestinationRules(canary.Namespace)
+	if dr.Annotations[destinationRuleOwnerAnnotation] == canary.Name {
+		if err := destinationRules.Delete(ctx, dr.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete destination rule %s: %w", dr.Name, err)
+		}
+		return nil
+	}
+
+	subsets := make([]*networkingv1beta1.Subset, 0, len(dr.Spec.Subsets))
+	for _, subset := range dr.Spec.Subsets {
+		if subset.Name != stableSubset && subset.Name != canarySubset {
+			subsets = append(subsets, subset)
+		}
+	}
+	if len(subsets) == len(dr.Spec.Subsets) {
+		return nil
+	}
+	dr.Spec.Subsets = subsets
+	if _, err := destinationRules.Update(ctx, dr, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update destination rule %s: %w", dr.Name, err)
+	}
+	return nil
+}
+
+// findDestinationRule returns the DestinationRule for the target host,
+// preferring one created for this canary, or nil if there is none.
+func (m *IstioTrafficManager) findDestinationRule(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) (*v1beta1.DestinationRule, error) {
+	list, err := m.istioClient.NetworkingV1beta1().DestinationRules(canary.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list destination rules: %w", err)
+	}
+
+	var found *v1beta1.DestinationRule
+	for _, dr := range list.Items {
+		if !hostMatches(dr.Spec.Host, workload.TargetName(canary), canary.Namespace) {
+			continue
+		}
+		if dr.Annotations[destinationRuleOwnerAnnotation] == canary.Name {
+			return dr, nil
+		}
+		if found == nil {
+			found = dr
+		}
+	}
+	return found, nil
+}
+
+// hostMatches reports whether an Istio host refers to the Service, by short
+// name or any of its qualified names.
+func hostMatches(host, service, namespace string) bool {
+	switch host {
+	case service,
+		service + "." + namespace,
+		service + "." + namespace + ".svc",
+		service + "." + namespace + ".svc.cluster.local":
+		return true
+	}
+	return false
+}
+
+// setSubsets adds the subsets to the spec, replacing the labels of subsets
+// with the same name, and reports whether the spec changed.
+func setSubsets(spec *networkingv1beta1.DestinationRule, subsets []*networkingv1beta1.Subset) bool {
+	changed := false
+	for _, want := range subsets {
+		var existing *networkingv1beta1.Subset
+		for _, subset := range spec.Subsets {
+			if subset.Name == want.Name {
+				existing = subset
+				break
+			}
+		}
+		if existing == nil {
+			spec.Subsets = append(spec.Subsets, want)
+			changed = true
+			continue
+		}
+		if !maps.Equal(existing.Labels, want.Labels) {
+			existing.Labels = want.Labels
+			changed = true
+		}
+	}
+	return changed
+}
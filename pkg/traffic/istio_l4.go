@@ -0,0 +1,163 @@
+package traffic
+
+import (
+	"fmt"
+	"slices"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/workload"
+	networkingv1beta1 "istio.io/api/networking/v1beta1"
+	"istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+// managedL4Routes returns the destinations of the TLS and TCP routes the
+// canary reweights. Unlike HTTP routes these have no names, so they are
+// selected by the ports and SNI hosts in spec.trafficRouting.istio; each
+// selector must match at least one route with a stable destination.
+func managedL4Routes(vs *v1beta1.VirtualService, canary *deployv1alpha1.CanaryDeployment) ([]*[]*networkingv1beta1.RouteDestination, error) {
+	routing := istioRouting(canary)
+	var routes []*[]*networkingv1beta1.RouteDestination
+
+	if !hasRouteSelectors(routing) {
+		for _, route := range vs.Spec.Tls {
+			if hasBothSubsets(route.Route, canary) {
+				routes = append(routes, &route.Route)
+			}
+		}
+		for _, route := range vs.Spec.Tcp {
+			if hasBothSubsets(route.Route, canary) {
+				routes = append(routes, &route.Route)
+			}
+		}
+		return routes, nil
+	}
+
+	for _, selector := range routing.TLSRoutes {
+		matched := false
+		for _, route := range vs.Spec.Tls {
+			if tlsRouteMatches(route, selector) && l4SubsetDestination(route.Route, canary, stableSubset) != nil {
+				routes = append(routes, &route.Route)
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no tls route for port %d and sni hosts %v with subset %q in virtualservice %s", selector.Port, selector.SNIHosts, stableSubset, vs.Name)
+		}
+	}
+	for _, selector := range routing.TCPRoutes {
+		matched := false
+		for _, route := range vs.Spec.Tcp {
+			if tcpRouteMatches(route, selector) && l4SubsetDestination(route.Route, canary, stableSubset) != nil {
+				routes = append(routes, &route.Route)
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no tcp route for port %d with subset %q in virtualservice %s", selector.Port, stableSubset, vs.Name)
+		}
+	}
+	return routes, nil
+}
+
+func tlsRouteMatches(route *networkingv1beta1.TLSRoute, selector deployv1alpha1.IstioTLSRoute) bool {
+	for _, match := range route.Match {
+		if selector.Port != 0 && int64(match.Port) != selector.Port {
+			continue
+		}
+		covered := true
+		for _, host := range selector.SNIHosts {
+			if !slices.Contains(match.SniHosts, host) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+func tcpRouteMatches(route *networkingv1beta1.TCPRoute, selector deployv1alpha1.IstioTCPRoute) bool {
+	if selector.Port == 0 {
+		return true
+	}
+	for _, match := range route.Match {
+		if int64(match.Port) == selector.Port {
+			return true
+		}
+	}
+	return false
+}
+
+func hasBothSubsets(destinations []*networkingv1beta1.RouteDestination, canary *deployv1alpha1.CanaryDeployment) bool {
+	return l4SubsetDestination(destinations, canary, stableSubset) != nil && l4SubsetDestination(destinations, canary, canarySubset) != nil
+}
+
+func l4SubsetDestination(destinations []*networkingv1beta1.RouteDestination, canary *deployv1alpha1.CanaryDeployment, subset string) *networkingv1beta1.RouteDestination {
+	for _, destination := range destinations {
+		if destination.Destination == nil || destination.Destination.Subset != subset {
+			continue
+		}
+		if hostMatches(destination.Destination.Host, workload.TargetName(canary), canary.Namespace) {
+			return destination
+		}
+	}
+	return nil
+}
+
+func setL4Weight(route *[]*networkingv1beta1.RouteDestination, canary *deployv1alpha1.CanaryDeployment, weight int) {
+	stable := l4SubsetDestination(*route, canary, stableSubset)
+	canaryDestination := l4SubsetDestination(*route, canary, canarySubset)
+	if canaryDestination == nil {
+		canaryDestination = &networkingv1beta1.RouteDestination{
+			Destination: &networkingv1beta1.Destination{
+				Host:   stable.Destination.Host,
+				Port:   stable.Destination.Port,
+				Subset: canarySubset,
+			},
+		}
+		*route = append(*route, canaryDestination)
+	}
+	stable.Weight = int32(100 - weight)
+	canaryDestination.Weight = int32(weight)
+}
+
+func l4CanaryPercent(route []*networkingv1beta1.RouteDestination, canary *deployv1alpha1.CanaryDeployment) int {
+	var stableWeight, canaryWeight int64
+	if stable := l4SubsetDestination(route, canary, stableSubset); stable != nil {
+		stableWeight = int64(stable.Weight)
+	}
+	if canaryDestination := l4SubsetDestination(route, canary, canarySubset); canaryDestination != nil {
+		canaryWeight = int64(canaryDestination.Weight)
+	}
+	return canaryPercent(stableWeight, canaryWeight)
+}
+
+// releaseL4Subsets is releaseSubsets for TLS and TCP routes.
+func releaseL4Subsets(route *[]*networkingv1beta1.RouteDestination, canary *deployv1alpha1.CanaryDeployment) {
+	stable := l4SubsetDestination(*route, canary, stableSubset)
+	canaryDestination := l4SubsetDestination(*route, canary, canarySubset)
+
+	merged := &networkingv1beta1.RouteDestination{
+		Destination: &networkingv1beta1.Destination{
+			Host: stable.Destination.Host,
+			Port: stable.Destination.Port,
+		},
+		Weight: stable.Weight,
+	}
+	if canaryDestination != nil {
+		merged.Weight += canaryDestination.Weight
+	}
+
+	destinations := []*networkingv1beta1.RouteDestination{merged}
+	for _, destination := range *route {
+		if destination != stable && destination != canaryDestination {
+			destinations = append(destinations, destination)
+		}
+	}
+	if len(destinations) == 1 {
+		merged.Weight = 0
+	}
+	*route = destinations
+}
@@ -0,0 +1,617 @@
+package traffic
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	networkingv1beta1 "istio.io/api/networking/v1beta1"
+	"istio.io/client-go/pkg/apis/networking/v1beta1"
+	istiofake "istio.io/client-go/pkg/clientset/versioned/fake"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestCanary() *deployv1alpha1.CanaryDeployment {
+	return &deployv1alpha1.CanaryDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-canary",
+			Namespace: "default",
+		},
+		Spec: deployv1alpha1.CanaryDeploymentSpec{
+			TargetDeployment: "test-app",
+		},
+	}
+}
+
+func newWeightedVirtualService() *v1beta1.VirtualService {
+	return &v1beta1.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-canary",
+			Namespace: "default",
+		},
+		Spec: networkingv1beta1.VirtualService{
+			Hosts: []string{"test-app"},
+			Http: []*networkingv1beta1.HTTPRoute{
+				{
+					Route: []*networkingv1beta1.HTTPRouteDestination{
+						{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "stable"}, Weight: 100},
+						{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "canary"}, Weight: 0},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestIstioTrafficManager_UpdateMatch(t *testing.T) {
+	client := istiofake.NewSimpleClientset(newWeightedVirtualService())
+	manager := NewIstioTrafficManager(client, fake.NewSimpleClientset(
+		newVersionedDeployment("test-app", "v1"),
+		newVersionedDeployment("test-app-canary", "v2"),
+	))
+	canary := newTestCanary()
+	ctx := context.Background()
+
+	matches := []deployv1alpha1.RouteMatch{
+		{
+			Headers: map[string]deployv1alpha1.StringMatch{"x-user-group": {Exact: "employee"}},
+			Cookie:  &deployv1alpha1.CookieMatch{Name: "beta"},
+		},
+	}
+	if err := manager.UpdateMatch(ctx, canary, matches); err != nil {
+		t.Fatalf("UpdateMatch() error = %v", err)
+	}
+
+	vs, err := client.NetworkingV1beta1().VirtualServices("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get virtual service: %v", err)
+	}
+	if len(vs.Spec.Http) != 2 {
+		t.Fatalf("http routes = %d, want 2", len(vs.Spec.Http))
+	}
+
+	matchRoute := vs.Spec.Http[0]
+	if matchRoute.Name != canaryMatchRouteName {
+		t.Errorf("first route name = %s, want %s", matchRoute.Name, canaryMatchRouteName)
+	}
+	if matchRoute.Route[0].Destination.Subset != "canary" {
+		t.Errorf("match route subset = %s, want canary", matchRoute.Route[0].Destination.Subset)
+	}
+	if got := matchRoute.Match[0].Headers["x-user-group"].GetExact(); got != "employee" {
+		t.Errorf("header match = %s, want employee", got)
+	}
+	cookie := regexp.MustCompile(matchRoute.Match[0].Headers["cookie"].GetRegex())
+	if !cookie.MatchString("session=abc; beta=always") {
+		t.Error("cookie regex does not match beta=always")
+	}
+	if cookie.MatchString("notbeta=always") {
+		t.Error("cookie regex matches a different cookie")
+	}
+
+	if err := manager.UpdateMatch(ctx, canary, nil); err != nil {
+		t.Fatalf("UpdateMatch(nil) error = %v", err)
+	}
+	vs, _ = client.NetworkingV1beta1().VirtualServices("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	if len(vs.Spec.Http) != 1 || vs.Spec.Http[0].Name == canaryMatchRouteName {
+		t.Errorf("match route not removed, routes = %v", vs.Spec.Http)
+	}
+}
+
+func TestIstioTrafficManager_UpdateMirror(t *testing.T) {
+	client := istiofake.NewSimpleClientset(newWeightedVirtualService())
+	manager := NewIstioTrafficManager(client, fake.NewSimpleClientset(
+		newVersionedDeployment("test-app", "v1"),
+		newVersionedDeployment("test-app-canary", "v2"),
+	))
+	canary := newTestCanary()
+	ctx := context.Background()
+
+	if err := manager.UpdateMirror(ctx, canary, 20); err != nil {
+		t.Fatalf("UpdateMirror() error = %v", err)
+	}
+
+	vs, _ := client.NetworkingV1beta1().VirtualServices("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	route := vs.Spec.Http[0]
+	if route.Mirror == nil || route.Mirror.Subset != "canary" {
+		t.Fatalf("mirror = %v, want canary subset", route.Mirror)
+	}
+	if route.MirrorPercentage.GetValue() != 20 {
+		t.Errorf("mirror percentage = %v, want 20", route.MirrorPercentage.GetValue())
+	}
+	if route.Route[0].Weight != 100 {
+		t.Errorf("stable weight = %d, want 100 while mirroring", route.Route[0].Weight)
+	}
+
+	if err := manager.UpdateMirror(ctx, canary, 0); err != nil {
+		t.Fatalf("UpdateMirror(0) error = %v", err)
+	}
+	vs, _ = client.NetworkingV1beta1().VirtualServices("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	if vs.Spec.Http[0].Mirror != nil || vs.Spec.Http[0].MirrorPercentage != nil {
+		t.Error("mirror not removed")
+	}
+}
+
+func newVersionedDeployment(name, version string) *appsv1.Deployment {
+	labels := map[string]string{"app": "test-app", "version": version}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+		},
+	}
+}
+
+func findSubset(dr *v1beta1.DestinationRule, name string) *networkingv1beta1.Subset {
+	for _, subset := range dr.Spec.Subsets {
+		if subset.Name == name {
+			return subset
+		}
+	}
+	return nil
+}
+
+func TestIstioTrafficManager_CreateCanaryRouteCreatesDestinationRule(t *testing.T) {
+	client := istiofake.NewSimpleClientset()
+	clientset := fake.NewSimpleClientset(
+		newVersionedDeployment("test-app", "v1"),
+		newVersionedDeployment("test-app-canary", "v2"),
+	)
+	manager := NewIstioTrafficManager(client, clientset)
+	canary := newTestCanary()
+	ctx := context.Background()
+
+	if err := manager.CreateCanaryRoute(ctx, canary); err != nil {
+		t.Fatalf("CreateCanaryRoute() error = %v", err)
+	}
+
+	dr, err := client.NetworkingV1beta1().DestinationRules("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get destination rule: %v", err)
+	}
+	if dr.Spec.Host != "test-app" {
+		t.Errorf("Host = %s, want test-app", dr.Spec.Host)
+	}
+	if subset := findSubset(dr, "stable"); subset == nil || subset.Labels["version"] != "v1" {
+		t.Errorf("stable subset = %v, want version v1", subset)
+	}
+	if subset := findSubset(dr, "canary"); subset == nil || subset.Labels["version"] != "v2" {
+		t.Errorf("canary subset = %v, want version v2", subset)
+	}
+
+	if err := manager.CleanupCanaryRoute(ctx, canary); err != nil {
+		t.Fatalf("CleanupCanaryRoute() error = %v", err)
+	}
+	if _, err := client.NetworkingV1beta1().DestinationRules("default").Get(ctx, "test-canary", metav1.GetOptions{}); err == nil {
+		t.Error("destination rule created for the canary still exists after cleanup")
+	}
+
+	vs, err := client.NetworkingV1beta1().VirtualServices("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get virtual service: %v", err)
+	}
+	for _, route := range vs.Spec.Http {
+		if subsetDestination(route.Route, canary, "stable") != nil || subsetDestination(route.Route, canary, "canary") != nil {
+			t.Errorf("route %v still references subsets after cleanup", route.Route)
+		}
+	}
+}
+
+func TestIstioTrafficManager_ZeroWeightStepsDefineCanarySubset(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(ctx context.Context, manager *IstioTrafficManager, canary *deployv1alpha1.CanaryDeployment) error
+	}{
+		{
+			name: "match",
+			update: func(ctx context.Context, manager *IstioTrafficManager, canary *deployv1alpha1.CanaryDeployment) error {
+				return manager.UpdateMatch(ctx, canary, []deployv1alpha1.RouteMatch{
+					{Headers: map[string]deployv1alpha1.StringMatch{"x-qa": {Exact: "true"}}},
+				})
+			},
+		},
+		{
+			name: "mirror",
+			update: func(ctx context.Context, manager *IstioTrafficManager, canary *deployv1alpha1.CanaryDeployment) error {
+				return manager.UpdateMirror(ctx, canary, 50)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := istiofake.NewSimpleClientset(newWeightedVirtualService())
+			manager := NewIstioTrafficManager(client, fake.NewSimpleClientset(
+				newVersionedDeployment("test-app", "v1"),
+				newVersionedDeployment("test-app-canary", "v2"),
+			))
+			canary := newTestCanary()
+			ctx := context.Background()
+
+			if err := manager.UpdateWeight(ctx, canary, 0); err != nil {
+				t.Fatalf("UpdateWeight(0) error = %v", err)
+			}
+			if err := tt.update(ctx, manager, canary); err != nil {
+				t.Fatalf("update error = %v", err)
+			}
+
+			dr, err := client.NetworkingV1beta1().DestinationRules("default").Get(ctx, "test-canary", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("get destination rule: %v", err)
+			}
+			if subset := findSubset(dr, "canary"); subset == nil || subset.Labels["version"] != "v2" {
+				t.Errorf("canary subset = %v, want version v2", subset)
+			}
+		})
+	}
+}
+
+func TestIstioTrafficManager_UpdateWeightPatchesExistingDestinationRule(t *testing.T) {
+	existing := &v1beta1.DestinationRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-app", Namespace: "default"},
+		Spec: networkingv1beta1.DestinationRule{
+			Host: "test-app.default.svc.cluster.local",
+			TrafficPolicy: &networkingv1beta1.TrafficPolicy{
+				Tls: &networkingv1beta1.ClientTLSSettings{Mode: networkingv1beta1.ClientTLSSettings_ISTIO_MUTUAL},
+			},
+			Subsets: []*networkingv1beta1.Subset{
+				{Name: "legacy", Labels: map[string]string{"version": "v0"}},
+				{Name: "canary", Labels: map[string]string{"version": "old"}},
+			},
+		},
+	}
+	client := istiofake.NewSimpleClientset(newWeightedVirtualService(), existing)
+	clientset := fake.NewSimpleClientset(
+		newVersionedDeployment("test-app", "v1"),
+		newVersionedDeployment("test-app-canary", "v2"),
+	)
+	manager := NewIstioTrafficManager(client, clientset)
+	canary := newTestCanary()
+	ctx := context.Background()
+
+	if err := manager.UpdateWeight(ctx, canary, 20); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+
+	dr, err := client.NetworkingV1beta1().DestinationRules("default").Get(ctx, "test-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get destination rule: %v", err)
+	}
+	if dr.Spec.TrafficPolicy == nil || dr.Spec.TrafficPolicy.Tls == nil {
+		t.Error("existing trafficPolicy was not preserved")
+	}
+	if len(dr.Spec.Subsets) != 3 {
+		t.Errorf("got %d subsets, want legacy, canary and stable", len(dr.Spec.Subsets))
+	}
+	if subset := findSubset(dr, "canary"); subset == nil || subset.Labels["version"] != "v2" {
+		t.Errorf("canary subset = %v, want version v2", subset)
+	}
+
+	if err := manager.CleanupCanaryRoute(ctx, canary); err != nil {
+		t.Fatalf("CleanupCanaryRoute() error = %v", err)
+	}
+	dr, err = client.NetworkingV1beta1().DestinationRules("default").Get(ctx, "test-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("existing destination rule was deleted: %v", err)
+	}
+	if len(dr.Spec.Subsets) != 1 || dr.Spec.Subsets[0].Name != "legacy" || dr.Spec.TrafficPolicy == nil {
+		t.Errorf("after cleanup subsets = %v, trafficPolicy = %v, want only legacy with policy kept", dr.Spec.Subsets, dr.Spec.TrafficPolicy)
+	}
+}
+
+func TestIstioTrafficManager_UpdateWeightRequiresVersionLabels(t *testing.T) {
+	client := istiofake.NewSimpleClientset(newWeightedVirtualService())
+	clientset := fake.NewSimpleClientset(
+		newVersionedDeployment("test-app", "v1"),
+		newVersionedDeployment("test-app-canary", "v1"),
+	)
+	manager := NewIstioTrafficManager(client, clientset)
+
+	if err := manager.UpdateWeight(context.Background(), newTestCanary(), 10); err == nil {
+		t.Error("UpdateWeight() error = nil, want error when versions share a label value")
+	}
+}
+
+func newMultiRouteVirtualService() *v1beta1.VirtualService {
+	return &v1beta1.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+		Spec: networkingv1beta1.VirtualService{
+			Hosts: []string{"shop.example.com"},
+			Http: []*networkingv1beta1.HTTPRoute{
+				{
+					Name: "api",
+					Route: []*networkingv1beta1.HTTPRouteDestination{
+						{Destination: &networkingv1beta1.Destination{Host: "test-app.default.svc.cluster.local", Subset: "stable"}, Weight: 100},
+					},
+				},
+				{
+					Name: "checkout",
+					Route: []*networkingv1beta1.HTTPRouteDestination{
+						{Destination: &networkingv1beta1.Destination{Host: "checkout", Subset: "blue"}, Weight: 50},
+						{Destination: &networkingv1beta1.Destination{Host: "checkout", Subset: "green"}, Weight: 50},
+					},
+				},
+				{
+					Name: "static",
+					Route: []*networkingv1beta1.HTTPRouteDestination{
+						{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "stable"}, Weight: 100},
+						{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "canary"}, Weight: 0},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestIstioTrafficManager_UpdateWeightManagesNamedRoutes(t *testing.T) {
+	client := istiofake.NewSimpleClientset(newMultiRouteVirtualService())
+	manager := NewIstioTrafficManager(client, fake.NewSimpleClientset())
+	canary := newTestCanary()
+	canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{
+		Istio: &deployv1alpha1.IstioTrafficRouting{VirtualService: "shop", Routes: []string{"api"}},
+	}
+	ctx := context.Background()
+
+	if err := manager.UpdateWeight(ctx, canary, 0); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+
+	vs, _ := client.NetworkingV1beta1().VirtualServices("default").Get(ctx, "shop", metav1.GetOptions{})
+	api := vs.Spec.Http[0]
+	if len(api.Route) != 2 || api.Route[1].Destination.Subset != "canary" || api.Route[1].Destination.Host != "test-app.default.svc.cluster.local" {
+		t.Fatalf("api route = %v, want canary destination added", api.Route)
+	}
+	if checkout := vs.Spec.Http[1]; checkout.Route[0].Weight != 50 || checkout.Route[1].Weight != 50 {
+		t.Errorf("unrelated checkout route reweighted: %v", checkout.Route)
+	}
+
+	canary.Spec.TrafficRouting.Istio.Routes = []string{"api", "missing"}
+	if err := manager.UpdateWeight(ctx, canary, 0); err == nil {
+		t.Error("UpdateWeight() error = nil, want error for a route missing from the virtualservice")
+	}
+}
+
+func TestIstioTrafficManager_UpdateWeightBySubset(t *testing.T) {
+	vs := newMultiRouteVirtualService()
+	static := vs.Spec.Http[2]
+	static.Route[0], static.Route[1] = static.Route[1], static.Route[0]
+	client := istiofake.NewSimpleClientset(vs)
+	clientset := fake.NewSimpleClientset(
+		newVersionedDeployment("test-app", "v1"),
+		newVersionedDeployment("test-app-canary", "v2"),
+	)
+	manager := NewIstioTrafficManager(client, clientset)
+	canary := newTestCanary()
+	canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{
+		Istio: &deployv1alpha1.IstioTrafficRouting{VirtualService: "shop"},
+	}
+	ctx := context.Background()
+
+	if err := manager.UpdateWeight(ctx, canary, 30); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+
+	got, _ := client.NetworkingV1beta1().VirtualServices("default").Get(ctx, "shop", metav1.GetOptions{})
+	static = got.Spec.Http[2]
+	if static.Route[0].Destination.Subset != "canary" || static.Route[0].Weight != 30 || static.Route[1].Weight != 70 {
+		t.Errorf("static route = %v, want canary 30 and stable 70 regardless of order", static.Route)
+	}
+	if checkout := got.Spec.Http[1]; checkout.Route[0].Weight != 50 || checkout.Route[1].Weight != 50 {
+		t.Errorf("unrelated checkout route reweighted: %v", checkout.Route)
+	}
+	if api := got.Spec.Http[0]; len(api.Route) != 1 {
+		t.Errorf("api route without canary destination changed: %v", api.Route)
+	}
+}
+
+func TestIstioTrafficManager_CreateCanaryRouteUsesRouting(t *testing.T) {
+	client := istiofake.NewSimpleClientset()
+	clientset := fake.NewSimpleClientset(
+		newVersionedDeployment("test-app", "v1"),
+		newVersionedDeployment("test-app-canary", "v2"),
+	)
+	manager := NewIstioTrafficManager(client, clientset)
+	canary := newTestCanary()
+	canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{
+		Istio: &deployv1alpha1.IstioTrafficRouting{
+			VirtualService: "shop",
+			Routes:         []string{"primary"},
+			Hosts:          []string{"shop.example.com"},
+			Gateways:       []string{"istio-system/public"},
+		},
+	}
+	ctx := context.Background()
+
+	if err := manager.CreateCanaryRoute(ctx, canary); err != nil {
+		t.Fatalf("CreateCanaryRoute() error = %v", err)
+	}
+
+	vs, err := client.NetworkingV1beta1().VirtualServices("default").Get(ctx, "shop", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get virtual service: %v", err)
+	}
+	if len(vs.Spec.Hosts) != 1 || vs.Spec.Hosts[0] != "shop.example.com" {
+		t.Errorf("Hosts = %v, want [shop.example.com]", vs.Spec.Hosts)
+	}
+	if len(vs.Spec.Gateways) != 1 || vs.Spec.Gateways[0] != "istio-system/public" {
+		t.Errorf("Gateways = %v, want [istio-system/public]", vs.Spec.Gateways)
+	}
+	if vs.Spec.Http[0].Name != "primary" {
+		t.Errorf("route name = %q, want primary", vs.Spec.Http[0].Name)
+	}
+
+	if err := manager.CreateCanaryRoute(ctx, canary); err != nil {
+		t.Errorf("CreateCanaryRoute() on existing virtualservice error = %v", err)
+	}
+}
+
+func newL4VirtualService() *v1beta1.VirtualService {
+	return &v1beta1.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{Name: "broker", Namespace: "default"},
+		Spec: networkingv1beta1.VirtualService{
+			Hosts: []string{"test-app"},
+			Tls: []*networkingv1beta1.TLSRoute{
+				{
+					Match: []*networkingv1beta1.TLSMatchAttributes{{Port: 443, SniHosts: []string{"grpc.example.com"}}},
+					Route: []*networkingv1beta1.RouteDestination{
+						{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "stable"}, Weight: 100},
+					},
+				},
+			},
+			Tcp: []*networkingv1beta1.TCPRoute{
+				{
+					Match: []*networkingv1beta1.L4MatchAttributes{{Port: 1883}},
+					Route: []*networkingv1beta1.RouteDestination{
+						{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "stable"}, Weight: 100},
+						{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "canary"}, Weight: 0},
+					},
+				},
+				{
+					Match: []*networkingv1beta1.L4MatchAttributes{{Port: 6379}},
+					Route: []*networkingv1beta1.RouteDestination{
+						{Destination: &networkingv1beta1.Destination{Host: "redis", Subset: "stable"}, Weight: 100},
+						{Destination: &networkingv1beta1.Destination{Host: "redis", Subset: "canary"}, Weight: 0},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestIstioTrafficManager_UpdateWeightL4Routes(t *testing.T) {
+	tests := []struct {
+		name    string
+		routing deployv1alpha1.IstioTrafficRouting
+		tls     []int32
+		tcp     []int32
+		wantErr bool
+	}{
+		{
+			name:    "all routes with both subsets",
+			routing: deployv1alpha1.IstioTrafficRouting{VirtualService: "broker"},
+			tls:     []int32{100},
+			tcp:     []int32{60, 40},
+		},
+		{
+			name: "selected tls route",
+			routing: deployv1alpha1.IstioTrafficRouting{
+				VirtualService: "broker",
+				TLSRoutes:      []deployv1alpha1.IstioTLSRoute{{Port: 443, SNIHosts: []string{"grpc.example.com"}}},
+			},
+			tls: []int32{60, 40},
+			tcp: []int32{100, 0},
+		},
+		{
+			name: "selected tcp route",
+			routing: deployv1alpha1.IstioTrafficRouting{
+				VirtualService: "broker",
+				TCPRoutes:      []deployv1alpha1.IstioTCPRoute{{Port: 1883}},
+			},
+			tls: []int32{100},
+			tcp: []int32{60, 40},
+		},
+		{
+			name: "unmatched selector",
+			routing: deployv1alpha1.IstioTrafficRouting{
+				VirtualService: "broker",
+				TCPRoutes:      []deployv1alpha1.IstioTCPRoute{{Port: 6379}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := istiofake.NewSimpleClientset(newL4VirtualService())
+			manager := NewIstioTrafficManager(client, fake.NewSimpleClientset(
+				newVersionedDeployment("test-app", "v1"),
+				newVersionedDeployment("test-app-canary", "v2"),
+			))
+			canary := newTestCanary()
+			routing := tt.routing
+			canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{Istio: &routing}
+			ctx := context.Background()
+
+			err := manager.UpdateWeight(ctx, canary, 40)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateWeight() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			vs, _ := client.NetworkingV1beta1().VirtualServices("default").Get(ctx, "broker", metav1.GetOptions{})
+			if got := l4Weights(vs.Spec.Tls[0].Route); !slices.Equal(got, tt.tls) {
+				t.Errorf("tls weights = %v, want %v", got, tt.tls)
+			}
+			if got := l4Weights(vs.Spec.Tcp[0].Route); !slices.Equal(got, tt.tcp) {
+				t.Errorf("tcp weights = %v, want %v", got, tt.tcp)
+			}
+			if got := l4Weights(vs.Spec.Tcp[1].Route); !slices.Equal(got, []int32{100, 0}) {
+				t.Errorf("unrelated tcp route weights = %v, want unchanged", got)
+			}
+		})
+	}
+}
+
+func TestIstioTrafficManager_CleanupL4Routes(t *testing.T) {
+	client := istiofake.NewSimpleClientset(newL4VirtualService())
+	manager := NewIstioTrafficManager(client, fake.NewSimpleClientset())
+	canary := newTestCanary()
+	canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{
+		Istio: &deployv1alpha1.IstioTrafficRouting{VirtualService: "broker"},
+	}
+	ctx := context.Background()
+
+	if err := manager.CleanupCanaryRoute(ctx, canary); err != nil {
+		t.Fatalf("CleanupCanaryRoute() error = %v", err)
+	}
+
+	vs, _ := client.NetworkingV1beta1().VirtualServices("default").Get(ctx, "broker", metav1.GetOptions{})
+	route := vs.Spec.Tcp[0].Route
+	if len(route) != 1 || route[0].Destination.Subset != "" || route[0].Destination.Host != "test-app" {
+		t.Errorf("tcp route after cleanup = %v, want single destination without subset", route)
+	}
+}
+
+func l4Weights(destinations []*networkingv1beta1.RouteDestination) []int32 {
+	weights := make([]int32, 0, len(destinations))
+	for _, destination := range destinations {
+		weights = append(weights, destination.Weight)
+	}
+	return weights
+}
+
+func TestIstioTrafficManager_VerifyWeight(t *testing.T) {
+	vs := newMultiRouteVirtualService()
+	vs.Spec.Http[2].Route[0].Weight = 70
+	vs.Spec.Http[2].Route[1].Weight = 30
+	vs.Spec.Http = append(vs.Spec.Http, &networkingv1beta1.HTTPRoute{
+		Name: "assets",
+		Route: []*networkingv1beta1.HTTPRouteDestination{
+			{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "stable"}, Weight: 50},
+			{Destination: &networkingv1beta1.Destination{Host: "test-app", Subset: "canary"}, Weight: 50},
+		},
+	})
+	client := istiofake.NewSimpleClientset(vs)
+	manager := NewIstioTrafficManager(client, fake.NewSimpleClientset())
+	canary := newTestCanary()
+	canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{
+		Istio: &deployv1alpha1.IstioTrafficRouting{VirtualService: "shop", Routes: []string{"static"}},
+	}
+	ctx := context.Background()
+
+	if got, err := manager.VerifyWeight(ctx, canary, 30); err != nil || got != 30 {
+		t.Errorf("VerifyWeight() = %d, %v, want 30", got, err)
+	}
+
+	canary.Spec.TrafficRouting.Istio.Routes = nil
+	if got, err := manager.VerifyWeight(ctx, canary, 30); err != nil || got != 50 {
+		t.Errorf("VerifyWeight() = %d, %v, want the diverging 50 of the assets route", got, err)
+	}
+}
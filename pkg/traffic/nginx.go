@@ -3,19 +3,32 @@ package traffic
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strconv"
 
 	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/workload"
 	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	canaryAnnotation                = "nginx.ingress.kubernetes.io/canary"
+	canaryWeightAnnotation          = "nginx.ingress.kubernetes.io/canary-weight"
+	canaryByHeaderAnnotation        = "nginx.ingress.kubernetes.io/canary-by-header"
+	canaryByHeaderValueAnnotation   = "nginx.ingress.kubernetes.io/canary-by-header-value"
+	canaryByHeaderPatternAnnotation = "nginx.ingress.kubernetes.io/canary-by-header-pattern"
+	canaryByCookieAnnotation        = "nginx.ingress.kubernetes.io/canary-by-cookie"
+	mirrorTargetAnnotation          = "nginx.ingress.kubernetes.io/mirror-target"
+)
+
 type NginxTrafficManager struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewNginxTrafficManager(clientset *kubernetes.Clientset) *NginxTrafficManager {
+func NewNginxTrafficManager(clientset kubernetes.Interface) *NginxTrafficManager {
 	return &NginxTrafficManager{
 		clientset: clientset,
 	}
@@ -32,7 +45,7 @@ func (m *NginxTrafficManager) UpdateWeight(ctx context.Context, canary *deployv1
 	if ingress.Annotations == nil {
 		ingress.Annotations = make(map[string]string)
 	}
-	ingress.Annotations["nginx.ingress.kubernetes.io/canary-weight"] = strconv.Itoa(weight)
+	ingress.Annotations[canaryWeightAnnotation] = strconv.Itoa(weight)
 
 	_, err = m.clientset.NetworkingV1().
 		Ingresses(canary.Namespace).
@@ -41,47 +54,342 @@ func (m *NginxTrafficManager) UpdateWeight(ctx context.Context, canary *deployv1
 	return err
 }
 
+// VerifyWeight reads the canary-weight annotation of the canary Ingress. An
+// Ingress not marked as canary receives no weighted traffic.
+func (m *NginxTrafficManager) VerifyWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) (int, error) {
+	ingress, err := m.clientset.NetworkingV1().
+		Ingresses(canary.Namespace).
+		Get(ctx, canary.Name+"-canary", metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	if ingress.Annotations[canaryAnnotation] != "true" {
+		return 0, nil
+	}
+	value, ok := ingress.Annotations[canaryWeightAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	observed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s annotation %q on %s: %w", canaryWeightAnnotation, value, ingress.Name, err)
+	}
+	return observed, nil
+}
+
+// CreateCanaryRoute creates or refreshes the canary Ingress from the stable
+// Ingress. ingress-nginx only applies a canary Ingress whose host and path
+// match the stable one, so the hosts, paths, TLS and class are copied from
+// the rules routing to the stable Service, with their backends pointed at
+// the canary Service.
 func (m *NginxTrafficManager) CreateCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
-	pathType := networkingv1.PathTypePrefix
-	ingress := &networkingv1.Ingress{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      canary.Name + "-canary",
-			Namespace: canary.Namespace,
-			Annotations: map[string]string{
-				"nginx.ingress.kubernetes.io/canary":        "true",
-				"nginx.ingress.kubernetes.io/canary-weight": "0",
-			},
-		},
-		Spec: networkingv1.IngressSpec{
-			Rules: []networkingv1.IngressRule{
-				{
-					Host: canary.Name + ".example.com",
-					IngressRuleValue: networkingv1.IngressRuleValue{
-						HTTP: &networkingv1.HTTPIngressRuleValue{
-							Paths: []networkingv1.HTTPIngressPath{
-								{
-									Path:     "/",
-									PathType: &pathType,
-									Backend: networkingv1.IngressBackend{
-										Service: &networkingv1.IngressServiceBackend{
-											Name: fmt.Sprintf("%s-canary", canary.Spec.TargetDeployment),
-											Port: networkingv1.ServiceBackendPort{
-												Number: 80,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
+	ingresses := m.clientset.NetworkingV1().Ingresses(canary.Namespace)
+	stable, err := ingresses.Get(ctx, stableIngressName(canary), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get stable ingress %s: %w", stableIngressName(canary), err)
+	}
+
+	ports, err := m.canaryPorts(ctx, canary)
+	if err != nil {
+		return err
+	}
+	spec, err := canaryIngressSpec(stable, canary, ports)
+	if err != nil {
+		return err
+	}
+
+	existing, err := ingresses.Get(ctx, canary.Name+"-canary", metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		ingress := &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      canary.Name + "-canary",
+				Namespace: canary.Namespace,
+				Annotations: map[string]string{
+					canaryAnnotation:       "true",
+					canaryWeightAnnotation: "0",
 				},
 			},
-		},
+			Spec: spec,
+		}
+		_, err = ingresses.Create(ctx, ingress, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if existing.Annotations == nil {
+		existing.Annotations = make(map[string]string)
+	}
+	existing.Annotations[canaryAnnotation] = "true"
+	if _, ok := existing.Annotations[canaryWeightAnnotation]; !ok {
+		existing.Annotations[canaryWeightAnnotation] = "0"
+	}
+	existing.Spec = spec
+	_, err = ingresses.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+func canaryIngressSpec(stable *networkingv1.Ingress, canary *deployv1alpha1.CanaryDeployment, ports map[int32]int32) (networkingv1.IngressSpec, error) {
+	stableService, canaryService := nginxServices(canary)
+	spec := networkingv1.IngressSpec{IngressClassName: stable.Spec.IngressClassName}
+	for _, tls := range stable.Spec.TLS {
+		spec.TLS = append(spec.TLS, *tls.DeepCopy())
+	}
+
+	for _, rule := range stable.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		var paths []networkingv1.HTTPIngressPath
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.Service == nil || path.Backend.Service.Name != stableService {
+				continue
+			}
+			copied := *path.DeepCopy()
+			copied.Backend.Service.Name = canaryService
+			if port, ok := ports[copied.Backend.Service.Port.Number]; ok {
+				copied.Backend.Service.Port.Number = port
+			}
+			paths = append(paths, copied)
+		}
+		if len(paths) > 0 {
+			spec.Rules = append(spec.Rules, networkingv1.IngressRule{
+				Host:             rule.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths}},
+			})
+		}
+	}
+
+	if len(spec.Rules) == 0 {
+		return spec, fmt.Errorf("stable ingress %s has no path routing to service %s", stable.Name, stableService)
+	}
+	return spec, nil
+}
+
+// mirrorPort returns the canary Service port behind the first stable Ingress
+// path routing to the stable Service, mapped as for the canary Ingress.
+func (m *NginxTrafficManager) mirrorPort(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, stable *networkingv1.Ingress) (int32, error) {
+	stableService, canaryService := nginxServices(canary)
+	var backend *networkingv1.IngressServiceBackend
+	for _, rule := range stable.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.Service != nil && path.Backend.Service.Name == stableService {
+				backend = path.Backend.Service
+				break
+			}
+		}
+		if backend != nil {
+			break
+		}
+	}
+	if backend == nil {
+		return 0, fmt.Errorf("stable ingress %s has no path routing to service %s", stable.Name, stableService)
+	}
+
+	if backend.Port.Name == "" {
+		ports, err := m.canaryPorts(ctx, canary)
+		if err != nil {
+			return 0, err
+		}
+		if port, ok := ports[backend.Port.Number]; ok {
+			return port, nil
+		}
+		return backend.Port.Number, nil
+	}
+
+	service, err := m.clientset.CoreV1().Services(canary.Namespace).Get(ctx, canaryService, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("get canary service: %w", err)
 	}
+	for _, port := range service.Spec.Ports {
+		if port.Name == backend.Port.Name {
+			return port.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("canary service %s has no port named %s", canaryService, backend.Port.Name)
+}
 
-	_, err := m.clientset.NetworkingV1().
+// canaryPorts maps stable Service port numbers to the canary Service ports
+// with the same name, or the same number when unnamed. Backends referring to
+// ports by name need no mapping, and without both Services none is done.
+func (m *NginxTrafficManager) canaryPorts(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) (map[int32]int32, error) {
+	stableName, canaryName := nginxServices(canary)
+	services := m.clientset.CoreV1().Services(canary.Namespace)
+
+	stable, err := services.Get(ctx, stableName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get stable service: %w", err)
+	}
+	canaryService, err := services.Get(ctx, canaryName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get canary service: %w", err)
+	}
+
+	ports := make(map[int32]int32, len(stable.Spec.Ports))
+	for _, stablePort := range stable.Spec.Ports {
+		for _, canaryPort := range canaryService.Spec.Ports {
+			if canaryPort.Name == stablePort.Name && (stablePort.Name != "" || canaryPort.Port == stablePort.Port) {
+				ports[stablePort.Port] = canaryPort.Port
+				break
+			}
+		}
+	}
+	return ports, nil
+}
+
+func nginxRouting(canary *deployv1alpha1.CanaryDeployment) *deployv1alpha1.NginxTrafficRouting {
+	if routing := canary.Spec.TrafficRouting; routing != nil && routing.Nginx != nil {
+		return routing.Nginx
+	}
+	return &deployv1alpha1.NginxTrafficRouting{}
+}
+
+func stableIngressName(canary *deployv1alpha1.CanaryDeployment) string {
+	if name := nginxRouting(canary).StableIngress; name != "" {
+		return name
+	}
+	return workload.TargetName(canary)
+}
+
+// nginxServices returns the Service the stable Ingress routes to and the
+// canary Service. The stable Ingress is left as it is, so with spec.services
+// set its paths are still found by the source Service, while the canary
+// Ingress uses the managed canary Service.
+func nginxServices(canary *deployv1alpha1.CanaryDeployment) (string, string) {
+	routing := nginxRouting(canary)
+	stable, _, canaryService := workload.ServiceNames(canary)
+	if routing.StableService != "" {
+		stable = routing.StableService
+	}
+	if routing.CanaryService != "" {
+		canaryService = routing.CanaryService
+	}
+	return stable, canaryService
+}
+
+// UpdateMatch maps request matches onto the canary-by-header,
+// canary-by-header-value, canary-by-header-pattern and canary-by-cookie
+// annotations. ingress-nginx supports a single header and a single cookie,
+// so at most one match with those conditions is accepted.
+func (m *NginxTrafficManager) UpdateMatch(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, matches []deployv1alpha1.RouteMatch) error {
+	annotations, err := matchAnnotations(matches)
+	if err != nil {
+		return err
+	}
+
+	ingress, err := m.clientset.NetworkingV1().
 		Ingresses(canary.Namespace).
-		Create(ctx, ingress, metav1.CreateOptions{})
+		Get(ctx, canary.Name+"-canary", metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if ingress.Annotations == nil {
+		ingress.Annotations = make(map[string]string)
+	}
+	delete(ingress.Annotations, canaryByHeaderAnnotation)
+	delete(ingress.Annotations, canaryByHeaderValueAnnotation)
+	delete(ingress.Annotations, canaryByHeaderPatternAnnotation)
+	delete(ingress.Annotations, canaryByCookieAnnotation)
+	for key, value := range annotations {
+		ingress.Annotations[key] = value
+	}
+
+	_, err = m.clientset.NetworkingV1().
+		Ingresses(canary.Namespace).
+		Update(ctx, ingress, metav1.UpdateOptions{})
+
+	return err
+}
+
+func matchAnnotations(matches []deployv1alpha1.RouteMatch) (map[string]string, error) {
+	annotations := map[string]string{}
+	if len(matches) == 0 {
+		return annotations, nil
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("nginx supports a single request match, got %d", len(matches))
+	}
+
+	match := matches[0]
+	if len(match.QueryParams) > 0 || len(match.SourceLabels) > 0 {
+		return nil, fmt.Errorf("nginx does not support query parameter or source label matches")
+	}
+	if len(match.Headers) > 1 {
+		return nil, fmt.Errorf("nginx supports a single header match, got %d", len(match.Headers))
+	}
+
+	// Without a value or pattern, ingress-nginx routes requests whose header
+	// is set to "always" to the canary.
+	for name, sm := range match.Headers {
+		annotations[canaryByHeaderAnnotation] = name
+		switch {
+		case sm.Regex != "":
+			annotations[canaryByHeaderPatternAnnotation] = sm.Regex
+		case sm.Prefix != "":
+			annotations[canaryByHeaderPatternAnnotation] = "^" + regexp.QuoteMeta(sm.Prefix)
+		case sm.Exact != "":
+			annotations[canaryByHeaderValueAnnotation] = sm.Exact
+		}
+	}
+
+	if match.Cookie != nil {
+		if match.Cookie.Value != "" && match.Cookie.Value != "always" {
+			return nil, fmt.Errorf("nginx canary-by-cookie only routes cookies set to \"always\"")
+		}
+		annotations[canaryByCookieAnnotation] = match.Cookie.Name
+	}
+
+	return annotations, nil
+}
+
+// UpdateMirror sets mirror-target on the stable Ingress to the canary Service
+// port its stable paths map to. The nginx mirror directive copies every
+// request, so only 0 and 100 percent are supported.
+func (m *NginxTrafficManager) UpdateMirror(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, percent int) error {
+	if percent != 0 && percent != 100 {
+		return fmt.Errorf("nginx can only mirror 0 or 100 percent of requests, got %d", percent)
+	}
+
+	ingress, err := m.clientset.NetworkingV1().
+		Ingresses(canary.Namespace).
+		Get(ctx, stableIngressName(canary), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if percent == 0 {
+		if _, ok := ingress.Annotations[mirrorTargetAnnotation]; !ok {
+			return nil
+		}
+		delete(ingress.Annotations, mirrorTargetAnnotation)
+	} else {
+		if ingress.Annotations == nil {
+			ingress.Annotations = make(map[string]string)
+		}
+		_, canaryService := nginxServices(canary)
+		port, err := m.mirrorPort(ctx, canary, ingress)
+		if err != nil {
+			return err
+		}
+		ingress.Annotations[mirrorTargetAnnotation] = fmt.Sprintf("http://%s.%s.svc.cluster.local:%d$request_uri",
+			canaryService, canary.Namespace, port)
+	}
+
+	_, err = m.clientset.NetworkingV1().
+		Ingresses(canary.Namespace).
+		Update(ctx, ingress, metav1.UpdateOptions{})
 
 	return err
 }
@@ -0,0 +1,380 @@
+package traffic
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNginxTrafficManager_UpdateMatch(t *testing.T) {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-canary-canary",
+			Namespace: "default",
+			Annotations: map[string]string{
+				canaryAnnotation:         "true",
+				canaryWeightAnnotation:   "0",
+				canaryByCookieAnnotation: "stale",
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(ingress)
+	manager := NewNginxTrafficManager(client)
+	ctx := context.Background()
+
+	matches := []deployv1alpha1.RouteMatch{
+		{Headers: map[string]deployv1alpha1.StringMatch{"X-Canary": {Exact: "qa"}}},
+	}
+	if err := manager.UpdateMatch(ctx, newTestCanary(), matches); err != nil {
+		t.Fatalf("UpdateMatch() error = %v", err)
+	}
+
+	updated, err := client.NetworkingV1().Ingresses("default").Get(ctx, "test-canary-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get ingress: %v", err)
+	}
+	if updated.Annotations[canaryByHeaderAnnotation] != "X-Canary" {
+		t.Errorf("canary-by-header = %q, want X-Canary", updated.Annotations[canaryByHeaderAnnotation])
+	}
+	if updated.Annotations[canaryByHeaderValueAnnotation] != "qa" {
+		t.Errorf("canary-by-header-value = %q, want qa", updated.Annotations[canaryByHeaderValueAnnotation])
+	}
+	if _, ok := updated.Annotations[canaryByCookieAnnotation]; ok {
+		t.Error("stale canary-by-cookie annotation not removed")
+	}
+}
+
+func TestMatchAnnotations(t *testing.T) {
+	tests := []struct {
+		name  string
+		match deployv1alpha1.RouteMatch
+		want  map[string]string
+	}{
+		{
+			name:  "header set to always",
+			match: deployv1alpha1.RouteMatch{Headers: map[string]deployv1alpha1.StringMatch{"X-Canary": {}}},
+			want:  map[string]string{canaryByHeaderAnnotation: "X-Canary"},
+		},
+		{
+			name:  "exact header value",
+			match: deployv1alpha1.RouteMatch{Headers: map[string]deployv1alpha1.StringMatch{"X-Canary": {Exact: "qa"}}},
+			want:  map[string]string{canaryByHeaderAnnotation: "X-Canary", canaryByHeaderValueAnnotation: "qa"},
+		},
+		{
+			name:  "header pattern",
+			match: deployv1alpha1.RouteMatch{Headers: map[string]deployv1alpha1.StringMatch{"X-User": {Regex: "^(alice|bob)$"}}},
+			want:  map[string]string{canaryByHeaderAnnotation: "X-User", canaryByHeaderPatternAnnotation: "^(alice|bob)$"},
+		},
+		{
+			name:  "header prefix",
+			match: deployv1alpha1.RouteMatch{Headers: map[string]deployv1alpha1.StringMatch{"X-Session": {Prefix: "qa."}}},
+			want:  map[string]string{canaryByHeaderAnnotation: "X-Session", canaryByHeaderPatternAnnotation: `^qa\.`},
+		},
+		{
+			name: "header and cookie",
+			match: deployv1alpha1.RouteMatch{
+				Headers: map[string]deployv1alpha1.StringMatch{"X-Canary": {Exact: "qa"}},
+				Cookie:  &deployv1alpha1.CookieMatch{Name: "qa-session"},
+			},
+			want: map[string]string{
+				canaryByHeaderAnnotation:      "X-Canary",
+				canaryByHeaderValueAnnotation: "qa",
+				canaryByCookieAnnotation:      "qa-session",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchAnnotations([]deployv1alpha1.RouteMatch{tt.match})
+			if err != nil {
+				t.Fatalf("matchAnnotations() error = %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("matchAnnotations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchAnnotations_Unsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		matches []deployv1alpha1.RouteMatch
+	}{
+		{
+			name:    "multiple matches",
+			matches: []deployv1alpha1.RouteMatch{{}, {}},
+		},
+		{
+			name: "query parameters",
+			matches: []deployv1alpha1.RouteMatch{
+				{QueryParams: map[string]deployv1alpha1.StringMatch{"beta": {Exact: "1"}}},
+			},
+		},
+		{
+			name: "cookie with custom value",
+			matches: []deployv1alpha1.RouteMatch{
+				{Cookie: &deployv1alpha1.CookieMatch{Name: "beta", Value: "yes"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := matchAnnotations(tt.matches); err == nil {
+				t.Error("matchAnnotations() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNginxTrafficManager_UpdateMirror(t *testing.T) {
+	client := fake.NewSimpleClientset(newStableIngress())
+	manager := NewNginxTrafficManager(client)
+	canary := newTestCanary()
+	ctx := context.Background()
+
+	if err := manager.UpdateMirror(ctx, canary, 30); err == nil {
+		t.Error("UpdateMirror(30) error = nil, want error for partial mirroring")
+	}
+
+	if err := manager.UpdateMirror(ctx, canary, 100); err != nil {
+		t.Fatalf("UpdateMirror(100) error = %v", err)
+	}
+	updated, _ := client.NetworkingV1().Ingresses("default").Get(ctx, "test-app", metav1.GetOptions{})
+	want := "http://test-app-canary.default.svc.cluster.local:8080$request_uri"
+	if updated.Annotations[mirrorTargetAnnotation] != want {
+		t.Errorf("mirror-target = %q, want %q", updated.Annotations[mirrorTargetAnnotation], want)
+	}
+
+	if err := manager.UpdateMirror(ctx, canary, 0); err != nil {
+		t.Fatalf("UpdateMirror(0) error = %v", err)
+	}
+	updated, _ = client.NetworkingV1().Ingresses("default").Get(ctx, "test-app", metav1.GetOptions{})
+	if _, ok := updated.Annotations[mirrorTargetAnnotation]; ok {
+		t.Error("mirror-target annotation not removed")
+	}
+}
+
+func TestNginxTrafficManager_UpdateMirrorMapsPort(t *testing.T) {
+	named := newStableIngress()
+	named.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port = networkingv1.ServiceBackendPort{Name: "http"}
+
+	tests := []struct {
+		name    string
+		ingress *networkingv1.Ingress
+		want    string
+	}{
+		{name: "port number", ingress: newStableIngress(), want: "http://test-app-canary.default.svc.cluster.local:9090$request_uri"},
+		{name: "port name", ingress: named, want: "http://test-app-canary.default.svc.cluster.local:9090$request_uri"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(tt.ingress, newPortService("test-app", 8080), newPortService("test-app-canary", 9090))
+			manager := NewNginxTrafficManager(client)
+			ctx := context.Background()
+
+			if err := manager.UpdateMirror(ctx, newTestCanary(), 100); err != nil {
+				t.Fatalf("UpdateMirror(100) error = %v", err)
+			}
+			updated, _ := client.NetworkingV1().Ingresses("default").Get(ctx, "test-app", metav1.GetOptions{})
+			if got := updated.Annotations[mirrorTargetAnnotation]; got != tt.want {
+				t.Errorf("mirror-target = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func newStableIngress() *networkingv1.Ingress {
+	className := "nginx-public"
+	pathType := networkingv1.PathTypePrefix
+	backend := func(service string, port int32) networkingv1.IngressBackend {
+		return networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+			Name: service,
+			Port: networkingv1.ServiceBackendPort{Number: port},
+		}}
+	}
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-app",
+			Namespace:   "default",
+			Annotations: map[string]string{"nginx.ingress.kubernetes.io/rewrite-target": "/"},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &className,
+			TLS:              []networkingv1.IngressTLS{{Hosts: []string{"app.example.com"}, SecretName: "app-tls"}},
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: "app.example.com",
+					IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{
+							{Path: "/api", PathType: &pathType, Backend: backend("test-app", 8080)},
+							{Path: "/docs", PathType: &pathType, Backend: backend("docs", 80)},
+						},
+					}},
+				},
+				{
+					Host: "docs.example.com",
+					IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{
+							{Path: "/", PathType: &pathType, Backend: backend("docs", 80)},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func newPortService(name string, port int32) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: port}}},
+	}
+}
+
+func TestNginxTrafficManager_CreateCanaryRouteMirrorsStableIngress(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newStableIngress(),
+		newPortService("test-app", 8080),
+		newPortService("test-app-canary", 9090),
+	)
+	manager := NewNginxTrafficManager(client)
+	ctx := context.Background()
+
+	if err := manager.CreateCanaryRoute(ctx, newTestCanary()); err != nil {
+		t.Fatalf("CreateCanaryRoute() error = %v", err)
+	}
+
+	ingress, err := client.NetworkingV1().Ingresses("default").Get(ctx, "test-canary-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get canary ingress: %v", err)
+	}
+	if ingress.Annotations[canaryAnnotation] != "true" || ingress.Annotations[canaryWeightAnnotation] != "0" {
+		t.Errorf("annotations = %v, want canary with weight 0", ingress.Annotations)
+	}
+	if ingress.Spec.IngressClassName == nil || *ingress.Spec.IngressClassName != "nginx-public" {
+		t.Errorf("ingressClassName = %v, want nginx-public", ingress.Spec.IngressClassName)
+	}
+	if len(ingress.Spec.TLS) != 1 || ingress.Spec.TLS[0].SecretName != "app-tls" {
+		t.Errorf("tls = %v, want copied from stable", ingress.Spec.TLS)
+	}
+	if len(ingress.Spec.Rules) != 1 || ingress.Spec.Rules[0].Host != "app.example.com" {
+		t.Fatalf("rules = %v, want only the app.example.com rule", ingress.Spec.Rules)
+	}
+	paths := ingress.Spec.Rules[0].HTTP.Paths
+	if len(paths) != 1 || paths[0].Path != "/api" {
+		t.Fatalf("paths = %v, want only /api", paths)
+	}
+	service := paths[0].Backend.Service
+	if service.Name != "test-app-canary" || service.Port.Number != 9090 {
+		t.Errorf("backend = %s:%d, want test-app-canary:9090", service.Name, service.Port.Number)
+	}
+
+	if err := manager.UpdateWeight(ctx, newTestCanary(), 30); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+	if err := manager.CreateCanaryRoute(ctx, newTestCanary()); err != nil {
+		t.Fatalf("CreateCanaryRoute() on existing ingress error = %v", err)
+	}
+	ingress, _ = client.NetworkingV1().Ingresses("default").Get(ctx, "test-canary-canary", metav1.GetOptions{})
+	if ingress.Annotations[canaryWeightAnnotation] != "30" {
+		t.Errorf("canary-weight = %q after refresh, want 30 kept", ingress.Annotations[canaryWeightAnnotation])
+	}
+}
+
+func TestNginxTrafficManager_CreateCanaryRouteWithManagedServices(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newStableIngress(),
+		newPortService("test-app", 8080),
+		newPortService("test-app-canary", 9090),
+	)
+	manager := NewNginxTrafficManager(client)
+	ctx := context.Background()
+	canary := newTestCanary()
+	canary.Spec.Services = &deployv1alpha1.ManagedServices{}
+
+	if err := manager.CreateCanaryRoute(ctx, canary); err != nil {
+		t.Fatalf("CreateCanaryRoute() error = %v", err)
+	}
+
+	ingress, err := client.NetworkingV1().Ingresses("default").Get(ctx, "test-canary-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get canary ingress: %v", err)
+	}
+	paths := ingress.Spec.Rules[0].HTTP.Paths
+	if len(paths) != 1 || paths[0].Path != "/api" {
+		t.Fatalf("paths = %v, want only /api", paths)
+	}
+	if service := paths[0].Backend.Service; service.Name != "test-app-canary" {
+		t.Errorf("backend = %s, want test-app-canary", service.Name)
+	}
+}
+
+func TestNginxTrafficManager_CreateCanaryRouteErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		routing *deployv1alpha1.NginxTrafficRouting
+	}{
+		{name: "missing stable ingress"},
+		{
+			name:    "no path to the stable service",
+			objects: []runtime.Object{newStableIngress()},
+			routing: &deployv1alpha1.NginxTrafficRouting{StableService: "other"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewNginxTrafficManager(fake.NewSimpleClientset(tt.objects...))
+			canary := newTestCanary()
+			if tt.routing != nil {
+				canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{Nginx: tt.routing}
+			}
+			if err := manager.CreateCanaryRoute(context.Background(), canary); err == nil {
+				t.Error("CreateCanaryRoute() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNginxTrafficManager_VerifyWeight(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        int
+		wantErr     bool
+	}{
+		{name: "weight", annotations: map[string]string{canaryAnnotation: "true", canaryWeightAnnotation: "20"}, want: 20},
+		{name: "no weight", annotations: map[string]string{canaryAnnotation: "true"}, want: 0},
+		{name: "not a canary", annotations: map[string]string{canaryWeightAnnotation: "20"}, want: 0},
+		{name: "invalid weight", annotations: map[string]string{canaryAnnotation: "true", canaryWeightAnnotation: "x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress := &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-canary-canary", Namespace: "default", Annotations: tt.annotations},
+			}
+			manager := NewNginxTrafficManager(fake.NewSimpleClientset(ingress))
+
+			got, err := manager.VerifyWeight(context.Background(), newTestCanary(), 20)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyWeight() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("VerifyWeight() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
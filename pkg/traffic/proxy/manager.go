@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+// Manager is a traffic manager whose routes live in the controller process.
+// It serves every canary using the proxy provider, picking the canary's Proxy
+// by the request Host among spec.trafficRouting.proxy.hosts, which default to
+// the canary name. Routes are kept in memory only: after a restart, drift
+// detection restores the weight of rollouts in progress and SyncRoutes that
+// of ended ones. A route outlives its rollout, keeping all traffic on the new
+// version once completed or on the stable version once rolled back, and is
+// removed only when its CanaryDeployment is deleted.
+type Manager struct {
+	metrics *Metrics
+
+	mu     sync.RWMutex
+	routes map[string]*route
+	hosts  map[string]*route
+}
+
+type route struct {
+	key     string
+	options Options
+	hosts   []string
+	proxy   *Proxy
+}
+
+func NewManager(metrics *Metrics) *Manager {
+	return &Manager{
+		metrics: metrics,
+		routes:  make(map[string]*route),
+		hosts:   make(map[string]*route),
+	}
+}
+
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	m.mu.RLock()
+	rt, ok := m.hosts[strings.ToLower(host)]
+	m.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	rt.proxy.ServeHTTP(w, r)
+}
+
+func (m *Manager) UpdateWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) error {
+	p, err := m.ensure(canary)
+	if err != nil {
+		return err
+	}
+	return p.SetWeight(weight)
+}
+
+func (m *Manager) CreateCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	_, err := m.ensure(canary)
+	return err
+}
+
+// VerifyWeight reports 0 for a canary without a route, such as one lost in a
+// restart, so that drift detection restores it.
+func (m *Manager) VerifyWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) (int, error) {
+	m.mu.RLock()
+	rt, ok := m.routes[routeKey(canary)]
+	m.mu.RUnlock()
+	if !ok {
+		return 0, nil
+	}
+	return rt.proxy.Weight(), nil
+}
+
+func (m *Manager) UpdateMatch(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, matches []deployv1alpha1.RouteMatch) error {
+	p, err := m.ensure(canary)
+	if err != nil {
+		return err
+	}
+	return p.SetMatches(matches)
+}
+
+// CleanupCanaryRoute keeps the route of a rolled back canary, sending all
+// requests to the stable version, so that its hosts are still served.
+func (m *Manager) CleanupCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	m.mu.RLock()
+	rt, ok := m.routes[routeKey(canary)]
+	m.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if err := rt.proxy.SetMatches(nil); err != nil {
+		return err
+	}
+	return rt.proxy.SetWeight(0)
+}
+
+// SyncRoutes removes the routes of deleted canaries, releasing their hosts
+// for other canaries, and recreates the routes of completed and rolled back
+// canaries lost in a restart.
+func (m *Manager) SyncRoutes(ctx context.Context, canaries []*deployv1alpha1.CanaryDeployment) error {
+	listed := make(map[string]bool, len(canaries))
+	for _, canary := range canaries {
+		listed[routeKey(canary)] = true
+	}
+
+	m.mu.Lock()
+	for key, rt := range m.routes {
+		if listed[key] {
+			continue
+		}
+		for _, host := range rt.hosts {
+			delete(m.hosts, host)
+		}
+		delete(m.routes, key)
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, canary := range canaries {
+		if err := m.restore(canary); err != nil {
+			errs = append(errs, fmt.Errorf("canary %s: %w", routeKey(canary), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// restore recreates the missing route of an ended canary with the weight its
+// rollout ended with. Rollouts in progress are left to drift detection.
+func (m *Manager) restore(canary *deployv1alpha1.CanaryDeployment) error {
+	var weight int
+	switch canary.Status.Phase {
+	case "Completed":
+		weight = 100
+	case "Failed":
+		weight = 0
+	default:
+		return nil
+	}
+	if routing := canary.Spec.TrafficRouting; routing == nil || routing.Proxy == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	_, ok := m.routes[routeKey(canary)]
+	m.mu.RUnlock()
+	if ok {
+		return nil
+	}
+	p, err := m.ensure(canary)
+	if err != nil {
+		return err
+	}
+	return p.SetWeight(weight)
+}
+
+// ensure returns the Proxy of a canary, creating it or, when the proxy
+// settings changed, replacing it with one that keeps the weight and matches.
+func (m *Manager) ensure(canary *deployv1alpha1.CanaryDeployment) (*Proxy, error) {
+	settings := canary.Spec.TrafficRouting
+	if settings == nil || settings.Proxy == nil {
+		return nil, fmt.Errorf("canary %s/%s has no spec.trafficRouting.proxy", canary.Namespace, canary.Name)
+	}
+
+	options := Options{
+		App:           canary.Name,
+		CanaryVersion: canary.Spec.CanaryVersion,
+		StableURL:     settings.Proxy.StableURL,
+		CanaryURL:     settings.Proxy.CanaryURL,
+		StickyCookie:  settings.Proxy.StickyCookie,
+	}
+	hosts := proxyHosts(canary)
+	key := routeKey(canary)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.routes[key]
+	if ok && existing.options == options && slices.Equal(existing.hosts, hosts) {
+		return existing.proxy, nil
+	}
+	for _, host := range hosts {
+		if other, taken := m.hosts[host]; taken && other.key != key {
+			return nil, fmt.Errorf("proxy host %q is already used by canary %s", host, other.key)
+		}
+	}
+
+	p, err := New(options, m.metrics)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		existing.proxy.mu.RLock()
+		p.weight, p.matches = existing.proxy.weight, existing.proxy.matches
+		existing.proxy.mu.RUnlock()
+		for _, host := range existing.hosts {
+			delete(m.hosts, host)
+		}
+	}
+
+	rt := &route{key: key, options: options, hosts: hosts, proxy: p}
+	m.routes[key] = rt
+	for _, host := range hosts {
+		m.hosts[host] = rt
+	}
+	return p, nil
+}
+
+func routeKey(canary *deployv1alpha1.CanaryDeployment) string {
+	return canary.Namespace + "/" + canary.Name
+}
+
+func proxyHosts(canary *deployv1alpha1.CanaryDeployment) []string {
+	configured := canary.Spec.TrafficRouting.Proxy.Hosts
+	if len(configured) == 0 {
+		return []string{strings.ToLower(canary.Name)}
+	}
+	hosts := make([]string, 0, len(configured))
+	for _, host := range configured {
+		hosts = append(hosts, strings.ToLower(host))
+	}
+	return hosts
+}
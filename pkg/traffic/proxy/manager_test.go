@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newProxyCanary(t *testing.T, name string, hosts ...string) *deployv1alpha1.CanaryDeployment {
+	t.Helper()
+	return &deployv1alpha1.CanaryDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: deployv1alpha1.CanaryDeploymentSpec{
+			CanaryVersion: "v2",
+			TrafficRouting: &deployv1alpha1.TrafficRouting{
+				Proxy: &deployv1alpha1.ProxyTrafficRouting{
+					Hosts:     hosts,
+					StableURL: newUpstream(t, name+"-stable", http.StatusOK).URL,
+					CanaryURL: newUpstream(t, name+"-canary", http.StatusOK).URL,
+				},
+			},
+		},
+	}
+}
+
+func TestManager_DispatchesByHost(t *testing.T) {
+	manager := NewManager(nil)
+	shop := newProxyCanary(t, "shop", "Shop.example.com")
+	cart := newProxyCanary(t, "cart")
+
+	if err := manager.UpdateWeight(context.Background(), shop, 100); err != nil {
+		t.Fatalf("UpdateWeight(shop) error = %v", err)
+	}
+	if err := manager.CreateCanaryRoute(context.Background(), cart); err != nil {
+		t.Fatalf("CreateCanaryRoute(cart) error = %v", err)
+	}
+
+	tests := []struct {
+		host       string
+		want       string
+		wantStatus int
+	}{
+		{host: "shop.example.com:8000", want: "shop-canary", wantStatus: http.StatusOK},
+		{host: "cart", want: "cart-stable", wantStatus: http.StatusOK},
+		{host: "unknown", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = tt.host
+			body, resp := serve(t, manager, r)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.want != "" && body != tt.want {
+				t.Errorf("served by %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_HostConflict(t *testing.T) {
+	manager := NewManager(nil)
+	if err := manager.CreateCanaryRoute(context.Background(), newProxyCanary(t, "shop", "shop.example.com")); err != nil {
+		t.Fatalf("CreateCanaryRoute(shop) error = %v", err)
+	}
+	if err := manager.CreateCanaryRoute(context.Background(), newProxyCanary(t, "web", "shop.example.com")); err == nil {
+		t.Errorf("CreateCanaryRoute(web) error = nil, want host conflict")
+	}
+}
+
+func servedBy(t *testing.T, manager *Manager, host string, header http.Header) (string, int) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = host
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	body, resp := serve(t, manager, r)
+	return body, resp.StatusCode
+}
+
+func TestManager_RoutesOutliveRollouts(t *testing.T) {
+	manager := NewManager(nil)
+	ctx := context.Background()
+	shop := newProxyCanary(t, "shop", "shop.example.com")
+	beta := http.Header{"X-Beta": {"1"}}
+
+	// Completion pins the route to the new version.
+	if err := manager.UpdateWeight(ctx, shop, 100); err != nil {
+		t.Fatalf("UpdateWeight(100) error = %v", err)
+	}
+	if body, status := servedBy(t, manager, "shop.example.com", nil); status != http.StatusOK || body != "shop-canary" {
+		t.Errorf("after completion served by %s (%d), want shop-canary", body, status)
+	}
+
+	// Rollback pins the route to the stable version and clears its matches.
+	err := manager.UpdateMatch(ctx, shop, []deployv1alpha1.RouteMatch{
+		{Headers: map[string]deployv1alpha1.StringMatch{"x-beta": {Exact: "1"}}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateMatch() error = %v", err)
+	}
+	if err := manager.CleanupCanaryRoute(ctx, shop); err != nil {
+		t.Fatalf("CleanupCanaryRoute() error = %v", err)
+	}
+	if got, _ := manager.VerifyWeight(ctx, shop, 0); got != 0 {
+		t.Errorf("VerifyWeight() after rollback = %d, want 0", got)
+	}
+	if body, status := servedBy(t, manager, "shop.example.com", beta); status != http.StatusOK || body != "shop-stable" {
+		t.Errorf("after rollback matching request served by %s (%d), want shop-stable", body, status)
+	}
+
+	web := newProxyCanary(t, "web", "shop.example.com")
+	if err := manager.CreateCanaryRoute(ctx, web); err == nil {
+		t.Errorf("CreateCanaryRoute(web) on the host of an ended canary error = nil, want host conflict")
+	}
+
+	// Only deleting the CanaryDeployment removes the route.
+	if err := manager.SyncRoutes(ctx, []*deployv1alpha1.CanaryDeployment{shop}); err != nil {
+		t.Fatalf("SyncRoutes() with shop error = %v", err)
+	}
+	if _, status := servedBy(t, manager, "shop.example.com", nil); status != http.StatusOK {
+		t.Errorf("status while shop exists = %d, want %d", status, http.StatusOK)
+	}
+	if err := manager.SyncRoutes(ctx, nil); err != nil {
+		t.Fatalf("SyncRoutes() without shop error = %v", err)
+	}
+	if _, status := servedBy(t, manager, "shop.example.com", nil); status != http.StatusNotFound {
+		t.Errorf("status after deletion = %d, want %d", status, http.StatusNotFound)
+	}
+	if err := manager.CreateCanaryRoute(ctx, web); err != nil {
+		t.Errorf("CreateCanaryRoute(web) reusing a released host error = %v", err)
+	}
+}
+
+func TestManager_SyncRoutesRestoresEndedRollouts(t *testing.T) {
+	completed := newProxyCanary(t, "shop")
+	completed.Status.Phase = "Completed"
+	failed := newProxyCanary(t, "cart")
+	failed.Status.Phase = "Failed"
+	progressing := newProxyCanary(t, "web")
+	progressing.Status.Phase = "Progressing"
+
+	manager := NewManager(nil)
+	ctx := context.Background()
+	if err := manager.SyncRoutes(ctx, []*deployv1alpha1.CanaryDeployment{completed, failed, progressing}); err != nil {
+		t.Fatalf("SyncRoutes() error = %v", err)
+	}
+
+	tests := []struct {
+		host       string
+		want       string
+		wantStatus int
+	}{
+		{host: "shop", want: "shop-canary", wantStatus: http.StatusOK},
+		{host: "cart", want: "cart-stable", wantStatus: http.StatusOK},
+		{host: "web", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			body, status := servedBy(t, manager, tt.host, nil)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.want != "" && body != tt.want {
+				t.Errorf("served by %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_RequiresProxyRouting(t *testing.T) {
+	manager := NewManager(nil)
+	canary := newProxyCanary(t, "shop")
+	canary.Spec.TrafficRouting = nil
+	if err := manager.UpdateWeight(context.Background(), canary, 10); err == nil {
+		t.Errorf("UpdateWeight() error = nil, want error")
+	}
+}
+
+func TestManager_VerifyWeight(t *testing.T) {
+	manager := NewManager(nil)
+	canary := newProxyCanary(t, "shop")
+
+	if got, err := manager.VerifyWeight(context.Background(), canary, 30); err != nil || got != 0 {
+		t.Errorf("VerifyWeight() before route = %d, %v, want 0, nil", got, err)
+	}
+	if err := manager.UpdateWeight(context.Background(), canary, 30); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+	if got, err := manager.VerifyWeight(context.Background(), canary, 30); err != nil || got != 30 {
+		t.Errorf("VerifyWeight() = %d, %v, want 30, nil", got, err)
+	}
+}
+
+func TestManager_ChangedSettingsKeepWeightAndMatches(t *testing.T) {
+	manager := NewManager(nil)
+	canary := newProxyCanary(t, "shop", "shop.example.com")
+	ctx := context.Background()
+
+	if err := manager.UpdateWeight(ctx, canary, 40); err != nil {
+		t.Fatalf("UpdateWeight() error = %v", err)
+	}
+	err := manager.UpdateMatch(ctx, canary, []deployv1alpha1.RouteMatch{
+		{Headers: map[string]deployv1alpha1.StringMatch{"x-beta": {Exact: "1"}}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateMatch() error = %v", err)
+	}
+
+	canary.Spec.TrafficRouting.Proxy.Hosts = []string{"shop.internal"}
+	canary.Spec.TrafficRouting.Proxy.CanaryURL = newUpstream(t, "shop-canary-v3", http.StatusOK).URL
+	if err := manager.CreateCanaryRoute(ctx, canary); err != nil {
+		t.Fatalf("CreateCanaryRoute() error = %v", err)
+	}
+
+	if got, _ := manager.VerifyWeight(ctx, canary, 40); got != 40 {
+		t.Errorf("VerifyWeight() = %d, want 40", got)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "shop.internal"
+	r.Header.Set("X-Beta", "1")
+	if body, _ := serve(t, manager, r); body != "shop-canary-v3" {
+		t.Errorf("served by %s, want shop-canary-v3", body)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "shop.example.com"
+	if _, resp := serve(t, manager, r); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("old host status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
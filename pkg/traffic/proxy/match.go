@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+// requestMatch is a compiled RouteMatch. All of its conditions must hold.
+type requestMatch struct {
+	headers map[string]stringMatcher
+	cookie  *deployv1alpha1.CookieMatch
+	query   map[string]stringMatcher
+}
+
+// stringMatcher matches a value exactly, by prefix or by a regular
+// expression that, as in Istio, has to match the whole value. Without any of
+// them, the value only has to be present.
+type stringMatcher struct {
+	exact  string
+	prefix string
+	regex  *regexp.Regexp
+}
+
+func compileMatches(matches []deployv1alpha1.RouteMatch) ([]requestMatch, error) {
+	compiled := make([]requestMatch, 0, len(matches))
+	for _, match := range matches {
+		if len(match.SourceLabels) > 0 {
+			return nil, fmt.Errorf("proxy does not support sourceLabels matches")
+		}
+		headers, err := compileStringMatches(match.Headers)
+		if err != nil {
+			return nil, err
+		}
+		query, err := compileStringMatches(match.QueryParams)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, requestMatch{headers: headers, cookie: match.Cookie, query: query})
+	}
+	return compiled, nil
+}
+
+func compileStringMatches(in map[string]deployv1alpha1.StringMatch) (map[string]stringMatcher, error) {
+	out := make(map[string]stringMatcher, len(in))
+	for name, sm := range in {
+		matcher := stringMatcher{exact: sm.Exact, prefix: sm.Prefix}
+		if sm.Regex != "" {
+			re, err := regexp.Compile("^(?:" + sm.Regex + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex for %s: %w", name, err)
+			}
+			matcher.regex = re
+		}
+		out[name] = matcher
+	}
+	return out, nil
+}
+
+func (m requestMatch) matches(r *http.Request) bool {
+	for name, matcher := range m.headers {
+		values, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok || !matcher.matches(strings.Join(values, ",")) {
+			return false
+		}
+	}
+
+	if len(m.query) > 0 {
+		query := r.URL.Query()
+		for name, matcher := range m.query {
+			if !query.Has(name) || !matcher.matches(query.Get(name)) {
+				return false
+			}
+		}
+	}
+
+	if m.cookie != nil {
+		want := m.cookie.Value
+		if want == "" {
+			want = "always"
+		}
+		cookie, err := r.Cookie(m.cookie.Name)
+		if err != nil || cookie.Value != want {
+			return false
+		}
+	}
+	return true
+}
+
+func (m stringMatcher) matches(value string) bool {
+	switch {
+	case m.regex != nil:
+		return m.regex.MatchString(value)
+	case m.prefix != "":
+		return strings.HasPrefix(value, m.prefix)
+	case m.exact != "":
+		return value == m.exact
+	default:
+		return true
+	}
+}
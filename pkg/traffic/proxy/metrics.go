@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are the per-version request metrics of the proxy. Their names and
+// labels match the default queries of the Prometheus metrics analyzer, with
+// app set to the CanaryDeployment name, so rollouts behind the proxy are
+// analysed without custom queries.
+type Metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Requests proxied to each version, by response status.",
+		}, []string{"app", "version", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of requests proxied to each version.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"app", "version"}),
+	}
+	if err := registerer.Register(m.requests); err != nil {
+		return nil, err
+	}
+	if err := registerer.Register(m.duration); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Metrics) observe(app, version string, status int, elapsed time.Duration) {
+	m.requests.WithLabelValues(app, version, strconv.Itoa(status)).Inc()
+	m.duration.WithLabelValues(app, version).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+)
+
+// Values of the sticky session cookie, and the version label of the stable
+// upstream in metrics.
+const (
+	stableTarget = "stable"
+	canaryTarget = "canary"
+)
+
+// Options configure the Proxy of one canary.
+type Options struct {
+	// App labels the metrics, normally the CanaryDeployment name.
+	App string
+	// CanaryVersion is the version label of canary requests in metrics.
+	// Stable requests are labelled "stable".
+	CanaryVersion string
+	StableURL     string
+	CanaryURL     string
+	// StickyCookie names the cookie pinning a client to the version it was
+	// first sent to. Empty disables sticky sessions.
+	StickyCookie string
+}
+
+// Proxy splits the requests of one canary between the stable and canary
+// upstreams. Requests matching one of its matches always go to the canary
+// and the rest are split by weight. With sticky sessions, a client keeps
+// its version for as long as that version receives weighted traffic.
+type Proxy struct {
+	options Options
+	stable  http.Handler
+	canary  http.Handler
+	metrics *Metrics
+	intn    func(n int) int
+
+	mu      sync.RWMutex
+	weight  int
+	matches []requestMatch
+}
+
+func New(options Options, metrics *Metrics) (*Proxy, error) {
+	stable, err := upstream(options.StableURL)
+	if err != nil {
+		return nil, fmt.Errorf("stable upstream: %w", err)
+	}
+	canary, err := upstream(options.CanaryURL)
+	if err != nil {
+		return nil, fmt.Errorf("canary upstream: %w", err)
+	}
+
+	return &Proxy{
+		options: options,
+		stable:  stable,
+		canary:  canary,
+		metrics: metrics,
+		intn:    rand.Intn,
+	}, nil
+}
+
+func upstream(rawURL string) (http.Handler, error) {
+	if rawURL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("url %q needs a scheme and host", rawURL)
+	}
+	return httputil.NewSingleHostReverseProxy(target), nil
+}
+
+func (p *Proxy) Weight() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.weight
+}
+
+func (p *Proxy) SetWeight(weight int) error {
+	if weight < 0 || weight > 100 {
+		return fmt.Errorf("weight %d out of range 0-100", weight)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.weight = weight
+	return nil
+}
+
+// SetMatches replaces the request matches routed to the canary. An empty
+// list removes them.
+func (p *Proxy) SetMatches(matches []deployv1alpha1.RouteMatch) error {
+	compiled, err := compileMatches(matches)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.matches = compiled
+	return nil
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target, sticky := p.pick(r)
+	if sticky {
+		http.SetCookie(w, &http.Cookie{Name: p.options.StickyCookie, Value: target, Path: "/", HttpOnly: true})
+	}
+
+	handler, version := p.stable, stableTarget
+	if target == canaryTarget {
+		handler, version = p.canary, p.options.CanaryVersion
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	handler.ServeHTTP(recorder, r)
+	if p.metrics != nil {
+		p.metrics.observe(p.options.App, version, recorder.status, time.Since(start))
+	}
+}
+
+// pick returns the upstream for a request and whether the sticky session
+// cookie should be set to it.
+func (p *Proxy) pick(r *http.Request) (string, bool) {
+	p.mu.RLock()
+	weight, matches := p.weight, p.matches
+	p.mu.RUnlock()
+
+	for _, match := range matches {
+		if match.matches(r) {
+			return canaryTarget, false
+		}
+	}
+
+	if p.options.StickyCookie != "" {
+		if cookie, err := r.Cookie(p.options.StickyCookie); err == nil {
+			switch {
+			case cookie.Value == canaryTarget && weight > 0:
+				return canaryTarget, false
+			case cookie.Value == stableTarget && weight < 100:
+				return stableTarget, false
+			}
+		}
+	}
+
+	target := stableTarget
+	if p.intn(100) < weight {
+		target = canaryTarget
+	}
+	return target, p.options.StickyCookie != ""
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newUpstream serves its name with the given status.
+func newUpstream(t *testing.T, name string, status int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, name)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestProxy(t *testing.T, options Options) (*Proxy, *Metrics) {
+	t.Helper()
+	options.App = "shop"
+	options.CanaryVersion = "v2"
+	options.StableURL = newUpstream(t, "stable", http.StatusOK).URL
+	if options.CanaryURL == "" {
+		options.CanaryURL = newUpstream(t, "canary", http.StatusOK).URL
+	}
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+	p, err := New(options, metrics)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return p, metrics
+}
+
+func serve(t *testing.T, handler http.Handler, r *http.Request) (string, *http.Response) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	body, err := io.ReadAll(w.Result().Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return string(body), w.Result()
+}
+
+func TestNew_InvalidUpstream(t *testing.T) {
+	tests := []struct {
+		name      string
+		stableURL string
+		canaryURL string
+	}{
+		{name: "missing stable", canaryURL: "http://canary"},
+		{name: "missing canary", stableURL: "http://stable"},
+		{name: "no scheme", stableURL: "stable:8080", canaryURL: "http://canary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(Options{StableURL: tt.stableURL, CanaryURL: tt.canaryURL}, nil); err == nil {
+				t.Errorf("New() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestProxy_SplitsByWeight(t *testing.T) {
+	p, _ := newTestProxy(t, Options{})
+	if err := p.SetWeight(30); err != nil {
+		t.Fatalf("SetWeight() error = %v", err)
+	}
+
+	tests := []struct {
+		roll int
+		want string
+	}{
+		{roll: 0, want: "canary"},
+		{roll: 29, want: "canary"},
+		{roll: 30, want: "stable"},
+		{roll: 99, want: "stable"},
+	}
+
+	for _, tt := range tests {
+		p.intn = func(int) int { return tt.roll }
+		body, _ := serve(t, p, httptest.NewRequest(http.MethodGet, "/", nil))
+		if body != tt.want {
+			t.Errorf("roll %d: served by %s, want %s", tt.roll, body, tt.want)
+		}
+	}
+}
+
+func TestProxy_SetWeightOutOfRange(t *testing.T) {
+	p, _ := newTestProxy(t, Options{})
+	for _, weight := range []int{-1, 101} {
+		if err := p.SetWeight(weight); err == nil {
+			t.Errorf("SetWeight(%d) error = nil, want error", weight)
+		}
+	}
+}
+
+func TestProxy_MatchesGoToCanary(t *testing.T) {
+	p, _ := newTestProxy(t, Options{StickyCookie: "shop-version"})
+	p.intn = func(int) int { return 99 }
+	err := p.SetMatches([]deployv1alpha1.RouteMatch{
+		{Headers: map[string]deployv1alpha1.StringMatch{"x-user": {Regex: "beta-[0-9]+"}}},
+		{Cookie: &deployv1alpha1.CookieMatch{Name: "canary"}},
+		{QueryParams: map[string]deployv1alpha1.StringMatch{"tier": {Prefix: "gold"}}},
+	})
+	if err != nil {
+		t.Fatalf("SetMatches() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		prepare func(r *http.Request)
+		path    string
+		want    string
+	}{
+		{name: "no match", want: "stable"},
+		{name: "header regex", prepare: func(r *http.Request) { r.Header.Set("X-User", "beta-42") }, want: "canary"},
+		{name: "header regex is anchored", prepare: func(r *http.Request) { r.Header.Set("X-User", "beta-42x") }, want: "stable"},
+		{name: "cookie always", prepare: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "canary", Value: "always"}) }, want: "canary"},
+		{name: "cookie other value", prepare: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "canary", Value: "never"}) }, want: "stable"},
+		{name: "query prefix", path: "/?tier=golden", want: "canary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			if path == "" {
+				path = "/"
+			}
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			if tt.prepare != nil {
+				tt.prepare(r)
+			}
+			body, resp := serve(t, p, r)
+			if body != tt.want {
+				t.Errorf("served by %s, want %s", body, tt.want)
+			}
+			if tt.want == "canary" && len(resp.Cookies()) > 0 {
+				t.Errorf("matched request set cookie %v, want none", resp.Cookies())
+			}
+		})
+	}
+}
+
+func TestProxy_SetMatchesRejectsSourceLabels(t *testing.T) {
+	p, _ := newTestProxy(t, Options{})
+	err := p.SetMatches([]deployv1alpha1.RouteMatch{{SourceLabels: map[string]string{"app": "web"}}})
+	if err == nil {
+		t.Errorf("SetMatches() error = nil, want error")
+	}
+}
+
+func TestProxy_StickySession(t *testing.T) {
+	p, _ := newTestProxy(t, Options{StickyCookie: "shop-version"})
+	if err := p.SetWeight(10); err != nil {
+		t.Fatalf("SetWeight() error = %v", err)
+	}
+
+	p.intn = func(int) int { return 0 }
+	body, resp := serve(t, p, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := resp.Cookies()
+	if body != "canary" || len(cookies) != 1 || cookies[0].Value != "canary" {
+		t.Fatalf("first request served by %s with cookies %v, want canary with canary cookie", body, cookies)
+	}
+
+	p.intn = func(int) int { return 99 }
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	if body, resp := serve(t, p, r); body != "canary" || len(resp.Cookies()) != 0 {
+		t.Errorf("sticky request served by %s with cookies %v, want canary without cookie", body, resp.Cookies())
+	}
+
+	if err := p.SetWeight(0); err != nil {
+		t.Fatalf("SetWeight() error = %v", err)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	body, resp = serve(t, p, r)
+	if body != "stable" || len(resp.Cookies()) != 1 || resp.Cookies()[0].Value != "stable" {
+		t.Errorf("request after rollback served by %s with cookies %v, want stable with stable cookie", body, resp.Cookies())
+	}
+}
+
+func TestProxy_Metrics(t *testing.T) {
+	canary := newUpstream(t, "canary", http.StatusServiceUnavailable)
+	p, metrics := newTestProxy(t, Options{CanaryURL: canary.URL})
+	if err := p.SetWeight(50); err != nil {
+		t.Fatalf("SetWeight() error = %v", err)
+	}
+
+	for _, roll := range []int{0, 0, 99} {
+		p.intn = func(int) int { return roll }
+		serve(t, p, httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	want := `
+# HELP http_requests_total Requests proxied to each version, by response status.
+# TYPE http_requests_total counter
+http_requests_total{app="shop",status="200",version="stable"} 1
+http_requests_total{app="shop",status="503",version="v2"} 2
+`
+	if err := testutil.CollectAndCompare(metrics.requests, strings.NewReader(want)); err != nil {
+		t.Errorf("http_requests_total: %v", err)
+	}
+	if got := testutil.CollectAndCount(metrics.duration); got != 2 {
+		t.Errorf("http_request_duration_seconds series = %d, want 2", got)
+	}
+}
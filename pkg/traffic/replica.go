@@ -0,0 +1,217 @@
+package traffic
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/workload"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const totalReplicasAnnotation = "deploy.codedance.io/total-replicas"
+
+// ReplicaTrafficManager approximates traffic weight by the ratio of canary to
+// stable pods behind a shared Service, for clusters without a mesh or ingress
+// controller. The combined replica count is recorded on the stable Deployment
+// when traffic is first split, so capacity stays the same at every step.
+type ReplicaTrafficManager struct {
+	clientset   kubernetes.Interface
+	minReplicas int32
+}
+
+func NewReplicaTrafficManager(clientset kubernetes.Interface, minReplicas int32) *ReplicaTrafficManager {
+	if minReplicas < 1 {
+		minReplicas = 1
+	}
+	return &ReplicaTrafficManager{
+		clientset:   clientset,
+		minReplicas: minReplicas,
+	}
+}
+
+func (m *ReplicaTrafficManager) UpdateWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) error {
+	if weight < 0 || weight > 100 {
+		return fmt.Errorf("weight %d out of range 0-100", weight)
+	}
+
+	if kind := workload.Ref(canary).Kind; kind != workload.KindDeployment {
+		return fmt.Errorf("replica-ratio traffic requires a Deployment target, got %s", kind)
+	}
+	if weight > 0 {
+		if err := checkReplicaOwnership(canary); err != nil {
+			return err
+		}
+	}
+
+	deployments := m.clientset.AppsV1().Deployments(canary.Namespace)
+
+	stable, err := deployments.Get(ctx, workload.TargetName(canary), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get stable deployment: %w", err)
+	}
+	canaryDeployment, err := deployments.Get(ctx, workload.TargetName(canary)+"-canary", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get canary deployment: %w", err)
+	}
+
+	total, recorded, err := totalReplicas(stable, canaryDeployment)
+	if err != nil {
+		return err
+	}
+	stableReplicas, canaryReplicas := m.splitReplicas(total, weight)
+
+	// The total is only pinned while both versions serve traffic, so a
+	// finished or rolled back rollout picks up later manual scaling.
+	pinned := weight > 0 && weight < 100
+	updateStable := func() error {
+		if pinned == recorded && replicasOf(stable) == stableReplicas {
+			return nil
+		}
+		if pinned {
+			if stable.Annotations == nil {
+				stable.Annotations = make(map[string]string)
+			}
+			stable.Annotations[totalReplicasAnnotation] = strconv.Itoa(int(total))
+		} else {
+			delete(stable.Annotations, totalReplicasAnnotation)
+		}
+		stable.Spec.Replicas = &stableReplicas
+		if _, err := deployments.Update(ctx, stable, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("scale stable deployment: %w", err)
+		}
+		return nil
+	}
+	updateCanary := func() error {
+		if replicasOf(canaryDeployment) == canaryReplicas {
+			return nil
+		}
+		canaryDeployment.Spec.Replicas = &canaryReplicas
+		if _, err := deployments.Update(ctx, canaryDeployment, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("scale canary deployment: %w", err)
+		}
+		return nil
+	}
+
+	// Scale up before scaling down so capacity never dips mid-shift.
+	first, second := updateStable, updateCanary
+	if canaryReplicas > replicasOf(canaryDeployment) {
+		first, second = updateCanary, updateStable
+	}
+	if err := first(); err != nil {
+		return err
+	}
+	if err := second(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// VerifyWeight compares the replicas of both versions with the split
+// UpdateWeight would apply for weight, and otherwise reports the weight the
+// current replica ratio amounts to.
+func (m *ReplicaTrafficManager) VerifyWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) (int, error) {
+	if kind := workload.Ref(canary).Kind; kind != workload.KindDeployment {
+		return 0, fmt.Errorf("replica-ratio traffic requires a Deployment target, got %s", kind)
+	}
+
+	deployments := m.clientset.AppsV1().Deployments(canary.Namespace)
+
+	stable, err := deployments.Get(ctx, workload.TargetName(canary), metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("get stable deployment: %w", err)
+	}
+	canaryDeployment, err := deployments.Get(ctx, workload.TargetName(canary)+"-canary", metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("get canary deployment: %w", err)
+	}
+
+	total, _, err := totalReplicas(stable, canaryDeployment)
+	if err != nil {
+		return 0, err
+	}
+	stableReplicas, canaryReplicas := m.splitReplicas(total, weight)
+	if replicasOf(stable) == stableReplicas && replicasOf(canaryDeployment) == canaryReplicas {
+		return weight, nil
+	}
+	return canaryPercent(int64(replicasOf(stable)), int64(replicasOf(canaryDeployment))), nil
+}
+
+// CreateCanaryRoute records the current capacity and takes the canary out of
+// rotation. Traffic is split by the shared Service, so no route is created,
+// and a canary Deployment not created yet has nothing to take out.
+func (m *ReplicaTrafficManager) CreateCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	if err := checkReplicaOwnership(canary); err != nil {
+		return err
+	}
+	if workload.Ref(canary).Kind == workload.KindDeployment {
+		_, err := m.clientset.AppsV1().Deployments(canary.Namespace).Get(ctx, workload.TargetName(canary)+"-canary", metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get canary deployment: %w", err)
+		}
+	}
+	return m.UpdateWeight(ctx, canary, 0)
+}
+
+// checkReplicaOwnership rejects canaries that also size the canary through
+// spec.scaling or per-step replicas. The replica counts are what split the
+// traffic, so they must have a single owner.
+func checkReplicaOwnership(canary *deployv1alpha1.CanaryDeployment) error {
+	if canary.Spec.Scaling != nil {
+		return fmt.Errorf("spec.scaling cannot be used with replica-ratio traffic, which sizes both versions itself")
+	}
+	for i, step := range canary.Spec.Strategy.Steps {
+		if step.Replicas != nil {
+			return fmt.Errorf("step %d sets replicas, which replica-ratio traffic sizes itself", i)
+		}
+	}
+	return nil
+}
+
+// splitReplicas divides total pods by weight. Each version that should
+// receive traffic keeps at least minReplicas, so small totals may briefly run
+// above the recorded capacity rather than drop a version entirely.
+func (m *ReplicaTrafficManager) splitReplicas(total int32, weight int) (stable, canary int32) {
+	switch weight {
+	case 0:
+		return total, 0
+	case 100:
+		return 0, total
+	}
+
+	canary = int32(math.Round(float64(total) * float64(weight) / 100))
+	if canary > total-m.minReplicas {
+		canary = total - m.minReplicas
+	}
+	if canary < m.minReplicas {
+		canary = m.minReplicas
+	}
+	return max(total-canary, m.minReplicas), canary
+}
+
+func totalReplicas(stable, canary *appsv1.Deployment) (int32, bool, error) {
+	if value, ok := stable.Annotations[totalReplicasAnnotation]; ok {
+		total, err := strconv.Atoi(value)
+		if err != nil || total < 0 {
+			return 0, false, fmt.Errorf("invalid %s annotation %q on %s", totalReplicasAnnotation, value, stable.Name)
+		}
+		return int32(total), true, nil
+	}
+	return replicasOf(stable) + replicasOf(canary), false, nil
+}
+
+func replicasOf(deployment *appsv1.Deployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+	return *deployment.Spec.Replicas
+}
@@ -0,0 +1,180 @@
+package traffic
+
+import (
+	"context"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newReplicaDeployment(name string, replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+}
+
+func TestReplicaTrafficManager_SplitReplicas(t *testing.T) {
+	tests := []struct {
+		name        string
+		minReplicas int32
+		total       int32
+		weight      int
+		wantStable  int32
+		wantCanary  int32
+	}{
+		{name: "no traffic", minReplicas: 1, total: 10, weight: 0, wantStable: 10, wantCanary: 0},
+		{name: "ten percent", minReplicas: 1, total: 10, weight: 10, wantStable: 9, wantCanary: 1},
+		{name: "half", minReplicas: 1, total: 10, weight: 50, wantStable: 5, wantCanary: 5},
+		{name: "full", minReplicas: 1, total: 10, weight: 100, wantStable: 0, wantCanary: 10},
+		{name: "canary minimum", minReplicas: 2, total: 10, weight: 5, wantStable: 8, wantCanary: 2},
+		{name: "stable minimum", minReplicas: 2, total: 10, weight: 95, wantStable: 2, wantCanary: 8},
+		{name: "small total", minReplicas: 1, total: 1, weight: 50, wantStable: 1, wantCanary: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewReplicaTrafficManager(fake.NewSimpleClientset(), tt.minReplicas)
+			stable, canary := m.splitReplicas(tt.total, tt.weight)
+			if stable != tt.wantStable || canary != tt.wantCanary {
+				t.Errorf("splitReplicas(%d, %d) = %d/%d, want %d/%d",
+					tt.total, tt.weight, stable, canary, tt.wantStable, tt.wantCanary)
+			}
+		})
+	}
+}
+
+func TestReplicaTrafficManager_UpdateWeight(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newReplicaDeployment("test-app", 10),
+		newReplicaDeployment("test-app-canary", 0),
+	)
+	manager := NewReplicaTrafficManager(client, 1)
+	canary := newTestCanary()
+	ctx := context.Background()
+
+	replicas := func() (int32, int32, *appsv1.Deployment) {
+		stable, err := client.AppsV1().Deployments("default").Get(ctx, "test-app", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get stable deployment: %v", err)
+		}
+		canaryDeployment, err := client.AppsV1().Deployments("default").Get(ctx, "test-app-canary", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get canary deployment: %v", err)
+		}
+		return *stable.Spec.Replicas, *canaryDeployment.Spec.Replicas, stable
+	}
+
+	steps := []struct {
+		weight     int
+		wantStable int32
+		wantCanary int32
+	}{
+		{weight: 10, wantStable: 9, wantCanary: 1},
+		{weight: 30, wantStable: 7, wantCanary: 3},
+		{weight: 50, wantStable: 5, wantCanary: 5},
+	}
+	for _, step := range steps {
+		if err := manager.UpdateWeight(ctx, canary, step.weight); err != nil {
+			t.Fatalf("UpdateWeight(%d) error = %v", step.weight, err)
+		}
+		stable, canaryReplicas, deployment := replicas()
+		if stable != step.wantStable || canaryReplicas != step.wantCanary {
+			t.Errorf("weight %d: replicas = %d/%d, want %d/%d",
+				step.weight, stable, canaryReplicas, step.wantStable, step.wantCanary)
+		}
+		if deployment.Annotations[totalReplicasAnnotation] != "10" {
+			t.Errorf("weight %d: total annotation = %q, want 10", step.weight, deployment.Annotations[totalReplicasAnnotation])
+		}
+	}
+
+	if err := manager.UpdateWeight(ctx, canary, 0); err != nil {
+		t.Fatalf("UpdateWeight(0) error = %v", err)
+	}
+	stable, canaryReplicas, deployment := replicas()
+	if stable != 10 || canaryReplicas != 0 {
+		t.Errorf("after rollback replicas = %d/%d, want 10/0", stable, canaryReplicas)
+	}
+	if _, ok := deployment.Annotations[totalReplicasAnnotation]; ok {
+		t.Error("total annotation not removed after rollback")
+	}
+}
+
+func TestReplicaTrafficManager_VerifyWeight(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newReplicaDeployment("test-app", 9),
+		newReplicaDeployment("test-app-canary", 1),
+	)
+	manager := NewReplicaTrafficManager(client, 1)
+	canary := newTestCanary()
+	ctx := context.Background()
+
+	if got, err := manager.VerifyWeight(ctx, canary, 10); err != nil || got != 10 {
+		t.Errorf("VerifyWeight() = %d, %v, want 10", got, err)
+	}
+	if got, err := manager.VerifyWeight(ctx, canary, 50); err != nil || got != 10 {
+		t.Errorf("VerifyWeight() = %d, %v, want the observed 10", got, err)
+	}
+}
+
+func TestReplicaTrafficManager_CreateCanaryRouteBeforeCanaryExists(t *testing.T) {
+	client := fake.NewSimpleClientset(newReplicaDeployment("test-app", 10))
+	manager := NewReplicaTrafficManager(client, 1)
+
+	if err := manager.CreateCanaryRoute(context.Background(), newTestCanary()); err != nil {
+		t.Fatalf("CreateCanaryRoute() error = %v", err)
+	}
+	stable, err := client.AppsV1().Deployments("default").Get(context.Background(), "test-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get stable: %v", err)
+	}
+	if *stable.Spec.Replicas != 10 {
+		t.Errorf("stable replicas = %d, want 10", *stable.Spec.Replicas)
+	}
+}
+
+func TestReplicaTrafficManager_RejectsOtherReplicaOwners(t *testing.T) {
+	replicas := int32(3)
+	tests := []struct {
+		name   string
+		modify func(canary *deployv1alpha1.CanaryDeployment)
+	}{
+		{
+			name: "proportional scaling",
+			modify: func(canary *deployv1alpha1.CanaryDeployment) {
+				canary.Spec.Scaling = &deployv1alpha1.ReplicaScaling{}
+			},
+		},
+		{
+			name: "step replicas",
+			modify: func(canary *deployv1alpha1.CanaryDeployment) {
+				canary.Spec.Strategy.Steps = []deployv1alpha1.DeployStep{{Weight: 50, Replicas: &replicas}, {Weight: 100}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(
+				newReplicaDeployment("test-app", 10),
+				newReplicaDeployment("test-app-canary", 0),
+			)
+			manager := NewReplicaTrafficManager(client, 1)
+			canary := newTestCanary()
+			tt.modify(canary)
+
+			if err := manager.CreateCanaryRoute(context.Background(), canary); err == nil {
+				t.Error("CreateCanaryRoute() error = nil, want error")
+			}
+			if err := manager.UpdateWeight(context.Background(), canary, 50); err == nil {
+				t.Error("UpdateWeight(50) error = nil, want error")
+			}
+			if err := manager.UpdateWeight(context.Background(), canary, 0); err != nil {
+				t.Errorf("UpdateWeight(0) error = %v, want rollback to proceed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package traffic
+
+import (
+	"context"
+	"fmt"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	"github.com/codefarmer009/codedance/pkg/workload"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const smiAPIVersion = "split.smi-spec.io/v1alpha2"
+
+var trafficSplitGVR = schema.GroupVersionResource{Group: "split.smi-spec.io", Version: "v1alpha2", Resource: "trafficsplits"}
+
+// SMITrafficManager splits traffic with an SMI TrafficSplit, as implemented
+// by Linkerd and Open Service Mesh. The mesh sends requests for the root
+// Service to the backend Services in proportion to their weights.
+type SMITrafficManager struct {
+	dynamicClient dynamic.Interface
+}
+
+func NewSMITrafficManager(dynamicClient dynamic.Interface) *SMITrafficManager {
+	return &SMITrafficManager{
+		dynamicClient: dynamicClient,
+	}
+}
+
+func (m *SMITrafficManager) UpdateWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) error {
+	client := m.dynamicClient.Resource(trafficSplitGVR).Namespace(canary.Namespace)
+	name := trafficSplitName(canary)
+	split, err := client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get trafficsplit %s: %w", name, err)
+	}
+
+	backends, _, err := unstructured.NestedSlice(split.Object, "spec", "backends")
+	if err != nil {
+		return fmt.Errorf("invalid backends in trafficsplit %s: %w", name, err)
+	}
+	stableName, canaryName := smiServices(canary)
+	backends = setBackendWeight(backends, stableName, int64(100-weight))
+	backends = setBackendWeight(backends, canaryName, int64(weight))
+	if err := unstructured.SetNestedSlice(split.Object, backends, "spec", "backends"); err != nil {
+		return err
+	}
+
+	if _, err := client.Update(ctx, split, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update trafficsplit %s: %w", name, err)
+	}
+	return nil
+}
+
+func (m *SMITrafficManager) VerifyWeight(ctx context.Context, canary *deployv1alpha1.CanaryDeployment, weight int) (int, error) {
+	name := trafficSplitName(canary)
+	split, err := m.dynamicClient.Resource(trafficSplitGVR).Namespace(canary.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get trafficsplit %s: %w", name, err)
+	}
+
+	backends, _, err := unstructured.NestedSlice(split.Object, "spec", "backends")
+	if err != nil {
+		return 0, fmt.Errorf("invalid backends in trafficsplit %s: %w", name, err)
+	}
+	stableName, canaryName := smiServices(canary)
+	return canaryPercent(backendWeight(backends, stableName), backendWeight(backends, canaryName)), nil
+}
+
+// CreateCanaryRoute creates the TrafficSplit with all traffic on the stable
+// backend, unless it already exists.
+func (m *SMITrafficManager) CreateCanaryRoute(ctx context.Context, canary *deployv1alpha1.CanaryDeployment) error {
+	client := m.dynamicClient.Resource(trafficSplitGVR).Namespace(canary.Namespace)
+	name := trafficSplitName(canary)
+	_, err := client.Get(ctx, name, metav1.GetOptions{})
+	if err == nil || !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	stableName, canaryName := smiServices(canary)
+	split := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": smiAPIVersion,
+		"kind":       "TrafficSplit",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": canary.Namespace,
+		},
+		"spec": map[string]interface{}{
+			"service": smiRootService(canary),
+			"backends": []interface{}{
+				map[string]interface{}{"service": stableName, "weight": int64(100)},
+				map[string]interface{}{"service": canaryName, "weight": int64(0)},
+			},
+		},
+	}}
+	if _, err := client.Create(ctx, split, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("create trafficsplit %s: %w", name, err)
+	}
+	return nil
+}
+
+func smiRouting(canary *deployv1alpha1.CanaryDeployment) *deployv1alpha1.SMITrafficRouting {
+	if routing := canary.Spec.TrafficRouting; routing != nil && routing.SMI != nil {
+		return routing.SMI
+	}
+	return &deployv1alpha1.SMITrafficRouting{}
+}
+
+func trafficSplitName(canary *deployv1alpha1.CanaryDeployment) string {
+	if name := smiRouting(canary).TrafficSplit; name != "" {
+		return name
+	}
+	return canary.Name
+}
+
+func smiRootService(canary *deployv1alpha1.CanaryDeployment) string {
+	if name := smiRouting(canary).RootService; name != "" {
+		return name
+	}
+	service, _, _ := workload.ServiceNames(canary)
+	return service
+}
+
+func smiServices(canary *deployv1alpha1.CanaryDeployment) (string, string) {
+	routing := smiRouting(canary)
+	_, stable, canaryService := workload.ServiceNames(canary)
+	if routing.StableService != "" {
+		stable = routing.StableService
+	}
+	if routing.CanaryService != "" {
+		canaryService = routing.CanaryService
+	}
+	return stable, canaryService
+}
+
+// setBackendWeight sets the weight of the backend for the Service, adding
+// the backend if the TrafficSplit does not list it yet.
+func setBackendWeight(backends []interface{}, service string, weight int64) []interface{} {
+	for _, b := range backends {
+		backend, ok := b.(map[string]interface{})
+		if ok && backend["service"] == service {
+			backend["weight"] = weight
+			return backends
+		}
+	}
+	return append(backends, map[string]interface{}{"service": service, "weight": weight})
+}
+
+// backendWeight returns the weight of the backend for the Service, or 0 if
+// the TrafficSplit does not list it.
+func backendWeight(backends []interface{}, service string) int64 {
+	for _, b := range backends {
+		backend, ok := b.(map[string]interface{})
+		if !ok || backend["service"] != service {
+			continue
+		}
+		switch weight := backend["weight"].(type) {
+		case int64:
+			return weight
+		case float64:
+			return int64(weight)
+		}
+	}
+	return 0
+}
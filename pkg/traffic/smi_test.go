@@ -0,0 +1,157 @@
+package traffic
+
+import (
+	"context"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newSMIClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{trafficSplitGVR: "TrafficSplitList"},
+		objects...,
+	)
+}
+
+func splitWeights(t *testing.T, split *unstructured.Unstructured) map[string]int64 {
+	t.Helper()
+	backends, _, err := unstructured.NestedSlice(split.Object, "spec", "backends")
+	if err != nil {
+		t.Fatalf("read backends: %v", err)
+	}
+	weights := map[string]int64{}
+	for _, b := range backends {
+		backend := b.(map[string]interface{})
+		weights[backend["service"].(string)] = backend["weight"].(int64)
+	}
+	return weights
+}
+
+func TestSMITrafficManager_CreateCanaryRoute(t *testing.T) {
+	client := newSMIClient()
+	manager := NewSMITrafficManager(client)
+	canary := newTestCanary()
+	canary.Spec.TrafficRouting = &deployv1alpha1.TrafficRouting{
+		SMI: &deployv1alpha1.SMITrafficRouting{RootService: "test-app-root"},
+	}
+	ctx := context.Background()
+
+	if err := manager.CreateCanaryRoute(ctx, canary); err != nil {
+		t.Fatalf("CreateCanaryRoute() error = %v", err)
+	}
+
+	split, err := client.Resource(trafficSplitGVR).Namespace("default").Get(ctx, "test-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get trafficsplit: %v", err)
+	}
+	if root, _, _ := unstructured.NestedString(split.Object, "spec", "service"); root != "test-app-root" {
+		t.Errorf("root service = %q, want test-app-root", root)
+	}
+	if weights := splitWeights(t, split); weights["test-app"] != 100 || weights["test-app-canary"] != 0 {
+		t.Errorf("weights = %v, want all traffic on stable", weights)
+	}
+
+	if err := manager.CreateCanaryRoute(ctx, canary); err != nil {
+		t.Errorf("CreateCanaryRoute() on existing trafficsplit error = %v", err)
+	}
+}
+
+func TestSMITrafficManager_UpdateWeight(t *testing.T) {
+	tests := []struct {
+		name     string
+		backends []interface{}
+		weight   int
+		want     map[string]int64
+	}{
+		{
+			name: "both backends",
+			backends: []interface{}{
+				map[string]interface{}{"service": "test-app", "weight": int64(100)},
+				map[string]interface{}{"service": "test-app-canary", "weight": int64(0)},
+			},
+			weight: 30,
+			want:   map[string]int64{"test-app": 70, "test-app-canary": 30},
+		},
+		{
+			name: "canary backend added",
+			backends: []interface{}{
+				map[string]interface{}{"service": "test-app", "weight": int64(100)},
+			},
+			weight: 10,
+			want:   map[string]int64{"test-app": 90, "test-app-canary": 10},
+		},
+		{
+			name: "full promotion",
+			backends: []interface{}{
+				map[string]interface{}{"service": "test-app-canary", "weight": int64(50)},
+				map[string]interface{}{"service": "test-app", "weight": int64(50)},
+			},
+			weight: 100,
+			want:   map[string]int64{"test-app": 0, "test-app-canary": 100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			split := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": smiAPIVersion,
+				"kind":       "TrafficSplit",
+				"metadata":   map[string]interface{}{"name": "test-canary", "namespace": "default"},
+				"spec":       map[string]interface{}{"service": "test-app", "backends": tt.backends},
+			}}
+			client := newSMIClient(split)
+			manager := NewSMITrafficManager(client)
+			ctx := context.Background()
+
+			if err := manager.UpdateWeight(ctx, newTestCanary(), tt.weight); err != nil {
+				t.Fatalf("UpdateWeight() error = %v", err)
+			}
+
+			got, _ := client.Resource(trafficSplitGVR).Namespace("default").Get(ctx, "test-canary", metav1.GetOptions{})
+			weights := splitWeights(t, got)
+			if len(weights) != len(tt.want) {
+				t.Errorf("weights = %v, want %v", weights, tt.want)
+			}
+			for service, want := range tt.want {
+				if weights[service] != want {
+					t.Errorf("weight of %s = %d, want %d", service, weights[service], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSMITrafficManager_UpdateWeightMissingSplit(t *testing.T) {
+	manager := NewSMITrafficManager(newSMIClient())
+
+	if err := manager.UpdateWeight(context.Background(), newTestCanary(), 10); err == nil {
+		t.Error("UpdateWeight() error = nil, want error for a missing trafficsplit")
+	}
+}
+
+func TestSMITrafficManager_VerifyWeight(t *testing.T) {
+	split := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": smiAPIVersion,
+		"kind":       "TrafficSplit",
+		"metadata":   map[string]interface{}{"name": "test-canary", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"service": "test-app",
+			"backends": []interface{}{
+				map[string]interface{}{"service": "test-app", "weight": int64(900)},
+				map[string]interface{}{"service": "test-app-canary", "weight": int64(100)},
+			},
+		},
+	}}
+	manager := NewSMITrafficManager(newSMIClient(split))
+
+	if got, err := manager.VerifyWeight(context.Background(), newTestCanary(), 30); err != nil || got != 10 {
+		t.Errorf("VerifyWeight() = %d, %v, want 10", got, err)
+	}
+}
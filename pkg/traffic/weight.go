@@ -0,0 +1,23 @@
+package traffic
+
+import "math"
+
+// canaryPercent converts the relative weights of the stable and canary
+// backends into the percentage of traffic the canary receives.
+func canaryPercent(stable, canary int64) int {
+	if stable+canary <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(canary) * 100 / float64(stable+canary)))
+}
+
+// divergingWeight returns the first observed weight that differs from
+// weight, or weight itself when all of them match.
+func divergingWeight(weight int, observed []int) int {
+	for _, w := range observed {
+		if w != weight {
+			return w
+		}
+	}
+	return weight
+}
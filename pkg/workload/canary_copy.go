@@ -0,0 +1,325 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// stableReplicasAnnotation records the stable replica count before it was
+// scaled down alongside the canary, so rollback can restore it.
+const stableReplicasAnnotation = "deploy.codedance.io/stable-replicas"
+
+// The minReplicas and maxReplicas of a canary HorizontalPodAutoscaler before
+// they were raised to the canary's share, so rollback can restore them. An
+// empty minReplicas stands for an unset one.
+const (
+	canaryMinReplicasAnnotation = "deploy.codedance.io/canary-min-replicas"
+	canaryMaxReplicasAnnotation = "deploy.codedance.io/canary-max-replicas"
+)
+
+// canaryCopyWorkload is a Deployment or ReplicaSet whose new version runs
+// in a separate "<name>-canary" object next to the stable one. When scaling
+// is configured the canary is sized in proportion to the weight.
+type canaryCopyWorkload struct {
+	clientset kubernetes.Interface
+	namespace string
+	kind      string
+	name      string
+	scaling   *deployv1alpha1.ReplicaScaling
+}
+
+// object is the part of a Deployment or ReplicaSet the workload needs.
+type object struct {
+	meta        *metav1.ObjectMeta
+	replicas    int32
+	selector    *metav1.LabelSelector
+	setReplicas func(replicas int32)
+	update      func(ctx context.Context) error
+}
+
+func (w *canaryCopyWorkload) canaryName() string {
+	return w.name + "-canary"
+}
+
+func (w *canaryCopyWorkload) get(ctx context.Context, name string) (*object, error) {
+	switch w.kind {
+	case KindReplicaSet:
+		replicaSets := w.clientset.AppsV1().ReplicaSets(w.namespace)
+		rs, err := replicaSets.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replicaset %s: %w", name, err)
+		}
+		return &object{
+			meta:        &rs.ObjectMeta,
+			replicas:    replicasOf(rs.Spec.Replicas),
+			selector:    rs.Spec.Selector,
+			setReplicas: func(replicas int32) { rs.Spec.Replicas = &replicas },
+			update: func(ctx context.Context) error {
+				_, err := replicaSets.Update(ctx, rs, metav1.UpdateOptions{})
+				return err
+			},
+		}, nil
+	default:
+		deployments := w.clientset.AppsV1().Deployments(w.namespace)
+		deployment, err := deployments.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment %s: %w", name, err)
+		}
+		return &object{
+			meta:        &deployment.ObjectMeta,
+			replicas:    replicasOf(deployment.Spec.Replicas),
+			selector:    deployment.Spec.Selector,
+			setReplicas: func(replicas int32) { deployment.Spec.Replicas = &replicas },
+			update: func(ctx context.Context) error {
+				_, err := deployments.Update(ctx, deployment, metav1.UpdateOptions{})
+				return err
+			},
+		}, nil
+	}
+}
+
+// SetWeight sizes the canary when scaling is configured or the step sets an
+// explicit replica count. The canary gets its share of the stable replica
+// count, at least MinReplicas, and the stable version optionally shrinks by
+// the complementary share. A HorizontalPodAutoscaler on the canary has its
+// minimum raised instead, and a stable version managed by one is left to it.
+func (w *canaryCopyWorkload) SetWeight(ctx context.Context, weight int, replicas *int32) error {
+	if w.scaling == nil && replicas == nil {
+		return nil
+	}
+
+	stable, err := w.get(ctx, w.name)
+	if err != nil {
+		return err
+	}
+	stableHPA, err := w.findHPA(ctx, w.name)
+	if err != nil {
+		return err
+	}
+
+	base := stable.replicas
+	if recorded, ok := stable.meta.Annotations[stableReplicasAnnotation]; ok {
+		n, err := strconv.Atoi(recorded)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation %q: %w", stableReplicasAnnotation, recorded, err)
+		}
+		base = int32(n)
+	}
+	if stableHPA != nil {
+		base = stableHPA.Status.CurrentReplicas
+		if base == 0 {
+			base = stable.replicas
+		}
+	}
+
+	canaryReplicas := w.canaryReplicas(base, weight, replicas)
+	if err := w.scaleCanary(ctx, canaryReplicas); err != nil {
+		return err
+	}
+
+	if w.scaling == nil || !w.scaling.ScaleDownStable || stableHPA != nil {
+		return nil
+	}
+
+	stableReplicas := int32(math.Ceil(float64(base) * float64(100-weight) / 100))
+	if stable.replicas == stableReplicas && stable.meta.Annotations[stableReplicasAnnotation] == strconv.Itoa(int(base)) {
+		return nil
+	}
+	if stable.meta.Annotations == nil {
+		stable.meta.Annotations = make(map[string]string)
+	}
+	stable.meta.Annotations[stableReplicasAnnotation] = strconv.Itoa(int(base))
+	stable.setReplicas(stableReplicas)
+	if err := stable.update(ctx); err != nil {
+		return fmt.Errorf("scale stable %s: %w", strings.ToLower(w.kind), err)
+	}
+	return nil
+}
+
+func (w *canaryCopyWorkload) canaryReplicas(base int32, weight int, override *int32) int32 {
+	if override != nil {
+		return *override
+	}
+
+	minReplicas := int32(1)
+	if w.scaling.MinReplicas != nil {
+		minReplicas = *w.scaling.MinReplicas
+	}
+	return max(int32(math.Ceil(float64(base)*float64(weight)/100)), minReplicas)
+}
+
+func (w *canaryCopyWorkload) scaleCanary(ctx context.Context, replicas int32) error {
+	canaryHPA, err := w.findHPA(ctx, w.canaryName())
+	if err != nil {
+		return err
+	}
+	if canaryHPA != nil {
+		if canaryHPA.Spec.MinReplicas != nil && *canaryHPA.Spec.MinReplicas == replicas && canaryHPA.Spec.MaxReplicas >= replicas {
+			return nil
+		}
+		if _, ok := canaryHPA.Annotations[canaryMinReplicasAnnotation]; !ok {
+			if canaryHPA.Annotations == nil {
+				canaryHPA.Annotations = make(map[string]string)
+			}
+			recorded := ""
+			if canaryHPA.Spec.MinReplicas != nil {
+				recorded = strconv.Itoa(int(*canaryHPA.Spec.MinReplicas))
+			}
+			canaryHPA.Annotations[canaryMinReplicasAnnotation] = recorded
+			canaryHPA.Annotations[canaryMaxReplicasAnnotation] = strconv.Itoa(int(canaryHPA.Spec.MaxReplicas))
+		}
+		minReplicas := max(replicas, 1)
+		canaryHPA.Spec.MinReplicas = &minReplicas
+		canaryHPA.Spec.MaxReplicas = max(canaryHPA.Spec.MaxReplicas, minReplicas)
+		if _, err := w.clientset.AutoscalingV2().HorizontalPodAutoscalers(w.namespace).Update(ctx, canaryHPA, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("update canary autoscaler: %w", err)
+		}
+		return nil
+	}
+
+	canary, err := w.get(ctx, w.canaryName())
+	if err != nil {
+		return err
+	}
+	if canary.replicas == replicas {
+		return nil
+	}
+	canary.setReplicas(replicas)
+	if err := canary.update(ctx); err != nil {
+		return fmt.Errorf("scale canary %s: %w", strings.ToLower(w.kind), err)
+	}
+	return nil
+}
+
+// findHPA returns the HorizontalPodAutoscaler targeting the named object,
+// if any.
+func (w *canaryCopyWorkload) findHPA(ctx context.Context, name string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	hpas, err := w.clientset.AutoscalingV2().HorizontalPodAutoscalers(w.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list autoscalers: %w", err)
+	}
+	for i := range hpas.Items {
+		ref := hpas.Items[i].Spec.ScaleTargetRef
+		if ref.Kind == w.kind && ref.Name == name {
+			return &hpas.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (w *canaryCopyWorkload) CanaryPods(ctx context.Context) ([]corev1.Pod, error) {
+	canary, err := w.get(ctx, w.canaryName())
+	if err != nil {
+		return nil, err
+	}
+	return listPods(ctx, w.clientset, w.namespace, canary.selector)
+}
+
+// Rollback scales the canary to zero and restores the stable replica count
+// if it was scaled down during the rollout, and the canary autoscaler bounds
+// if they were raised.
+func (w *canaryCopyWorkload) Rollback(ctx context.Context) error {
+	if err := w.restoreCanaryHPA(ctx); err != nil {
+		return err
+	}
+
+	canary, err := w.get(ctx, w.canaryName())
+	if err != nil {
+		return err
+	}
+	canary.setReplicas(0)
+	if err := canary.update(ctx); err != nil {
+		return err
+	}
+
+	stable, err := w.get(ctx, w.name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	recorded, ok := stable.meta.Annotations[stableReplicasAnnotation]
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(recorded)
+	if err != nil {
+		return fmt.Errorf("invalid %s annotation %q: %w", stableReplicasAnnotation, recorded, err)
+	}
+	delete(stable.meta.Annotations, stableReplicasAnnotation)
+	stable.setReplicas(int32(n))
+	if err := stable.update(ctx); err != nil {
+		return fmt.Errorf("restore stable %s: %w", strings.ToLower(w.kind), err)
+	}
+	return nil
+}
+
+// Complete restores the canary autoscaler bounds and forgets the stable
+// replica count recorded during the rollout, so that the next rollout sizes
+// its canary from the replicas running then.
+func (w *canaryCopyWorkload) Complete(ctx context.Context) error {
+	if err := w.restoreCanaryHPA(ctx); err != nil {
+		return err
+	}
+
+	stable, err := w.get(ctx, w.name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := stable.meta.Annotations[stableReplicasAnnotation]; !ok {
+		return nil
+	}
+	delete(stable.meta.Annotations, stableReplicasAnnotation)
+	if err := stable.update(ctx); err != nil {
+		return fmt.Errorf("update stable %s: %w", strings.ToLower(w.kind), err)
+	}
+	return nil
+}
+
+func (w *canaryCopyWorkload) restoreCanaryHPA(ctx context.Context) error {
+	canaryHPA, err := w.findHPA(ctx, w.canaryName())
+	if err != nil || canaryHPA == nil {
+		return err
+	}
+	recordedMin, ok := canaryHPA.Annotations[canaryMinReplicasAnnotation]
+	if !ok {
+		return nil
+	}
+
+	canaryHPA.Spec.MinReplicas = nil
+	if recordedMin != "" {
+		n, err := strconv.Atoi(recordedMin)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation %q: %w", canaryMinReplicasAnnotation, recordedMin, err)
+		}
+		minReplicas := int32(n)
+		canaryHPA.Spec.MinReplicas = &minReplicas
+	}
+	if recordedMax, ok := canaryHPA.Annotations[canaryMaxReplicasAnnotation]; ok {
+		n, err := strconv.Atoi(recordedMax)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation %q: %w", canaryMaxReplicasAnnotation, recordedMax, err)
+		}
+		canaryHPA.Spec.MaxReplicas = int32(n)
+	}
+	delete(canaryHPA.Annotations, canaryMinReplicasAnnotation)
+	delete(canaryHPA.Annotations, canaryMaxReplicasAnnotation)
+	if _, err := w.clientset.AutoscalingV2().HorizontalPodAutoscalers(w.namespace).Update(ctx, canaryHPA, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("restore canary autoscaler: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package workload
+
+import (
+	"context"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestDeployment(name string, replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+		},
+	}
+}
+
+func newScalingCanary(scaling *deployv1alpha1.ReplicaScaling) *deployv1alpha1.CanaryDeployment {
+	canary := newTestCanary(&deployv1alpha1.WorkloadReference{Kind: KindDeployment, Name: "web"})
+	canary.Spec.Scaling = scaling
+	return canary
+}
+
+func deploymentReplicas(t *testing.T, client *fake.Clientset, name string) int32 {
+	t.Helper()
+
+	deployment, err := client.AppsV1().Deployments("default").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get deployment %s: %v", name, err)
+	}
+	return *deployment.Spec.Replicas
+}
+
+func TestCanaryCopyWorkload_SetWeight(t *testing.T) {
+	three := int32(3)
+	seven := int32(7)
+
+	tests := []struct {
+		name       string
+		scaling    *deployv1alpha1.ReplicaScaling
+		weight     int
+		override   *int32
+		wantCanary int32
+		wantStable int32
+	}{
+		{name: "unmanaged", scaling: nil, weight: 50, wantCanary: 1, wantStable: 10},
+		{name: "proportional", scaling: &deployv1alpha1.ReplicaScaling{}, weight: 25, wantCanary: 3, wantStable: 10},
+		{name: "min replicas", scaling: &deployv1alpha1.ReplicaScaling{MinReplicas: &three}, weight: 5, wantCanary: 3, wantStable: 10},
+		{name: "step override", scaling: &deployv1alpha1.ReplicaScaling{}, weight: 5, override: &seven, wantCanary: 7, wantStable: 10},
+		{name: "override without scaling", scaling: nil, weight: 5, override: &seven, wantCanary: 7, wantStable: 10},
+		{name: "scale down stable", scaling: &deployv1alpha1.ReplicaScaling{ScaleDownStable: true}, weight: 30, wantCanary: 3, wantStable: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(newTestDeployment("web", 10), newTestDeployment("web-canary", 1))
+			target, err := New(client, newScalingCanary(tt.scaling))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if err := target.SetWeight(context.Background(), tt.weight, tt.override); err != nil {
+				t.Fatalf("SetWeight() error = %v", err)
+			}
+			if got := deploymentReplicas(t, client, "web-canary"); got != tt.wantCanary {
+				t.Errorf("canary replicas = %d, want %d", got, tt.wantCanary)
+			}
+			if got := deploymentReplicas(t, client, "web"); got != tt.wantStable {
+				t.Errorf("stable replicas = %d, want %d", got, tt.wantStable)
+			}
+		})
+	}
+}
+
+func TestCanaryCopyWorkload_ScaleDownStableAndRollback(t *testing.T) {
+	client := fake.NewSimpleClientset(newTestDeployment("web", 10), newTestDeployment("web-canary", 0))
+	target, err := New(client, newScalingCanary(&deployv1alpha1.ReplicaScaling{ScaleDownStable: true}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	for _, weight := range []int{20, 50} {
+		if err := target.SetWeight(ctx, weight, nil); err != nil {
+			t.Fatalf("SetWeight(%d) error = %v", weight, err)
+		}
+	}
+	if got := deploymentReplicas(t, client, "web"); got != 5 {
+		t.Errorf("stable replicas at 50%% = %d, want 5 of the original 10", got)
+	}
+	if got := deploymentReplicas(t, client, "web-canary"); got != 5 {
+		t.Errorf("canary replicas at 50%% = %d, want 5", got)
+	}
+
+	if err := target.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if got := deploymentReplicas(t, client, "web"); got != 10 {
+		t.Errorf("stable replicas after rollback = %d, want 10", got)
+	}
+	if got := deploymentReplicas(t, client, "web-canary"); got != 0 {
+		t.Errorf("canary replicas after rollback = %d, want 0", got)
+	}
+}
+
+func TestCanaryCopyWorkload_HPA(t *testing.T) {
+	one := int32(1)
+	stableHPA := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: KindDeployment, Name: "web"},
+			MinReplicas:    &one,
+			MaxReplicas:    20,
+		},
+		Status: autoscalingv2.HorizontalPodAutoscalerStatus{CurrentReplicas: 8},
+	}
+	canaryHPA := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-canary", Namespace: "default"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: KindDeployment, Name: "web-canary"},
+			MinReplicas:    &one,
+			MaxReplicas:    3,
+		},
+	}
+	client := fake.NewSimpleClientset(
+		newTestDeployment("web", 8),
+		newTestDeployment("web-canary", 1),
+		stableHPA,
+		canaryHPA,
+	)
+	target, err := New(client, newScalingCanary(&deployv1alpha1.ReplicaScaling{ScaleDownStable: true}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if err := target.SetWeight(ctx, 50, nil); err != nil {
+		t.Fatalf("SetWeight() error = %v", err)
+	}
+
+	updated, err := client.AutoscalingV2().HorizontalPodAutoscalers("default").Get(ctx, "web-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get canary autoscaler: %v", err)
+	}
+	if *updated.Spec.MinReplicas != 4 || updated.Spec.MaxReplicas != 4 {
+		t.Errorf("canary autoscaler min/max = %d/%d, want 4/4", *updated.Spec.MinReplicas, updated.Spec.MaxReplicas)
+	}
+	if got := deploymentReplicas(t, client, "web-canary"); got != 1 {
+		t.Errorf("canary replicas = %d, want 1 left to the autoscaler", got)
+	}
+	if got := deploymentReplicas(t, client, "web"); got != 8 {
+		t.Errorf("stable replicas = %d, want 8 left to the autoscaler", got)
+	}
+}
+
+func TestCanaryCopyWorkload_RollbackRestoresCanaryHPA(t *testing.T) {
+	one := int32(1)
+	canaryHPA := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-canary", Namespace: "default"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: KindDeployment, Name: "web-canary"},
+			MinReplicas:    &one,
+			MaxReplicas:    3,
+		},
+	}
+	client := fake.NewSimpleClientset(newTestDeployment("web", 10), newTestDeployment("web-canary", 1), canaryHPA)
+	target, err := New(client, newScalingCanary(&deployv1alpha1.ReplicaScaling{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	for _, weight := range []int{20, 50} {
+		if err := target.SetWeight(ctx, weight, nil); err != nil {
+			t.Fatalf("SetWeight(%d) error = %v", weight, err)
+		}
+	}
+	if err := target.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	restored, err := client.AutoscalingV2().HorizontalPodAutoscalers("default").Get(ctx, "web-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get canary autoscaler: %v", err)
+	}
+	if restored.Spec.MinReplicas == nil || *restored.Spec.MinReplicas != 1 || restored.Spec.MaxReplicas != 3 {
+		t.Errorf("canary autoscaler min/max after rollback = %v/%d, want 1/3", restored.Spec.MinReplicas, restored.Spec.MaxReplicas)
+	}
+	if len(restored.Annotations) != 0 {
+		t.Errorf("canary autoscaler annotations after rollback = %v, want none", restored.Annotations)
+	}
+	if got := deploymentReplicas(t, client, "web-canary"); got != 0 {
+		t.Errorf("canary replicas after rollback = %d, want 0", got)
+	}
+}
+
+func TestCanaryCopyWorkload_CompleteClearsRecordedState(t *testing.T) {
+	one := int32(1)
+	canaryHPA := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-canary", Namespace: "default"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: KindDeployment, Name: "web-canary"},
+			MinReplicas:    &one,
+			MaxReplicas:    3,
+		},
+	}
+	client := fake.NewSimpleClientset(newTestDeployment("web", 10), newTestDeployment("web-canary", 1), canaryHPA)
+	target, err := New(client, newScalingCanary(&deployv1alpha1.ReplicaScaling{ScaleDownStable: true}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	for _, weight := range []int{50, 100} {
+		if err := target.SetWeight(ctx, weight, nil); err != nil {
+			t.Fatalf("SetWeight(%d) error = %v", weight, err)
+		}
+	}
+	if err := target.Complete(ctx); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	stable, err := client.AppsV1().Deployments("default").Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get stable deployment: %v", err)
+	}
+	if _, ok := stable.Annotations[stableReplicasAnnotation]; ok {
+		t.Errorf("stable annotations after completion = %v, want %s removed", stable.Annotations, stableReplicasAnnotation)
+	}
+	if *stable.Spec.Replicas != 0 {
+		t.Errorf("stable replicas after completion = %d, want 0 left as is", *stable.Spec.Replicas)
+	}
+
+	restored, err := client.AutoscalingV2().HorizontalPodAutoscalers("default").Get(ctx, "web-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get canary autoscaler: %v", err)
+	}
+	if restored.Spec.MinReplicas == nil || *restored.Spec.MinReplicas != 1 || restored.Spec.MaxReplicas != 3 {
+		t.Errorf("canary autoscaler min/max after completion = %v/%d, want 1/3", restored.Spec.MinReplicas, restored.Spec.MaxReplicas)
+	}
+	if len(restored.Annotations) != 0 {
+		t.Errorf("canary autoscaler annotations after completion = %v, want none", restored.Annotations)
+	}
+}
@@ -0,0 +1,199 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CanaryNodeLabel marks the nodes a DaemonSet canary runs on. Its value is
+// the name of the CanaryDeployment.
+const CanaryNodeLabel = "deploy.codedance.io/canary"
+
+// daemonSetWorkload rolls a DaemonSet out node by node. The new version runs
+// in "<name>-canary", restricted to nodes carrying CanaryNodeLabel, while the
+// stable DaemonSet is kept off those nodes. Weight is the share of eligible
+// nodes, selected by the canary's node selector, that are labelled.
+type daemonSetWorkload struct {
+	clientset    kubernetes.Interface
+	namespace    string
+	name         string
+	canaryName   string
+	nodeSelector map[string]string
+}
+
+func (w *daemonSetWorkload) SetWeight(ctx context.Context, weight int, replicas *int32) error {
+	if err := w.ensureNodePlacement(ctx); err != nil {
+		return err
+	}
+
+	nodes, err := w.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(w.nodeSelector).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	// Nodes already running the canary are kept first so that raising the
+	// weight only adds nodes.
+	eligible := make([]corev1.Node, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		if value, ok := node.Labels[CanaryNodeLabel]; !ok || value == w.canaryName {
+			eligible = append(eligible, node)
+		}
+	}
+	sort.SliceStable(eligible, func(i, j int) bool {
+		ci, cj := w.isCanaryNode(&eligible[i]), w.isCanaryNode(&eligible[j])
+		if ci != cj {
+			return ci
+		}
+		return eligible[i].Name < eligible[j].Name
+	})
+
+	want := int(math.Ceil(float64(len(eligible)) * float64(weight) / 100))
+	for i := range eligible {
+		if err := w.labelNode(ctx, &eligible[i], i < want); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *daemonSetWorkload) CanaryPods(ctx context.Context) ([]corev1.Pod, error) {
+	ds, err := w.clientset.AppsV1().DaemonSets(w.namespace).Get(ctx, w.name+"-canary", metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get canary daemonset: %w", err)
+	}
+	return listPods(ctx, w.clientset, w.namespace, ds.Spec.Selector)
+}
+
+// Rollback removes the canary label from every node, so the canary pods are
+// removed and the stable DaemonSet schedules onto those nodes again.
+func (w *daemonSetWorkload) Rollback(ctx context.Context) error {
+	nodes, err := w.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{CanaryNodeLabel: w.canaryName}).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for i := range nodes.Items {
+		if err := w.labelNode(ctx, &nodes.Items[i], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Complete has nothing to clear: the canary node labels stay in place for
+// the canary DaemonSet that now serves.
+func (w *daemonSetWorkload) Complete(ctx context.Context) error {
+	return nil
+}
+
+// ensureNodePlacement pins the canary DaemonSet to canary nodes and keeps
+// the stable DaemonSet off them. Changing the stable template restarts its
+// pods once, so declaring the affinity up front avoids that.
+func (w *daemonSetWorkload) ensureNodePlacement(ctx context.Context) error {
+	daemonSets := w.clientset.AppsV1().DaemonSets(w.namespace)
+
+	canaryDS, err := daemonSets.Get(ctx, w.name+"-canary", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get canary daemonset: %w", err)
+	}
+	if canaryDS.Spec.Template.Spec.NodeSelector[CanaryNodeLabel] != w.canaryName {
+		if canaryDS.Spec.Template.Spec.NodeSelector == nil {
+			canaryDS.Spec.Template.Spec.NodeSelector = make(map[string]string)
+		}
+		canaryDS.Spec.Template.Spec.NodeSelector[CanaryNodeLabel] = w.canaryName
+		if _, err := daemonSets.Update(ctx, canaryDS, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("pin canary daemonset to canary nodes: %w", err)
+		}
+	}
+
+	stable, err := daemonSets.Get(ctx, w.name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get stable daemonset: %w", err)
+	}
+	if excludeCanaryNodes(stable, w.canaryName) {
+		if _, err := daemonSets.Update(ctx, stable, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("exclude canary nodes from stable daemonset: %w", err)
+		}
+	}
+	return nil
+}
+
+// excludeCanaryNodes adds a NotIn requirement on CanaryNodeLabel to every
+// required node selector term and reports whether the template changed.
+func excludeCanaryNodes(ds *appsv1.DaemonSet, canaryName string) bool {
+	requirement := corev1.NodeSelectorRequirement{
+		Key:      CanaryNodeLabel,
+		Operator: corev1.NodeSelectorOpNotIn,
+		Values:   []string{canaryName},
+	}
+
+	spec := &ds.Spec.Template.Spec
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	required := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil {
+		required = &corev1.NodeSelector{}
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = required
+	}
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+
+	changed := false
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		if hasRequirement(term.MatchExpressions, requirement) {
+			continue
+		}
+		term.MatchExpressions = append(term.MatchExpressions, requirement)
+		changed = true
+	}
+	return changed
+}
+
+func hasRequirement(expressions []corev1.NodeSelectorRequirement, want corev1.NodeSelectorRequirement) bool {
+	for _, expr := range expressions {
+		if expr.Key == want.Key && expr.Operator == want.Operator && len(expr.Values) == 1 && expr.Values[0] == want.Values[0] {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *daemonSetWorkload) isCanaryNode(node *corev1.Node) bool {
+	return node.Labels[CanaryNodeLabel] == w.canaryName
+}
+
+func (w *daemonSetWorkload) labelNode(ctx context.Context, node *corev1.Node, canary bool) error {
+	if w.isCanaryNode(node) == canary {
+		return nil
+	}
+	if canary {
+		if node.Labels == nil {
+			node.Labels = make(map[string]string)
+		}
+		node.Labels[CanaryNodeLabel] = w.canaryName
+	} else {
+		delete(node.Labels, CanaryNodeLabel)
+	}
+
+	if _, err := w.clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("label node %s: %w", node.Name, err)
+	}
+	return nil
+}
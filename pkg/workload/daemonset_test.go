@@ -0,0 +1,101 @@
+package workload
+
+import (
+	"context"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestNode(name string, labels map[string]string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func newTestDaemonSet(name string) *appsv1.DaemonSet {
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+		},
+	}
+}
+
+func canaryNodes(t *testing.T, client *fake.Clientset) []string {
+	t.Helper()
+
+	nodes, err := client.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("list nodes: %v", err)
+	}
+	var names []string
+	for _, node := range nodes.Items {
+		if node.Labels[CanaryNodeLabel] == "test-canary" {
+			names = append(names, node.Name)
+		}
+	}
+	return names
+}
+
+func TestDaemonSetWorkload_SetWeight(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newTestDaemonSet("agent"),
+		newTestDaemonSet("agent-canary"),
+		newTestNode("node-a", map[string]string{"pool": "general"}),
+		newTestNode("node-b", map[string]string{"pool": "general"}),
+		newTestNode("node-c", map[string]string{"pool": "general"}),
+		newTestNode("node-d", map[string]string{"pool": "general"}),
+		newTestNode("gpu-a", map[string]string{"pool": "gpu"}),
+	)
+	canary := newTestCanary(&deployv1alpha1.WorkloadReference{APIVersion: "apps/v1", Kind: KindDaemonSet, Name: "agent"})
+	canary.Spec.CanaryNodeSelector = map[string]string{"pool": "general"}
+	target, err := New(client, canary)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if err := target.SetWeight(ctx, 25, nil); err != nil {
+		t.Fatalf("SetWeight(25) error = %v", err)
+	}
+	if got := canaryNodes(t, client); len(got) != 1 || got[0] != "node-a" {
+		t.Errorf("canary nodes at 25%% = %v, want [node-a]", got)
+	}
+
+	if err := target.SetWeight(ctx, 50, nil); err != nil {
+		t.Fatalf("SetWeight(50) error = %v", err)
+	}
+	if got := canaryNodes(t, client); len(got) != 2 {
+		t.Errorf("canary nodes at 50%% = %v, want 2 nodes", got)
+	}
+
+	canaryDS, _ := client.AppsV1().DaemonSets("default").Get(ctx, "agent-canary", metav1.GetOptions{})
+	if canaryDS.Spec.Template.Spec.NodeSelector[CanaryNodeLabel] != "test-canary" {
+		t.Errorf("canary daemonset nodeSelector = %v, want %s=test-canary", canaryDS.Spec.Template.Spec.NodeSelector, CanaryNodeLabel)
+	}
+	stable, _ := client.AppsV1().DaemonSets("default").Get(ctx, "agent", metav1.GetOptions{})
+	terms := stable.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || len(terms[0].MatchExpressions) != 1 || terms[0].MatchExpressions[0].Operator != corev1.NodeSelectorOpNotIn {
+		t.Errorf("stable node affinity = %v, want NotIn canary nodes", terms)
+	}
+
+	if err := target.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if got := canaryNodes(t, client); len(got) != 0 {
+		t.Errorf("canary nodes after rollback = %v, want none", got)
+	}
+}
+
+func TestExcludeCanaryNodes_Idempotent(t *testing.T) {
+	ds := newTestDaemonSet("agent")
+	if !excludeCanaryNodes(ds, "test-canary") {
+		t.Error("excludeCanaryNodes() = false on first call, want true")
+	}
+	if excludeCanaryNodes(ds, "test-canary") {
+		t.Error("excludeCanaryNodes() = true on second call, want false")
+	}
+}
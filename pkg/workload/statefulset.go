@@ -0,0 +1,116 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// statefulSetWorkload rolls a StatefulSet out through its rolling update
+// partition: pods with an ordinal at or above the partition run the update
+// revision. The partition must already equal the replica count when the new
+// template is applied, otherwise every pod is updated at once.
+type statefulSetWorkload struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func (w *statefulSetWorkload) SetWeight(ctx context.Context, weight int, replicas *int32) error {
+	statefulSets := w.clientset.AppsV1().StatefulSets(w.namespace)
+	sts, err := statefulSets.Get(ctx, w.name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get statefulset: %w", err)
+	}
+
+	total := replicasOf(sts.Spec.Replicas)
+	updated := int32(math.Ceil(float64(total) * float64(weight) / 100))
+	return w.setPartition(ctx, sts, total-updated)
+}
+
+func (w *statefulSetWorkload) CanaryPods(ctx context.Context) ([]corev1.Pod, error) {
+	sts, err := w.clientset.AppsV1().StatefulSets(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get statefulset: %w", err)
+	}
+
+	pods, err := listPods(ctx, w.clientset, w.namespace, sts.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	return updatedPods(pods, sts), nil
+}
+
+// Rollback raises the partition above every ordinal and deletes the pods
+// already on the update revision, which the StatefulSet controller then
+// recreates from the current revision.
+func (w *statefulSetWorkload) Rollback(ctx context.Context) error {
+	sts, err := w.clientset.AppsV1().StatefulSets(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get statefulset: %w", err)
+	}
+
+	if err := w.setPartition(ctx, sts, replicasOf(sts.Spec.Replicas)); err != nil {
+		return err
+	}
+	if sts.Status.UpdateRevision == "" || sts.Status.UpdateRevision == sts.Status.CurrentRevision {
+		return nil
+	}
+
+	pods, err := listPods(ctx, w.clientset, w.namespace, sts.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	for _, pod := range updatedPods(pods, sts) {
+		if err := w.clientset.CoreV1().Pods(w.namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
+			return fmt.Errorf("delete updated pod %s: %w", pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// Complete has nothing to clear: the partition is the only state a rollout
+// keeps on a StatefulSet.
+func (w *statefulSetWorkload) Complete(ctx context.Context) error {
+	return nil
+}
+
+func (w *statefulSetWorkload) setPartition(ctx context.Context, sts *appsv1.StatefulSet, partition int32) error {
+	if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return fmt.Errorf("statefulset %s must use the RollingUpdate update strategy", sts.Name)
+	}
+
+	rollingUpdate := sts.Spec.UpdateStrategy.RollingUpdate
+	if rollingUpdate != nil && rollingUpdate.Partition != nil && *rollingUpdate.Partition == partition {
+		return nil
+	}
+	if rollingUpdate == nil {
+		rollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{}
+	}
+	rollingUpdate.Partition = &partition
+	sts.Spec.UpdateStrategy.Type = appsv1.RollingUpdateStatefulSetStrategyType
+	sts.Spec.UpdateStrategy.RollingUpdate = rollingUpdate
+
+	if _, err := w.clientset.AppsV1().StatefulSets(w.namespace).Update(ctx, sts, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update statefulset partition: %w", err)
+	}
+	return nil
+}
+
+func updatedPods(pods []corev1.Pod, sts *appsv1.StatefulSet) []corev1.Pod {
+	if sts.Status.UpdateRevision == "" {
+		return nil
+	}
+	updated := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if pod.Labels[appsv1.ControllerRevisionHashLabelKey] == sts.Status.UpdateRevision {
+			updated = append(updated, pod)
+		}
+	}
+	return updated
+}
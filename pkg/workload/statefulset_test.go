@@ -0,0 +1,106 @@
+package workload
+
+import (
+	"context"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestStatefulSet(replicas int32) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			},
+		},
+		Status: appsv1.StatefulSetStatus{
+			CurrentRevision: "db-old",
+			UpdateRevision:  "db-new",
+		},
+	}
+}
+
+func TestStatefulSetWorkload_SetWeight(t *testing.T) {
+	tests := []struct {
+		weight        int
+		wantPartition int32
+	}{
+		{weight: 0, wantPartition: 5},
+		{weight: 10, wantPartition: 4},
+		{weight: 50, wantPartition: 2},
+		{weight: 100, wantPartition: 0},
+	}
+
+	for _, tt := range tests {
+		client := fake.NewSimpleClientset(newTestStatefulSet(5))
+		target, err := New(client, newTestCanary(&deployv1alpha1.WorkloadReference{Kind: KindStatefulSet, Name: "db"}))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		ctx := context.Background()
+		if err := target.SetWeight(ctx, tt.weight, nil); err != nil {
+			t.Fatalf("SetWeight(%d) error = %v", tt.weight, err)
+		}
+
+		sts, _ := client.AppsV1().StatefulSets("default").Get(ctx, "db", metav1.GetOptions{})
+		partition := sts.Spec.UpdateStrategy.RollingUpdate.Partition
+		if partition == nil || *partition != tt.wantPartition {
+			t.Errorf("SetWeight(%d) partition = %v, want %d", tt.weight, partition, tt.wantPartition)
+		}
+	}
+}
+
+func TestStatefulSetWorkload_OnDeleteRejected(t *testing.T) {
+	sts := newTestStatefulSet(3)
+	sts.Spec.UpdateStrategy.Type = appsv1.OnDeleteStatefulSetStrategyType
+	client := fake.NewSimpleClientset(sts)
+	target, _ := New(client, newTestCanary(&deployv1alpha1.WorkloadReference{Kind: KindStatefulSet, Name: "db"}))
+
+	if err := target.SetWeight(context.Background(), 50, nil); err == nil {
+		t.Error("SetWeight() error = nil, want error for OnDelete strategy")
+	}
+}
+
+func TestStatefulSetWorkload_CanaryPodsAndRollback(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newTestStatefulSet(3),
+		newTestPod("db-0", map[string]string{"app": "db", appsv1.ControllerRevisionHashLabelKey: "db-old"}),
+		newTestPod("db-1", map[string]string{"app": "db", appsv1.ControllerRevisionHashLabelKey: "db-old"}),
+		newTestPod("db-2", map[string]string{"app": "db", appsv1.ControllerRevisionHashLabelKey: "db-new"}),
+	)
+	target, err := New(client, newTestCanary(&deployv1alpha1.WorkloadReference{Kind: KindStatefulSet, Name: "db"}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	pods, err := target.CanaryPods(ctx)
+	if err != nil {
+		t.Fatalf("CanaryPods() error = %v", err)
+	}
+	if len(pods) != 1 || pods[0].Name != "db-2" {
+		t.Errorf("CanaryPods() = %v, want db-2", pods)
+	}
+
+	if err := target.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	sts, _ := client.AppsV1().StatefulSets("default").Get(ctx, "db", metav1.GetOptions{})
+	if *sts.Spec.UpdateStrategy.RollingUpdate.Partition != 3 {
+		t.Errorf("partition = %d, want 3 after rollback", *sts.Spec.UpdateStrategy.RollingUpdate.Partition)
+	}
+	if _, err := client.CoreV1().Pods("default").Get(ctx, "db-2", metav1.GetOptions{}); err == nil {
+		t.Error("updated pod db-2 not deleted on rollback")
+	}
+	if _, err := client.CoreV1().Pods("default").Get(ctx, "db-0", metav1.GetOptions{}); err != nil {
+		t.Errorf("stable pod db-0 deleted on rollback: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// VersionLabelKeys are the pod labels, in order of preference, that tell the
+// stable and canary versions of a workload apart.
+var VersionLabelKeys = []string{"version", "app.kubernetes.io/version"}
+
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// VersionLabels returns a label set selecting only the stable pods and one
+// selecting only the canary pods. StatefulSet versions share one object and
+// are told apart by controller revision; the other kinds by the first
+// VersionLabelKeys entry whose value differs between the stable and canary
+// pod templates, and Deployments without one by the pod-template-hash of
+// their current ReplicaSets.
+func VersionLabels(ctx context.Context, clientset kubernetes.Interface, canary *deployv1alpha1.CanaryDeployment) (map[string]string, map[string]string, error) {
+	ref := Ref(canary)
+	if ref.Kind == KindStatefulSet {
+		sts, err := clientset.AppsV1().StatefulSets(canary.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get statefulset: %w", err)
+		}
+		if sts.Status.CurrentRevision == "" || sts.Status.UpdateRevision == "" {
+			return nil, nil, fmt.Errorf("statefulset %s has no revisions yet", ref.Name)
+		}
+		return map[string]string{appsv1.ControllerRevisionHashLabelKey: sts.Status.CurrentRevision},
+			map[string]string{appsv1.ControllerRevisionHashLabelKey: sts.Status.UpdateRevision}, nil
+	}
+
+	stableLabels, err := podTemplateLabels(ctx, clientset, canary.Namespace, ref.Kind, ref.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	canaryLabels, err := podTemplateLabels(ctx, clientset, canary.Namespace, ref.Kind, ref.Name+"-canary")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, key := range VersionLabelKeys {
+		stable, canaryValue := stableLabels[key], canaryLabels[key]
+		if stable != "" && canaryValue != "" && stable != canaryValue {
+			return map[string]string{key: stable}, map[string]string{key: canaryValue}, nil
+		}
+	}
+	if ref.Kind == KindDeployment {
+		stableHash, err := podTemplateHash(ctx, clientset, canary.Namespace, ref.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		canaryHash, err := podTemplateHash(ctx, clientset, canary.Namespace, ref.Name+"-canary")
+		if err != nil {
+			return nil, nil, err
+		}
+		if stableHash != "" && canaryHash != "" && stableHash != canaryHash {
+			return map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: stableHash},
+				map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: canaryHash}, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("pod templates of %s and %s-canary need different values for one of the labels %v", ref.Name, ref.Name, VersionLabelKeys)
+}
+
+// podTemplateHash returns the pod-template-hash of the ReplicaSet running
+// the current revision of a Deployment, or "" if it has none yet.
+func podTemplateHash(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (string, error) {
+	deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get deployment %s: %w", name, err)
+	}
+	revision := deployment.Annotations[deploymentRevisionAnnotation]
+	if revision == "" || deployment.Spec.Selector == nil {
+		return "", nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return "", fmt.Errorf("invalid selector on deployment %s: %w", name, err)
+	}
+	replicaSets, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return "", fmt.Errorf("failed to list replicasets of %s: %w", name, err)
+	}
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		if metav1.IsControlledBy(rs, deployment) && rs.Annotations[deploymentRevisionAnnotation] == revision {
+			return rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey], nil
+		}
+	}
+	return "", nil
+}
+
+func podTemplateLabels(ctx context.Context, clientset kubernetes.Interface, namespace, kind, name string) (map[string]string, error) {
+	switch kind {
+	case KindReplicaSet:
+		rs, err := clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replicaset %s: %w", name, err)
+		}
+		return rs.Spec.Template.Labels, nil
+	case KindDaemonSet:
+		ds, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get daemonset %s: %w", name, err)
+		}
+		return ds.Spec.Template.Labels, nil
+	default:
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment %s: %w", name, err)
+		}
+		return deployment.Spec.Template.Labels, nil
+	}
+}
@@ -0,0 +1,67 @@
+package workload
+
+import (
+	"context"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newRevisionedDeployment(name string) *appsv1.Deployment {
+	deployment := newTestDeployment(name, 1)
+	deployment.UID = types.UID("uid-" + name)
+	deployment.Annotations = map[string]string{deploymentRevisionAnnotation: "2"}
+	deployment.Spec.Template.Labels = map[string]string{"app": name}
+	return deployment
+}
+
+func newOwnedReplicaSet(deployment *appsv1.Deployment, revision, hash string) *appsv1.ReplicaSet {
+	controller := true
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        deployment.Name + "-" + hash,
+			Namespace:   "default",
+			Labels:      map[string]string{"app": deployment.Name, appsv1.DefaultDeploymentUniqueLabelKey: hash},
+			Annotations: map[string]string{deploymentRevisionAnnotation: revision},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: deployment.Name, UID: deployment.UID, Controller: &controller},
+			},
+		},
+	}
+}
+
+func TestVersionLabels_PodTemplateHash(t *testing.T) {
+	stable := newRevisionedDeployment("web")
+	canaryDeployment := newRevisionedDeployment("web-canary")
+	client := fake.NewSimpleClientset(
+		stable, canaryDeployment,
+		newOwnedReplicaSet(stable, "1", "old"),
+		newOwnedReplicaSet(stable, "2", "aaa"),
+		newOwnedReplicaSet(canaryDeployment, "2", "bbb"),
+	)
+	canary := newTestCanary(&deployv1alpha1.WorkloadReference{Kind: KindDeployment, Name: "web"})
+
+	stableLabels, canaryLabels, err := VersionLabels(context.Background(), client, canary)
+	if err != nil {
+		t.Fatalf("VersionLabels() error = %v", err)
+	}
+	if got := stableLabels[appsv1.DefaultDeploymentUniqueLabelKey]; got != "aaa" {
+		t.Errorf("stable pod-template-hash = %q, want aaa", got)
+	}
+	if got := canaryLabels[appsv1.DefaultDeploymentUniqueLabelKey]; got != "bbb" {
+		t.Errorf("canary pod-template-hash = %q, want bbb", got)
+	}
+}
+
+func TestVersionLabels_NoDistinguishingLabels(t *testing.T) {
+	client := fake.NewSimpleClientset(newTestDeployment("web", 1), newTestDeployment("web-canary", 1))
+	canary := newTestCanary(&deployv1alpha1.WorkloadReference{Kind: KindDeployment, Name: "web"})
+
+	if _, _, err := VersionLabels(context.Background(), client, canary); err == nil {
+		t.Error("VersionLabels() error = nil, want error")
+	}
+}
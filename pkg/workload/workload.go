@@ -0,0 +1,137 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	KindDeployment  = "Deployment"
+	KindReplicaSet  = "ReplicaSet"
+	KindStatefulSet = "StatefulSet"
+	KindDaemonSet   = "DaemonSet"
+)
+
+// Workload is the application a canary rolls out, whatever its kind.
+type Workload interface {
+	// SetWeight moves weight percent of the workload to the new version.
+	// Kinds whose new version runs in a separate "-canary" object leave the
+	// traffic split to the traffic manager and only size the canary, using
+	// replicas when it is set.
+	SetWeight(ctx context.Context, weight int, replicas *int32) error
+	// CanaryPods lists the pods running the new version.
+	CanaryPods(ctx context.Context) ([]corev1.Pod, error)
+	// Rollback removes the new version so that only the stable one serves.
+	Rollback(ctx context.Context) error
+	// Complete clears what the rollout recorded on the workload once the new
+	// version has taken over, leaving the replica counts as they are.
+	Complete(ctx context.Context) error
+}
+
+// Ref returns the workload a canary targets. A bare targetDeployment is
+// treated as a reference to a Deployment.
+func Ref(canary *deployv1alpha1.CanaryDeployment) deployv1alpha1.WorkloadReference {
+	if ref := canary.Spec.WorkloadRef; ref != nil {
+		return *ref
+	}
+	return deployv1alpha1.WorkloadReference{
+		APIVersion: "apps/v1",
+		Kind:       KindDeployment,
+		Name:       canary.Spec.TargetDeployment,
+	}
+}
+
+// TargetName returns the name of the target workload, which by default also
+// names its Services.
+func TargetName(canary *deployv1alpha1.CanaryDeployment) string {
+	return Ref(canary).Name
+}
+
+// ServiceNames returns the Service clients reach the workload through and the
+// Services selecting only its stable and only its canary pods. They default
+// to the target name, the target name and "<target>-canary"; with
+// spec.services set, the stable and canary Services are the version-pinned
+// ones the controller manages, by default "<target>-stable" and
+// "<target>-canary".
+func ServiceNames(canary *deployv1alpha1.CanaryDeployment) (service, stable, canaryService string) {
+	target := TargetName(canary)
+	services := canary.Spec.Services
+	if services == nil {
+		return target, target, target + "-canary"
+	}
+
+	service, stable, canaryService = target, target+"-stable", target+"-canary"
+	if services.Service != "" {
+		service = services.Service
+	}
+	if services.StableService != "" {
+		stable = services.StableService
+	}
+	if services.CanaryService != "" {
+		canaryService = services.CanaryService
+	}
+	return service, stable, canaryService
+}
+
+func New(clientset kubernetes.Interface, canary *deployv1alpha1.CanaryDeployment) (Workload, error) {
+	ref := Ref(canary)
+	if ref.Name == "" {
+		return nil, fmt.Errorf("canary %s has neither targetDeployment nor workloadRef", canary.Name)
+	}
+	if ref.APIVersion != "" && ref.APIVersion != "apps/v1" {
+		return nil, fmt.Errorf("unsupported workload apiVersion %q", ref.APIVersion)
+	}
+
+	switch ref.Kind {
+	case KindDeployment, KindReplicaSet:
+		return &canaryCopyWorkload{
+			clientset: clientset,
+			namespace: canary.Namespace,
+			kind:      ref.Kind,
+			name:      ref.Name,
+			scaling:   canary.Spec.Scaling,
+		}, nil
+	case KindStatefulSet:
+		return &statefulSetWorkload{clientset: clientset, namespace: canary.Namespace, name: ref.Name}, nil
+	case KindDaemonSet:
+		return &daemonSetWorkload{
+			clientset:    clientset,
+			namespace:    canary.Namespace,
+			name:         ref.Name,
+			canaryName:   canary.Name,
+			nodeSelector: canary.Spec.CanaryNodeSelector,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported workload kind %q", ref.Kind)
+	}
+}
+
+func listPods(ctx context.Context, clientset kubernetes.Interface, namespace string, selector *metav1.LabelSelector) ([]corev1.Pod, error) {
+	if selector == nil {
+		return nil, fmt.Errorf("workload has no pod selector")
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod selector: %w", err)
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labelSelector.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	return pods.Items, nil
+}
+
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
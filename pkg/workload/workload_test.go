@@ -0,0 +1,127 @@
+package workload
+
+import (
+	"context"
+	"testing"
+
+	deployv1alpha1 "github.com/codefarmer009/codedance/pkg/apis/deploy/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestCanary(ref *deployv1alpha1.WorkloadReference) *deployv1alpha1.CanaryDeployment {
+	return &deployv1alpha1.CanaryDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-canary",
+			Namespace: "default",
+		},
+		Spec: deployv1alpha1.CanaryDeploymentSpec{
+			TargetDeployment: "legacy-app",
+			WorkloadRef:      ref,
+		},
+	}
+}
+
+func newTestPod(name string, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+	}
+}
+
+func TestRef(t *testing.T) {
+	legacy := Ref(newTestCanary(nil))
+	if legacy.Kind != KindDeployment || legacy.Name != "legacy-app" {
+		t.Errorf("Ref() = %+v, want Deployment legacy-app", legacy)
+	}
+
+	ref := Ref(newTestCanary(&deployv1alpha1.WorkloadReference{Kind: KindStatefulSet, Name: "db"}))
+	if ref.Kind != KindStatefulSet || ref.Name != "db" {
+		t.Errorf("Ref() = %+v, want StatefulSet db", ref)
+	}
+}
+
+func TestServiceNames(t *testing.T) {
+	tests := []struct {
+		name                                string
+		services                            *deployv1alpha1.ManagedServices
+		wantService, wantStable, wantCanary string
+	}{
+		{name: "unmanaged", wantService: "legacy-app", wantStable: "legacy-app", wantCanary: "legacy-app-canary"},
+		{name: "managed", services: &deployv1alpha1.ManagedServices{}, wantService: "legacy-app", wantStable: "legacy-app-stable", wantCanary: "legacy-app-canary"},
+		{
+			name:        "managed with names",
+			services:    &deployv1alpha1.ManagedServices{Service: "web", StableService: "web-v1", CanaryService: "web-v2"},
+			wantService: "web", wantStable: "web-v1", wantCanary: "web-v2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canary := newTestCanary(nil)
+			canary.Spec.Services = tt.services
+			service, stable, canaryService := ServiceNames(canary)
+			if service != tt.wantService || stable != tt.wantStable || canaryService != tt.wantCanary {
+				t.Errorf("ServiceNames() = %s, %s, %s, want %s, %s, %s", service, stable, canaryService, tt.wantService, tt.wantStable, tt.wantCanary)
+			}
+		})
+	}
+}
+
+func TestNew_Unsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  *deployv1alpha1.WorkloadReference
+	}{
+		{name: "unknown kind", ref: &deployv1alpha1.WorkloadReference{Kind: "CronJob", Name: "app"}},
+		{name: "unknown apiVersion", ref: &deployv1alpha1.WorkloadReference{APIVersion: "apps/v1beta1", Kind: KindDeployment, Name: "app"}},
+		{name: "missing name", ref: &deployv1alpha1.WorkloadReference{Kind: KindDeployment}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canary := newTestCanary(tt.ref)
+			canary.Spec.TargetDeployment = ""
+			if _, err := New(fake.NewSimpleClientset(), canary); err == nil {
+				t.Error("New() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestCanaryCopyWorkload_ReplicaSet(t *testing.T) {
+	replicas := int32(3)
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-canary", Namespace: "default"},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web", "version": "v2"}},
+		},
+	}
+	client := fake.NewSimpleClientset(rs,
+		newTestPod("web-canary-a", map[string]string{"app": "web", "version": "v2"}),
+		newTestPod("web-b", map[string]string{"app": "web", "version": "v1"}),
+	)
+	target, err := New(client, newTestCanary(&deployv1alpha1.WorkloadReference{Kind: KindReplicaSet, Name: "web"}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	pods, err := target.CanaryPods(ctx)
+	if err != nil {
+		t.Fatalf("CanaryPods() error = %v", err)
+	}
+	if len(pods) != 1 || pods[0].Name != "web-canary-a" {
+		t.Errorf("CanaryPods() = %v, want web-canary-a", pods)
+	}
+
+	if err := target.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	updated, _ := client.AppsV1().ReplicaSets("default").Get(ctx, "web-canary", metav1.GetOptions{})
+	if *updated.Spec.Replicas != 0 {
+		t.Errorf("canary replicas = %d, want 0", *updated.Spec.Replicas)
+	}
+}
@@ -214,7 +214,7 @@ function renderCanaryDetail() {
             <div class="info-grid">
                 <div class="info-item">
                     <div class="info-label">目标部署</div>
-                    <div class="info-value">${escapeHtml(canary.spec?.targetDeployment || 'N/A')}</div>
+                    <div class="info-value">${escapeHtml(canary.spec?.workloadRef ? `${canary.spec.workloadRef.kind}/${canary.spec.workloadRef.name}` : (canary.spec?.targetDeployment || 'N/A'))}</div>
                 </div>
                 <div class="info-item">
                     <div class="info-label">金丝雀版本</div>